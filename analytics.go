@@ -2,6 +2,7 @@ package flagsmith
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -12,19 +13,35 @@ import (
 const AnalyticsTimerInMilli = 10 * 1000
 const AnalyticsEndpoint = "analytics/flags/"
 
+// analyticDataStore holds the number of evaluations of each feature, by environment key.
 type analyticDataStore struct {
 	mu   sync.Mutex
-	data map[string]int
+	data map[string]map[string]int
 }
 type AnalyticsProcessor struct {
 	client   *resty.Client
 	store    *analyticDataStore
 	endpoint string
 	log      Logger
+	// environmentKey is sent with the data tracked by this processor, if set. Otherwise the
+	// resty client is expected to provide the environment key header.
+	environmentKey string
+	// execute sends requests, applying the retry policy of the Client owning the processor.
+	execute func(req *resty.Request, method, url string) (*resty.Response, error)
 }
 
 func NewAnalyticsProcessor(ctx context.Context, client *resty.Client, baseURL string, timerInMilli *int, log Logger) *AnalyticsProcessor {
-	data := make(map[string]int)
+	return newAnalyticsProcessor(ctx, client, baseURL, timerInMilli, log, nil)
+}
+
+func newAnalyticsProcessor(ctx context.Context, client *resty.Client, baseURL string, timerInMilli *int, log Logger,
+	execute func(req *resty.Request, method, url string) (*resty.Response, error)) *AnalyticsProcessor {
+	if execute == nil {
+		execute = func(req *resty.Request, method, url string) (*resty.Response, error) {
+			return req.Execute(method, url)
+		}
+	}
+	data := make(map[string]map[string]int)
 	dataStore := analyticDataStore{data: data}
 	tickerInterval := AnalyticsTimerInMilli
 	if timerInMilli != nil {
@@ -35,6 +52,7 @@ func NewAnalyticsProcessor(ctx context.Context, client *resty.Client, baseURL st
 		store:    &dataStore,
 		endpoint: baseURL + AnalyticsEndpoint,
 		log:      log,
+		execute:  execute,
 	}
 	log.Debugf("analytics processor starting")
 	go processor.start(ctx, tickerInterval)
@@ -58,28 +76,46 @@ func (a *AnalyticsProcessor) start(ctx context.Context, tickerInterval int) {
 	}
 }
 
+// forEnvironment returns a processor sharing this processor's data, which tracks features of
+// the given environment. Only the original processor uploads data in the background.
+func (a *AnalyticsProcessor) forEnvironment(environmentKey string) *AnalyticsProcessor {
+	processor := *a
+	processor.environmentKey = environmentKey
+	return &processor
+}
+
 func (a *AnalyticsProcessor) Flush(ctx context.Context) error {
 	a.store.mu.Lock()
 	defer a.store.mu.Unlock()
-	if len(a.store.data) == 0 {
-		return nil
-	}
-	resp, err := a.client.R().SetContext(ctx).SetBody(a.store.data).Post(a.endpoint)
-	if err != nil {
-		return err
-	}
-	if !resp.IsSuccess() {
-		return fmt.Errorf("received unexpected response from server: %s", resp.Status())
-	}
+	var errs []error
+	for environmentKey, data := range a.store.data {
+		req := a.client.R().SetContext(ctx).SetBody(data)
+		if environmentKey != "" {
+			req.SetHeader(EnvironmentKeyHeader, environmentKey)
+		}
+		resp, err := a.execute(req, resty.MethodPost, a.endpoint)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !resp.IsSuccess() {
+			errs = append(errs, fmt.Errorf("received unexpected response from server: %s", resp.Status()))
+			continue
+		}
 
-	// Clear the cache in case of success.
-	a.store.data = make(map[string]int)
-	return nil
+		// Clear the cache in case of success.
+		delete(a.store.data, environmentKey)
+	}
+	return errors.Join(errs...)
 }
 
 func (a *AnalyticsProcessor) TrackFeature(featureName string) {
 	a.store.mu.Lock()
 	defer a.store.mu.Unlock()
-	currentCount := a.store.data[featureName]
-	a.store.data[featureName] = currentCount + 1
+	data, ok := a.store.data[a.environmentKey]
+	if !ok {
+		data = make(map[string]int)
+		a.store.data[a.environmentKey] = data
+	}
+	data[featureName]++
 }
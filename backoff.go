@@ -2,7 +2,14 @@ package flagsmith
 
 import (
 	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
 	"time"
+
+	"github.com/go-resty/resty/v2"
 )
 
 const (
@@ -10,26 +17,88 @@ const (
 	maxBackoff     = 30 * time.Second
 )
 
+// RetryPolicy determines how requests to the Flagsmith API are retried, see WithRetryPolicy.
+// Delays between attempts grow exponentially, and a response's Retry-After header is respected
+// when it requests a longer delay.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	// Values below 2 disable retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, which doubles after every retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts, if set.
+	MaxBackoff time.Duration
+	// Jitter adds a random delay of up to the given fraction of each delay, e.g. 0.5 for up to 50%.
+	Jitter float64
+	// Budget bounds the total time spent on a request, including retries, if set.
+	Budget time.Duration
+	// Retryable reports whether a failed attempt is retried, given the status code of the response,
+	// or the error if no response was received. By default, network errors, timeouts, server errors
+	// and 429 Too Many Requests responses are retried.
+	Retryable func(statusCode int, err error) bool
+}
+
+// DefaultRetryPolicy is a RetryPolicy suitable for most applications, which can be used with
+// WithRetryPolicy. Requests are not retried unless a RetryPolicy is configured.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: initialBackoff,
+	MaxBackoff:     5 * time.Second,
+	Jitter:         0.5,
+}
+
+// reconnectPolicy determines the delay between attempts to connect to the realtime stream.
+var reconnectPolicy = RetryPolicy{
+	InitialBackoff: initialBackoff,
+	MaxBackoff:     maxBackoff,
+	Jitter:         1,
+}
+
+// retryable reports whether a failed attempt is retried.
+func (p RetryPolicy) retryable(resp *resty.Response, err error) bool {
+	statusCode := 0
+	if err == nil {
+		if resp.IsSuccess() {
+			return false
+		}
+		statusCode = resp.StatusCode()
+	}
+	if p.Retryable != nil {
+		return p.Retryable(statusCode, err)
+	}
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	return statusCode >= http.StatusInternalServerError || statusCode == http.StatusTooManyRequests
+}
+
 // backoff handles exponential backoff with jitter.
 type backoff struct {
+	policy  RetryPolicy
 	current time.Duration
 }
 
-// newBackoff creates a new backoff instance.
+// newBackoff creates a new backoff instance, for reconnecting to the realtime stream.
 func newBackoff() *backoff {
+	return reconnectPolicy.newBackoff()
+}
+
+// newBackoff creates a backoff following the policy.
+func (p RetryPolicy) newBackoff() *backoff {
 	return &backoff{
-		current: initialBackoff,
+		policy:  p,
+		current: p.InitialBackoff,
 	}
 }
 
 // next returns the next backoff duration and updates the current backoff.
 func (b *backoff) next() time.Duration {
-	// Add jitter between 0-1s
-	backoff := b.current + time.Duration(time.Now().UnixNano()%1e9)
+	backoff := b.current + time.Duration(rand.Float64()*b.policy.Jitter*float64(b.current))
 
 	// Double the backoff time, but cap it
-	if b.current < maxBackoff {
-		b.current *= 2
+	b.current *= 2
+	if b.policy.MaxBackoff > 0 {
+		b.current = min(b.current, b.policy.MaxBackoff)
 	}
 
 	return backoff
@@ -37,14 +106,109 @@ func (b *backoff) next() time.Duration {
 
 // reset resets the backoff to initial value.
 func (b *backoff) reset() {
-	b.current = initialBackoff
+	b.current = b.policy.InitialBackoff
 }
 
 // wait waits for the current backoff time, or until ctx is done.
 func (b *backoff) wait(ctx context.Context) {
+	sleep(ctx, b.next())
+}
+
+// sleep waits for the given duration, and returns false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
 	select {
 	case <-ctx.Done():
-		return
-	case <-time.After(b.next()):
+		return false
+	case <-timer.C:
+		return true
 	}
 }
+
+// retryPolicy returns the retry policy of the endpoint.
+func (c *Client) retryPolicy(endpoint string) RetryPolicy {
+	if policy, ok := c.config.endpointRetryPolicies[strings.TrimPrefix(endpoint, c.config.baseURL)]; ok {
+		return policy
+	}
+	return c.config.retryPolicy
+}
+
+// execute sends the request, retrying it according to the endpoint's retry policy. Requests are
+// not sent while the circuit breaker is open, and the outcome of every attempt is recorded.
+func (c *Client) execute(req *resty.Request, method, endpoint string) (*resty.Response, error) {
+	return c.send(req, method, endpoint, c.retryPolicy(endpoint), false)
+}
+
+// executeStream is like execute, but leaves the body of the response unread, for the caller to
+// read from resp.RawBody() and close.
+func (c *Client) executeStream(req *resty.Request, method, endpoint string) (*resty.Response, error) {
+	return c.send(req.SetDoNotParseResponse(true), method, endpoint, c.retryPolicy(endpoint), true)
+}
+
+// send sends the request, retrying it according to the policy.
+func (c *Client) send(req *resty.Request, method, endpoint string, policy RetryPolicy, stream bool) (resp *resty.Response, err error) {
+	ctx := req.Context()
+	if policy.Budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, policy.Budget)
+		req.SetContext(ctx)
+		defer func() {
+			// The budget also applies to reading a streamed body, until it is closed.
+			if stream && cancel != nil {
+				cancel = wrapBodyClose(resp, cancel)
+			}
+			if cancel != nil {
+				cancel()
+			}
+		}()
+	}
+	b := policy.newBackoff()
+	for attempt := 1; ; attempt++ {
+		ticket, allowErr := c.breaker.allow()
+		if allowErr != nil {
+			return nil, allowErr
+		}
+		resp, err = req.Execute(method, endpoint)
+		c.breaker.done(ticket, resp, err)
+		if attempt >= policy.MaxAttempts || ctx.Err() != nil || !policy.retryable(resp, err) {
+			return resp, err
+		}
+
+		delay := b.next()
+		if err == nil {
+			delay = max(delay, parseRetryAfter(resp.Header().Get("Retry-After"), time.Now()))
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return resp, err
+		}
+		if stream && resp != nil && resp.RawResponse != nil {
+			_ = resp.RawBody().Close()
+		}
+		c.log.Debug("retrying request", "method", method, "url", endpoint, "attempt", attempt, "delay", delay, "error", err)
+		if !sleep(ctx, delay) {
+			return resp, err
+		}
+	}
+}
+
+// wrapBodyClose makes closing the body of the response call cancel. It returns nil if it did,
+// or cancel if the response has no body.
+func wrapBodyClose(resp *resty.Response, cancel context.CancelFunc) context.CancelFunc {
+	if resp == nil || resp.RawResponse == nil || resp.RawResponse.Body == nil {
+		return cancel
+	}
+	resp.RawResponse.Body = &cancelOnCloseBody{ReadCloser: resp.RawResponse.Body, cancel: cancel}
+	return nil
+}
+
+// cancelOnCloseBody is a response body which calls cancel once closed.
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
@@ -2,6 +2,7 @@ package flagsmith
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -29,3 +30,14 @@ func TestBackoffReset(t *testing.T) {
 	b.reset()
 	assert.Equal(t, initialBackoff, b.current, "Reset should return to initial backoff")
 }
+
+func TestBackoffFollowsRetryPolicy(t *testing.T) {
+	// Given
+	b := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 3 * time.Second}.newBackoff()
+
+	// When
+	delays := []time.Duration{b.next(), b.next(), b.next()}
+
+	// Then
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}, delays)
+}
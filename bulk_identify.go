@@ -0,0 +1,214 @@
+package flagsmith
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"sync"
+)
+
+// DefaultBulkIdentifyConcurrency is the number of batches sent concurrently by BulkIdentifyAll,
+// unless set in BulkIdentifyOptions.
+const DefaultBulkIdentifyConcurrency = 4
+
+// BulkIdentifyOptions configures BulkIdentifyAll.
+type BulkIdentifyOptions struct {
+	// ChunkSize is the number of identities sent per request, at most and by default
+	// BulkIdentifyMaxCount.
+	ChunkSize int
+	// Concurrency is the maximum number of requests in flight, DefaultBulkIdentifyConcurrency
+	// by default.
+	Concurrency int
+	// RetryPolicy overrides the retry policy of the bulk-identities/ endpoint, if set.
+	RetryPolicy *RetryPolicy
+}
+
+// BulkIdentifyChunkResult is the result of sending a chunk of identities.
+type BulkIdentifyChunkResult struct {
+	// Index is the position of the chunk in the input, starting at zero.
+	Index int
+	// Size is the number of identities in the chunk.
+	Size int
+	// Err is the error the chunk failed with, or nil if it was sent.
+	Err error
+	// FailedIdentifiers holds the identifiers of the identities which were not sent.
+	FailedIdentifiers []string
+}
+
+// BulkIdentifyReport reports the result of BulkIdentifyAll.
+type BulkIdentifyReport struct {
+	// Chunks holds the result of every chunk sent, in input order.
+	Chunks []BulkIdentifyChunkResult
+	// Identities is the number of identities sent successfully.
+	Identities int
+	// FailedIdentities is the number of identities which were not sent.
+	FailedIdentities int
+}
+
+// Failed returns the results of the chunks which failed.
+func (r *BulkIdentifyReport) Failed() []BulkIdentifyChunkResult {
+	var failed []BulkIdentifyChunkResult
+	for _, chunk := range r.Chunks {
+		if chunk.Err != nil {
+			failed = append(failed, chunk)
+		}
+	}
+	return failed
+}
+
+// Err returns the errors of the chunks which failed, or nil if every chunk was sent.
+func (r *BulkIdentifyReport) Err() error {
+	var errs []error
+	for _, chunk := range r.Failed() {
+		errs = append(errs, fmt.Errorf("chunk %d: %w", chunk.Index, chunk.Err))
+	}
+	return errors.Join(errs...)
+}
+
+func (r *BulkIdentifyReport) add(result BulkIdentifyChunkResult) {
+	r.Chunks = append(r.Chunks, result)
+	if result.Err != nil {
+		r.FailedIdentities += result.Size
+	} else {
+		r.Identities += result.Size
+	}
+}
+
+// newBulkIdentifyChunkResult returns the result of the chunk at the given index, which failed
+// with err unless it is nil.
+func newBulkIdentifyChunkResult(index int, identities []*IdentityTraits, err error) BulkIdentifyChunkResult {
+	result := BulkIdentifyChunkResult{Index: index, Size: len(identities), Err: err}
+	if err != nil {
+		for _, identity := range identities {
+			result.FailedIdentifiers = append(result.FailedIdentifiers, identity.Identifier)
+		}
+	}
+	return result
+}
+
+// sort puts the chunks in input order.
+func (r *BulkIdentifyReport) sort() {
+	slices.SortFunc(r.Chunks, func(a, b BulkIdentifyChunkResult) int {
+		return a.Index - b.Index
+	})
+}
+
+// IdentitiesFromChannel returns a sequence of the identities received from ch until it is closed,
+// for use with BulkIdentifyAll.
+func IdentitiesFromChannel(ch <-chan *IdentityTraits) iter.Seq[*IdentityTraits] {
+	return func(yield func(*IdentityTraits) bool) {
+		for identity := range ch {
+			if !yield(identity) {
+				return
+			}
+		}
+	}
+}
+
+// BulkIdentifyAll creates or overwrites any number of identities, e.g. streamed from a database
+// export, by splitting them into chunks sent concurrently using BulkIdentify. The sequence is
+// consumed as chunks are sent, so that only the chunks in flight are held in memory. Use
+// slices.Values to send a slice, or IdentitiesFromChannel to send identities from a channel.
+//
+// The report holds the result of every chunk, including the identifiers of the identities
+// which failed. A chunk which could not be sent because ctx is done fails with ctx.Err(), and
+// no more identities are consumed from the sequence. The returned error joins the errors of the
+// chunks which failed, and ctx.Err() if sending stopped early because ctx is done.
+// NOTE: This method only works with Edge API endpoint.
+func (c *Client) BulkIdentifyAll(ctx context.Context, identities iter.Seq[*IdentityTraits], opts BulkIdentifyOptions) (*BulkIdentifyReport, error) {
+	report := &BulkIdentifyReport{}
+	if c.closed.Load() {
+		return report, ErrClientClosed
+	}
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 || chunkSize > BulkIdentifyMaxCount {
+		chunkSize = BulkIdentifyMaxCount
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBulkIdentifyConcurrency
+	}
+	policy := c.retryPolicy(c.config.baseURL + "bulk-identities/")
+	if opts.RetryPolicy != nil {
+		policy = *opts.RetryPolicy
+	}
+
+	type chunk struct {
+		index      int
+		identities []*IdentityTraits
+	}
+	chunks := make(chan chunk)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ch := range chunks {
+				err := c.bulkIdentify(ctx, ch.identities, policy)
+				if err != nil {
+					c.log.Warn("failed to bulk identify chunk", "chunk", ch.index, "size", len(ch.identities), "error", err)
+				}
+				mu.Lock()
+				report.add(newBulkIdentifyChunkResult(ch.index, ch.identities, err))
+				mu.Unlock()
+			}
+		}()
+	}
+
+	// fail reports a chunk which could not be sent because ctx is done.
+	index := 0
+	fail := func(identities []*IdentityTraits) {
+		mu.Lock()
+		report.add(newBulkIdentifyChunkResult(index, identities, ctx.Err()))
+		mu.Unlock()
+	}
+	// send hands the chunk to a worker, and reports false if ctx is done first, in which case
+	// the chunk is reported as failed.
+	send := func(identities []*IdentityTraits) bool {
+		select {
+		case chunks <- chunk{index: index, identities: identities}:
+			index++
+			return true
+		case <-ctx.Done():
+			fail(identities)
+			return false
+		}
+	}
+	stopped := false
+	batch := make([]*IdentityTraits, 0, chunkSize)
+	for identity := range identities {
+		if identity != nil {
+			batch = append(batch, identity)
+		}
+		// Stop consuming the sequence as soon as ctx is done, e.g. a channel which is never closed.
+		if ctx.Err() != nil {
+			stopped = true
+			break
+		}
+		if len(batch) == chunkSize {
+			if stopped = !send(batch); stopped {
+				batch = nil
+				break
+			}
+			batch = make([]*IdentityTraits, 0, chunkSize)
+		}
+	}
+	switch {
+	case stopped && len(batch) > 0:
+		fail(batch)
+	case len(batch) > 0:
+		stopped = !send(batch)
+	}
+	close(chunks)
+	wg.Wait()
+
+	report.sort()
+	err := report.Err()
+	if stopped {
+		err = errors.Join(err, ctx.Err())
+	}
+	return report, err
+}
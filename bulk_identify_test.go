@@ -0,0 +1,295 @@
+package flagsmith_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	flagsmith "github.com/Flagsmith/flagsmith-go-client/v5"
+	"github.com/Flagsmith/flagsmith-go-client/v5/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bulkIdentifyServer records the identifiers received by the bulk-identities endpoint, and
+// responds with the status returned by status for the batch, or 202 if it returns zero.
+func bulkIdentifyServer(t *testing.T, status func(identifiers []string) int) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/api/v1/bulk-identities/", req.URL.Path)
+		var body struct {
+			Data []flagsmith.IdentityTraits `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+		assert.LessOrEqual(t, len(body.Data), flagsmith.BulkIdentifyMaxCount)
+		var identifiers []string
+		for _, identity := range body.Data {
+			identifiers = append(identifiers, identity.Identifier)
+		}
+		if s := status(identifiers); s != 0 {
+			rw.WriteHeader(s)
+			return
+		}
+		mu.Lock()
+		received = append(received, identifiers...)
+		mu.Unlock()
+		rw.WriteHeader(http.StatusAccepted)
+	}))
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Sorted(slices.Values(received))
+	}
+}
+
+func identitiesToSend(n int) []*flagsmith.IdentityTraits {
+	identities := make([]*flagsmith.IdentityTraits, n)
+	for i := range identities {
+		identities[i] = &flagsmith.IdentityTraits{
+			Identifier: fmt.Sprintf("identity-%04d", i),
+			Traits:     []*flagsmith.Trait{{TraitKey: "index", TraitValue: i}},
+		}
+	}
+	return identities
+}
+
+func identifiersOf(identities []*flagsmith.IdentityTraits) []string {
+	var identifiers []string
+	for _, identity := range identities {
+		identifiers = append(identifiers, identity.Identifier)
+	}
+	return identifiers
+}
+
+func TestBulkIdentifyAllSendsChunksConcurrently(t *testing.T) {
+	// Given
+	var inFlight, maxInFlight atomic.Int32
+	server, received := bulkIdentifyServer(t, func([]string) int {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return 0
+	})
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"))
+	identities := identitiesToSend(1050)
+
+	// When
+	report, err := client.BulkIdentifyAll(context.Background(), slices.Values(identities),
+		flagsmith.BulkIdentifyOptions{Concurrency: 3})
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, identifiersOf(identities), received())
+	assert.Equal(t, 1050, report.Identities)
+	assert.Zero(t, report.FailedIdentities)
+	require.Len(t, report.Chunks, 11)
+	for i, chunk := range report.Chunks {
+		assert.Equal(t, i, chunk.Index)
+	}
+	assert.Equal(t, 50, report.Chunks[10].Size)
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(3))
+	assert.Greater(t, maxInFlight.Load(), int32(1))
+}
+
+func TestBulkIdentifyAllReportsFailedChunks(t *testing.T) {
+	// Given
+	server, received := bulkIdentifyServer(t, func(identifiers []string) int {
+		if slices.Contains(identifiers, "identity-0015") {
+			return http.StatusBadRequest
+		}
+		return 0
+	})
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"))
+	identities := identitiesToSend(40)
+
+	// When
+	report, err := client.BulkIdentifyAll(context.Background(), slices.Values(identities),
+		flagsmith.BulkIdentifyOptions{ChunkSize: 10})
+
+	// Then
+	require.Error(t, err)
+	var apiErr *flagsmith.FlagsmithAPIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.ResponseStatusCode)
+	failed := report.Failed()
+	require.Len(t, failed, 1)
+	assert.Equal(t, 1, failed[0].Index)
+	assert.Equal(t, identifiersOf(identities[10:20]), failed[0].FailedIdentifiers)
+	assert.Equal(t, 30, report.Identities)
+	assert.Equal(t, 10, report.FailedIdentities)
+	assert.Len(t, received(), 30)
+}
+
+func TestBulkIdentifyAllRetriesChunks(t *testing.T) {
+	// Given
+	var failures atomic.Int32
+	failures.Store(2)
+	server, received := bulkIdentifyServer(t, func([]string) int {
+		if failures.Add(-1) >= 0 {
+			return http.StatusServiceUnavailable
+		}
+		return 0
+	})
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"))
+	policy := flagsmith.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+
+	// When
+	report, err := client.BulkIdentifyAll(context.Background(), slices.Values(identitiesToSend(150)),
+		flagsmith.BulkIdentifyOptions{Concurrency: 1, RetryPolicy: &policy})
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, 150, report.Identities)
+	assert.Len(t, received(), 150)
+}
+
+func TestBulkIdentifyAllStreamsIdentitiesFromChannel(t *testing.T) {
+	// Given
+	server, received := bulkIdentifyServer(t, func([]string) int { return 0 })
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"))
+	identities := identitiesToSend(250)
+	ch := make(chan *flagsmith.IdentityTraits)
+	go func() {
+		defer close(ch)
+		for _, identity := range identities {
+			ch <- identity
+		}
+	}()
+
+	// When
+	report, err := client.BulkIdentifyAll(context.Background(), flagsmith.IdentitiesFromChannel(ch),
+		flagsmith.BulkIdentifyOptions{})
+
+	// Then
+	require.NoError(t, err)
+	assert.Len(t, report.Chunks, 3)
+	assert.Equal(t, identifiersOf(identities), received())
+}
+
+func TestBulkIdentifyAllStopsWhenContextIsDone(t *testing.T) {
+	// Given
+	server, _ := bulkIdentifyServer(t, func([]string) int { return 0 })
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"))
+	ctx, cancel := context.WithCancel(context.Background())
+	identities := func(yield func(*flagsmith.IdentityTraits) bool) {
+		for i := 0; ; i++ {
+			if i == 500 {
+				cancel()
+			}
+			if !yield(&flagsmith.IdentityTraits{Identifier: fmt.Sprint(i)}) {
+				return
+			}
+		}
+	}
+
+	// When
+	report, err := client.BulkIdentifyAll(ctx, identities, flagsmith.BulkIdentifyOptions{})
+
+	// Then
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.LessOrEqual(t, report.Identities, 500)
+}
+
+func TestBulkIdentifyAllReportsChunksNotSentWhenContextIsDone(t *testing.T) {
+	// Given
+	server, received := bulkIdentifyServer(t, func([]string) int { return 0 })
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"))
+	ctx, cancel := context.WithCancel(context.Background())
+	var yielded []string
+	identities := func(yield func(*flagsmith.IdentityTraits) bool) {
+		for i := 0; ; i++ {
+			if i == 50 {
+				cancel()
+			}
+			identifier := fmt.Sprint(i)
+			yielded = append(yielded, identifier)
+			if !yield(&flagsmith.IdentityTraits{Identifier: identifier}) {
+				return
+			}
+		}
+	}
+
+	// When
+	report, err := client.BulkIdentifyAll(ctx, identities, flagsmith.BulkIdentifyOptions{ChunkSize: 10, Concurrency: 1})
+
+	// Then: every identity consumed is either sent or reported as failed
+	assert.ErrorIs(t, err, context.Canceled)
+	failed := report.Failed()
+	require.NotEmpty(t, failed)
+	last := failed[len(failed)-1]
+	assert.ErrorIs(t, last.Err, context.Canceled)
+	assert.Equal(t, []string{"50"}, last.FailedIdentifiers)
+	var failedIdentifiers []string
+	for _, chunk := range failed {
+		failedIdentifiers = append(failedIdentifiers, chunk.FailedIdentifiers...)
+	}
+	assert.Equal(t, slices.Sorted(slices.Values(yielded)),
+		slices.Sorted(slices.Values(append(received(), failedIdentifiers...))))
+	assert.Equal(t, len(yielded), report.Identities+report.FailedIdentities)
+}
+
+func TestBulkIdentifyAllStopsConsumingChannelWhenContextIsDone(t *testing.T) {
+	// Given: a channel which is never closed
+	server, _ := bulkIdentifyServer(t, func([]string) int { return 0 })
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"))
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan *flagsmith.IdentityTraits)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case ch <- &flagsmith.IdentityTraits{Identifier: fmt.Sprint(i)}:
+			case <-time.After(time.Second):
+				return
+			}
+			if i == 3 {
+				cancel()
+			}
+		}
+	}()
+
+	// When
+	report, err := client.BulkIdentifyAll(ctx, flagsmith.IdentitiesFromChannel(ch),
+		flagsmith.BulkIdentifyOptions{ChunkSize: 100})
+
+	// Then: no more than one identity is consumed after ctx is done
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, report.Identities)
+	assert.LessOrEqual(t, report.FailedIdentities, 5)
+}
+
+func TestBulkIdentifyReturnsErrorOnNetworkFailure(t *testing.T) {
+	// Given
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}))
+	server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"))
+
+	// When
+	err := client.BulkIdentify(context.Background(), identitiesToSend(1))
+
+	// Then
+	var apiErr *flagsmith.FlagsmithAPIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.True(t, strings.HasPrefix(apiErr.Msg, "flagsmith: error performing request"))
+}
@@ -0,0 +1,176 @@
+package flagsmith
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default time for which responses are served from the cache configured using WithCache.
+const DefaultCacheTTL = 10 * time.Second
+
+// Cache stores responses of the Flagsmith API, so that remotely evaluated flags can be reused for
+// identical requests. Keys identify the environment, and for identity flags the identifier and a
+// hash of the traits. Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the entry stored for the key, and false if there is none.
+	Get(ctx context.Context, key string) (CacheEntry, bool, error)
+	// Set stores the entry for the key. The entry is no longer used once ttl has elapsed, and
+	// can then be evicted.
+	Set(ctx context.Context, key string, entry CacheEntry, ttl time.Duration) error
+}
+
+// CacheEntry is a response of the Flagsmith API stored in a Cache.
+type CacheEntry struct {
+	// Body is the response body.
+	Body []byte `json:"body"`
+	// StoredAt is the time the response was received.
+	StoredAt time.Time `json:"stored_at"`
+}
+
+// LRUCache is an in-memory Cache holding a maximum number of entries, which evicts the least
+// recently used entry when full.
+type LRUCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List
+}
+
+type lruCacheEntry struct {
+	key       string
+	entry     CacheEntry
+	expiresAt time.Time
+}
+
+// NewLRUCache creates an LRUCache holding at most maxEntries entries.
+func NewLRUCache(maxEntries int) *LRUCache {
+	return &LRUCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+func (c *LRUCache) Get(_ context.Context, key string) (CacheEntry, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return CacheEntry{}, false, nil
+	}
+	e := element.Value.(*lruCacheEntry)
+	if time.Now().After(e.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return CacheEntry{}, false, nil
+	}
+	c.order.MoveToFront(element)
+	return e.entry, true, nil
+}
+
+func (c *LRUCache) Set(_ context.Context, key string, entry CacheEntry, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expiresAt := time.Now().Add(ttl)
+	if element, ok := c.entries[key]; ok {
+		e := element.Value.(*lruCacheEntry)
+		e.entry = entry
+		e.expiresAt = expiresAt
+		c.order.MoveToFront(element)
+		return nil
+	}
+	c.entries[key] = c.order.PushFront(&lruCacheEntry{key: key, entry: entry, expiresAt: expiresAt})
+	for c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruCacheEntry).key)
+	}
+	return nil
+}
+
+// Len returns the number of entries in the cache, including expired entries not yet evicted.
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// environmentFlagsCacheKey returns the cache key of the environment flags. Keys include the base
+// URL, so that clients of different Flagsmith instances can share a cache.
+func environmentFlagsCacheKey(baseURL, environmentKey string) string {
+	return "flagsmith:flags:" + baseURL + ":" + environmentKey
+}
+
+// identityFlagsCacheKey returns the cache key of the identity flags, which depends on the
+// identifier and on the traits regardless of their order.
+func identityFlagsCacheKey(baseURL, environmentKey, identifier string, traits []*Trait) string {
+	sorted := slices.Clone(traits)
+	slices.SortStableFunc(sorted, func(a, b *Trait) int {
+		return strings.Compare(a.TraitKey, b.TraitKey)
+	})
+	hash := sha256.New()
+	_ = json.NewEncoder(hash).Encode(sorted)
+	return "flagsmith:identity:" + baseURL + ":" + environmentKey + ":" + identifier + ":" + hex.EncodeToString(hash.Sum(nil))
+}
+
+// cachedRequest returns the body of the response to a request, using the configured cache.
+// Fresh entries are returned without calling fetch. Entries within the stale-while-revalidate
+// window are returned while fetch updates the cache in the background, and entries within the
+// stale-if-error window are returned if fetch fails.
+func (c *Client) cachedRequest(ctx context.Context, key string, fetch func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	cache := c.config.cache
+	entry, found, err := cache.Get(ctx, key)
+	if err != nil {
+		c.log.Warn("failed to read from cache", "error", err)
+		found = false
+	}
+	age := time.Since(entry.StoredAt)
+	if found && age <= c.config.cacheTTL {
+		return entry.Body, nil
+	}
+	if found && age <= c.config.cacheTTL+c.config.staleWhileRevalidate {
+		c.revalidate(key, fetch)
+		return entry.Body, nil
+	}
+
+	body, err := c.fetchAndCache(ctx, key, fetch)
+	if err != nil && found && age <= c.config.cacheTTL+c.config.staleIfError {
+		c.log.Warn("serving stale response from cache", "error", err, "age", age)
+		return entry.Body, nil
+	}
+	return body, err
+}
+
+func (c *Client) fetchAndCache(ctx context.Context, key string, fetch func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	body, err := fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ttl := c.config.cacheTTL + max(c.config.staleWhileRevalidate, c.config.staleIfError)
+	if err := c.config.cache.Set(ctx, key, CacheEntry{Body: body, StoredAt: time.Now()}, ttl); err != nil {
+		c.log.Warn("failed to write to cache", "error", err)
+	}
+	return body, nil
+}
+
+// revalidate updates the cache entry in the background, unless it is already being updated.
+func (c *Client) revalidate(key string, fetch func(ctx context.Context) ([]byte, error)) {
+	if _, loaded := c.revalidating.LoadOrStore(key, struct{}{}); loaded {
+		return
+	}
+	go func() {
+		defer c.revalidating.Delete(key)
+		ctx, cancel := context.WithTimeout(c.ctxCache, c.config.timeout)
+		defer cancel()
+		if _, err := c.fetchAndCache(ctx, key, fetch); err != nil {
+			c.log.Warn("failed to revalidate cached response", "error", err)
+		}
+	}()
+}
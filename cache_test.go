@@ -0,0 +1,249 @@
+package flagsmith_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	flagsmith "github.com/Flagsmith/flagsmith-go-client/v5"
+	"github.com/Flagsmith/flagsmith-go-client/v5/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRUCacheEvictsLeastRecentlyUsedEntries(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	cache := flagsmith.NewLRUCache(2)
+	require.NoError(t, cache.Set(ctx, "a", flagsmith.CacheEntry{Body: []byte("a")}, time.Hour))
+	require.NoError(t, cache.Set(ctx, "b", flagsmith.CacheEntry{Body: []byte("b")}, time.Hour))
+	_, _, _ = cache.Get(ctx, "a")
+
+	// When
+	require.NoError(t, cache.Set(ctx, "c", flagsmith.CacheEntry{Body: []byte("c")}, time.Hour))
+
+	// Then
+	assert.Equal(t, 2, cache.Len())
+	_, found, _ := cache.Get(ctx, "b")
+	assert.False(t, found)
+	entry, found, _ := cache.Get(ctx, "a")
+	assert.True(t, found)
+	assert.Equal(t, []byte("a"), entry.Body)
+}
+
+func TestLRUCacheExpiresEntries(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	cache := flagsmith.NewLRUCache(10)
+	require.NoError(t, cache.Set(ctx, "a", flagsmith.CacheEntry{Body: []byte("a")}, time.Millisecond))
+
+	// When
+	time.Sleep(5 * time.Millisecond)
+	_, found, err := cache.Get(ctx, "a")
+
+	// Then
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.Equal(t, 0, cache.Len())
+}
+
+// identitiesServer serves the identity response with the value of feature 1 given by value,
+// failing while fail is set, and counts requests.
+func identitiesServer(t *testing.T, value *atomic.Value, fail *atomic.Bool, requests *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		if fail.Load() {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		_, err := io.WriteString(rw, strings.Replace(fixtures.IdentityResponseJson,
+			`"feature_state_value": "some_value"`, `"feature_state_value": "`+value.Load().(string)+`"`, 1))
+		assert.NoError(t, err)
+	}))
+}
+
+func getFeature1Value(t *testing.T, client *flagsmith.Client, identifier string, traits ...*flagsmith.Trait) any {
+	flags, err := client.GetIdentityFlags(context.Background(), identifier, traits)
+	require.NoError(t, err)
+	value, err := flags.GetFeatureValue(fixtures.Feature1Name)
+	require.NoError(t, err)
+	return value
+}
+
+func TestGetIdentityFlagsUsesCache(t *testing.T) {
+	// Given
+	var value atomic.Value
+	value.Store("v1")
+	var fail atomic.Bool
+	var requests atomic.Int32
+	server := identitiesServer(t, &value, &fail, &requests)
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithCache(flagsmith.NewLRUCache(100)), flagsmith.WithCacheTTL(time.Hour))
+	foo := &flagsmith.Trait{TraitKey: "foo", TraitValue: "bar", Transient: true}
+	baz := &flagsmith.Trait{TraitKey: "baz", TraitValue: 1, Transient: true}
+
+	// When
+	first := getFeature1Value(t, client, "identity", foo, baz)
+	value.Store("v2")
+	reordered := getFeature1Value(t, client, "identity", baz, foo)
+	otherTraits := getFeature1Value(t, client, "identity", foo)
+
+	// Then
+	assert.Equal(t, "v1", first)
+	assert.Equal(t, "v1", reordered)
+	assert.Equal(t, "v2", otherTraits)
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestGetIdentityFlagsDoesNotCacheTransientIdentities(t *testing.T) {
+	// Given
+	var value atomic.Value
+	value.Store("v1")
+	var fail atomic.Bool
+	var requests atomic.Int32
+	server := identitiesServer(t, &value, &fail, &requests)
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithCache(flagsmith.NewLRUCache(100)), flagsmith.WithCacheTTL(time.Hour))
+	transient := true
+	identifier := "identity"
+	ec := &flagsmith.EvaluationContext{Identity: &flagsmith.IdentityEvaluationContext{Identifier: &identifier, Transient: &transient}}
+
+	// When
+	for range 2 {
+		_, err := client.GetFlags(context.Background(), ec)
+		require.NoError(t, err)
+	}
+
+	// Then
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestGetIdentityFlagsSendsTraitWrites(t *testing.T) {
+	// Given
+	var value atomic.Value
+	value.Store("v1")
+	var fail atomic.Bool
+	var requests atomic.Int32
+	server := identitiesServer(t, &value, &fail, &requests)
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithCache(flagsmith.NewLRUCache(100)), flagsmith.WithCacheTTL(time.Hour))
+	plan := &flagsmith.Trait{TraitKey: "plan", TraitValue: "pro"}
+
+	// When
+	for range 2 {
+		getFeature1Value(t, client, "identity", plan)
+	}
+
+	// Then
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestCacheIsSharedPerBaseURL(t *testing.T) {
+	// Given: two Flagsmith instances serving different values, and a shared cache
+	var value, otherValue atomic.Value
+	value.Store("v1")
+	otherValue.Store("v2")
+	var fail atomic.Bool
+	var requests, otherRequests atomic.Int32
+	server := identitiesServer(t, &value, &fail, &requests)
+	defer server.Close()
+	otherServer := identitiesServer(t, &otherValue, &fail, &otherRequests)
+	defer otherServer.Close()
+	cache := flagsmith.NewLRUCache(100)
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithCache(cache), flagsmith.WithCacheTTL(time.Hour))
+	otherClient := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(otherServer.URL+"/api/v1/"),
+		flagsmith.WithCache(cache), flagsmith.WithCacheTTL(time.Hour))
+
+	// When
+	first := getFeature1Value(t, client, "identity")
+	other := getFeature1Value(t, otherClient, "identity")
+
+	// Then
+	assert.Equal(t, "v1", first)
+	assert.Equal(t, "v2", other)
+	assert.Equal(t, 2, cache.Len())
+}
+
+func TestCacheServesStaleResponseWhileRevalidating(t *testing.T) {
+	// Given
+	var value atomic.Value
+	value.Store("v1")
+	var fail atomic.Bool
+	var requests atomic.Int32
+	server := identitiesServer(t, &value, &fail, &requests)
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithCache(flagsmith.NewLRUCache(100)), flagsmith.WithCacheTTL(10*time.Millisecond),
+		flagsmith.WithStaleWhileRevalidate(time.Hour))
+	assert.Equal(t, "v1", getFeature1Value(t, client, "identity"))
+	value.Store("v2")
+	time.Sleep(20 * time.Millisecond)
+
+	// When
+	stale := getFeature1Value(t, client, "identity")
+
+	// Then
+	assert.Equal(t, "v1", stale)
+	assert.Eventually(t, func() bool {
+		return getFeature1Value(t, client, "identity") == "v2"
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestCacheServesStaleResponseOnError(t *testing.T) {
+	// Given
+	var value atomic.Value
+	value.Store("v1")
+	var fail atomic.Bool
+	var requests atomic.Int32
+	server := identitiesServer(t, &value, &fail, &requests)
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithCache(flagsmith.NewLRUCache(100)), flagsmith.WithCacheTTL(10*time.Millisecond),
+		flagsmith.WithStaleIfError(time.Hour))
+	assert.Equal(t, "v1", getFeature1Value(t, client, "identity"))
+	fail.Store(true)
+	time.Sleep(20 * time.Millisecond)
+
+	// When
+	stale := getFeature1Value(t, client, "identity")
+
+	// Then
+	assert.Equal(t, "v1", stale)
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestGetEnvironmentFlagsUsesCachePerEnvironment(t *testing.T) {
+	// Given
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		rw.Header().Set("Content-Type", "application/json")
+		_, err := io.WriteString(rw, fixtures.FlagsJson)
+		assert.NoError(t, err)
+	}))
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithCache(flagsmith.NewLRUCache(100)))
+	otherEnvironment := flagsmith.EvaluationContext{Environment: &flagsmith.EnvironmentEvaluationContext{APIKey: "other"}}
+
+	// When
+	for range 3 {
+		_, err := client.GetEnvironmentFlags(context.Background())
+		require.NoError(t, err)
+		_, err = client.GetFlags(context.Background(), &otherEnvironment)
+		require.NoError(t, err)
+	}
+
+	// Then
+	assert.Equal(t, int32(2), requests.Load())
+}
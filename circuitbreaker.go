@@ -0,0 +1,183 @@
+package flagsmith
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// CircuitState is the state of the circuit breaker configured using WithCircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets requests reach the Flagsmith API.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails requests immediately with ErrCircuitOpen.
+	CircuitOpen
+	// CircuitHalfOpen lets a limited number of probe requests through, to find out whether the
+	// Flagsmith API has recovered.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// circuitBreaker stops sending requests to the Flagsmith API after consecutive failures.
+// Once open for openDuration, it lets up to probes requests through, and closes again once they
+// all succeed. The methods of a nil circuitBreaker let every request through.
+type circuitBreaker struct {
+	failureThreshold int
+	openDuration     time.Duration
+	probes           int
+	log              *slog.Logger
+
+	mu    sync.Mutex
+	state CircuitState
+	// generation changes with every state change, so that the outcomes of requests allowed in
+	// an earlier state are ignored.
+	generation     uint64
+	failures       int
+	openedAt       time.Time
+	probesInFlight int
+	probeSuccesses int
+}
+
+// circuitTicket identifies a request allowed by the circuit breaker, and is passed back to done.
+type circuitTicket struct {
+	generation uint64
+	// probe is set for the requests let through while the circuit is half-open.
+	probe bool
+}
+
+func newCircuitBreaker(failureThreshold int, openDuration time.Duration, probes int, log *slog.Logger) *circuitBreaker {
+	return &circuitBreaker{
+		failureThreshold: failureThreshold,
+		openDuration:     openDuration,
+		probes:           max(probes, 1),
+		log:              log,
+	}
+}
+
+func (b *circuitBreaker) currentState() CircuitState {
+	if b == nil {
+		return CircuitClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitOpen && time.Since(b.openedAt) >= b.openDuration {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+// allow returns ErrCircuitOpen if a request must not be sent. Otherwise, the outcome of the
+// request must be reported by passing the returned ticket to done.
+func (b *circuitBreaker) allow() (circuitTicket, error) {
+	if b == nil {
+		return circuitTicket{}, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitOpen {
+		if time.Since(b.openedAt) < b.openDuration {
+			return circuitTicket{}, ErrCircuitOpen
+		}
+		b.setState(CircuitHalfOpen)
+		b.probesInFlight = 0
+		b.probeSuccesses = 0
+	}
+	ticket := circuitTicket{generation: b.generation}
+	if b.state == CircuitHalfOpen {
+		if b.probesInFlight >= b.probes {
+			return circuitTicket{}, ErrCircuitOpen
+		}
+		b.probesInFlight++
+		ticket.probe = true
+	}
+	return ticket, nil
+}
+
+// done records the outcome of an allowed request. Requests cancelled by the caller, and requests
+// allowed before the last state change, are ignored.
+func (b *circuitBreaker) done(ticket circuitTicket, resp *resty.Response, err error) {
+	if b == nil {
+		return
+	}
+	cancelled := errors.Is(err, context.Canceled)
+	failed := err != nil || resp.StatusCode() >= http.StatusInternalServerError || resp.StatusCode() == http.StatusTooManyRequests
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ticket.generation != b.generation {
+		return
+	}
+	if !ticket.probe {
+		if cancelled {
+			return
+		}
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.failureThreshold {
+			b.open()
+		}
+		return
+	}
+	b.probesInFlight--
+	if cancelled {
+		return
+	}
+	if failed {
+		b.open()
+		return
+	}
+	b.probeSuccesses++
+	if b.probeSuccesses >= b.probes {
+		b.failures = 0
+		b.setState(CircuitClosed)
+	}
+}
+
+func (b *circuitBreaker) open() {
+	b.openedAt = time.Now()
+	b.setState(CircuitOpen)
+}
+
+func (b *circuitBreaker) setState(state CircuitState) {
+	if b.state != state {
+		b.log.Warn("circuit breaker state changed", "from", b.state, "to", state)
+		b.state = state
+		b.generation++
+	}
+}
+
+// newCircuitBreaker returns the configured circuit breaker, or nil if there is none.
+func (c *Client) newCircuitBreaker() *circuitBreaker {
+	if c.config.circuitFailureThreshold <= 0 {
+		return nil
+	}
+	return newCircuitBreaker(c.config.circuitFailureThreshold, c.config.circuitOpenDuration,
+		c.config.circuitProbes, c.log.With(slog.String("worker", "circuit_breaker")))
+}
+
+// CircuitState returns the state of the circuit breaker configured using WithCircuitBreaker,
+// or CircuitClosed if there is none.
+func (c *Client) CircuitState() CircuitState {
+	return c.breaker.currentState()
+}
@@ -0,0 +1,198 @@
+package flagsmith_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	flagsmith "github.com/Flagsmith/flagsmith-go-client/v5"
+	"github.com/Flagsmith/flagsmith-go-client/v5/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyServer responds with the given status while it is non-zero, and with the flags otherwise.
+func flakyServer(t *testing.T, status *atomic.Int32, requests *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		if s := status.Load(); s != 0 {
+			rw.WriteHeader(int(s))
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		body := fixtures.FlagsJson
+		if req.URL.Path == "/api/v1/environment-document/" {
+			body = fixtures.EnvironmentJson
+		}
+		_, err := io.WriteString(rw, body)
+		assert.NoError(t, err)
+	}))
+}
+
+func TestCircuitBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	var status, requests atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	server := flakyServer(t, &status, &requests)
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithCircuitBreaker(3, time.Hour),
+		flagsmith.WithDefaultHandler(func(featureName string) (flagsmith.Flag, error) {
+			return flagsmith.Flag{IsDefault: true}, nil
+		}))
+
+	// When
+	for range 5 {
+		flags, err := client.GetEnvironmentFlags(ctx)
+		require.NoError(t, err)
+		flag, err := flags.GetFlag(fixtures.Feature1Name)
+		require.NoError(t, err)
+		assert.True(t, flag.IsDefault)
+	}
+
+	// Then
+	assert.Equal(t, int32(3), requests.Load())
+	assert.Equal(t, flagsmith.CircuitOpen, client.CircuitState())
+	_, err := client.GetEnvironmentFlagsFromAPI(ctx)
+	assert.ErrorIs(t, err, flagsmith.ErrCircuitOpen)
+	assert.ErrorIs(t, client.UpdateEnvironment(ctx), flagsmith.ErrCircuitOpen)
+	assert.Equal(t, int32(3), requests.Load())
+}
+
+func TestCircuitBreakerClosesAfterSuccessfulProbe(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	var status, requests atomic.Int32
+	status.Store(http.StatusInternalServerError)
+	server := flakyServer(t, &status, &requests)
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithCircuitBreaker(1, 20*time.Millisecond))
+	assert.Error(t, client.UpdateEnvironment(ctx))
+	require.Equal(t, flagsmith.CircuitOpen, client.CircuitState())
+	status.Store(0)
+
+	// When
+	time.Sleep(30 * time.Millisecond)
+	state := client.CircuitState()
+	err := client.UpdateEnvironment(ctx)
+
+	// Then
+	assert.Equal(t, flagsmith.CircuitHalfOpen, state)
+	assert.NoError(t, err)
+	assert.Equal(t, flagsmith.CircuitClosed, client.CircuitState())
+}
+
+func TestCircuitBreakerReopensAfterFailedProbe(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	var status, requests atomic.Int32
+	status.Store(http.StatusTooManyRequests)
+	server := flakyServer(t, &status, &requests)
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithCircuitBreaker(1, 20*time.Millisecond))
+	_, err := client.GetEnvironmentFlagsFromAPI(ctx)
+	assert.Error(t, err)
+
+	// When
+	time.Sleep(30 * time.Millisecond)
+	_, probeErr := client.GetEnvironmentFlagsFromAPI(ctx)
+	_, err = client.GetEnvironmentFlagsFromAPI(ctx)
+
+	// Then
+	assert.NotErrorIs(t, probeErr, flagsmith.ErrCircuitOpen)
+	assert.ErrorIs(t, err, flagsmith.ErrCircuitOpen)
+	assert.Equal(t, flagsmith.CircuitOpen, client.CircuitState())
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestCircuitBreakerIgnoresClientErrors(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	var status, requests atomic.Int32
+	status.Store(http.StatusBadRequest)
+	server := flakyServer(t, &status, &requests)
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithCircuitBreaker(1, time.Hour))
+
+	// When
+	_, err := client.GetIdentityFlags(ctx, "identity", nil)
+
+	// Then
+	assert.Error(t, err)
+	assert.Equal(t, flagsmith.CircuitClosed, client.CircuitState())
+}
+
+func TestCircuitBreakerIgnoresRequestsAllowedBeforeOpening(t *testing.T) {
+	// Given: identity requests which wait for release, or for releaseProbe if they are probes,
+	// and an environment document which fails
+	ctx := context.Background()
+	var inFlight sync.WaitGroup
+	release, releaseProbe := make(chan struct{}), make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v1/identities/" {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, err := io.ReadAll(req.Body)
+		assert.NoError(t, err)
+		inFlight.Done()
+		if strings.Contains(string(body), "probe") {
+			<-releaseProbe
+		} else {
+			<-release
+		}
+		_, err = io.WriteString(rw, fixtures.IdentityResponseJson)
+		assert.NoError(t, err)
+	}))
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithCircuitBreaker(1, 20*time.Millisecond),
+		flagsmith.WithCircuitBreakerProbes(2))
+
+	var identities, probes sync.WaitGroup
+	send := func(wg *sync.WaitGroup, identifier string) {
+		inFlight.Add(1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.GetIdentityFlags(ctx, identifier, nil)
+			assert.NoError(t, err)
+		}()
+		inFlight.Wait()
+	}
+	for i := range 3 {
+		send(&identities, fmt.Sprintf("identity_%d", i))
+	}
+	assert.Error(t, client.UpdateEnvironment(ctx))
+	require.Equal(t, flagsmith.CircuitOpen, client.CircuitState())
+	time.Sleep(30 * time.Millisecond)
+	send(&probes, "probe_1")
+
+	// When: the requests allowed before the circuit opened succeed
+	close(release)
+	identities.Wait()
+
+	// Then: they neither close the circuit nor free probe slots
+	assert.Equal(t, flagsmith.CircuitHalfOpen, client.CircuitState())
+	send(&probes, "probe_2")
+	_, err := client.GetIdentityFlags(ctx, "probe_3", nil)
+	assert.ErrorIs(t, err, flagsmith.ErrCircuitOpen)
+
+	// When: the probes succeed
+	close(releaseProbe)
+	probes.Wait()
+
+	// Then
+	assert.Equal(t, flagsmith.CircuitClosed, client.CircuitState())
+}
@@ -2,13 +2,13 @@ package flagsmith
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
-	"net/url"
-	"reflect"
-	"runtime"
+	"slices"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -30,18 +30,54 @@ type Client struct {
 
 	environment             atomic.Value
 	engineEvaluationContext atomic.Value
+	// offlineEngineEvaluationContext holds the offline handler's environment when it is used
+	// as a fallback for local evaluation.
+	offlineEngineEvaluationContext atomic.Value
 
 	analyticsProcessor *AnalyticsProcessor
 	realtime           *realtime
+	// realtimeDispatcher applies real-time updates on behalf of the clients of a MultiClient.
+	realtimeDispatcher *realtimeDispatcher
 	defaultFlagHandler func(string) (Flag, error)
 
 	client         *resty.Client
 	httpClient     *http.Client
 	ctxLocalEval   context.Context
 	ctxAnalytics   context.Context
+	ctxCache       context.Context
+	cancelFuncs    []context.CancelFunc
+	closed         atomic.Bool
 	log            *slog.Logger
 	offlineHandler OfflineHandler
-	errorHandler   func(handler *FlagsmithAPIError)
+	// unwatchOfflineHandler stops reloads of a watching offline handler from reaching the Client.
+	unwatchOfflineHandler func()
+	errorHandler          func(handler *FlagsmithAPIError)
+	breaker               *circuitBreaker
+	traitWriter           *traitWriter
+
+	// offlineMu serialises installs of the offline handler's environment.
+	offlineMu sync.Mutex
+
+	// documentVersion identifies the last fetched environment document, so that unchanged
+	// documents are neither downloaded nor mapped again.
+	documentVersion atomic.Pointer[documentVersion]
+	// pendingDocument holds the pages fetched by an update which failed, to resume from.
+	pendingDocument atomic.Pointer[documentFetch]
+	// environmentUpdatedAt is the time, in Unix nanoseconds, of the last successful update of
+	// the environment, after which it falls back to the offline handler's environment.
+	environmentUpdatedAt atomic.Int64
+	// servingOffline is set while the offline handler's environment replaces a stale one.
+	servingOffline atomic.Bool
+
+	// Concurrent identical requests to the Flagsmith API share a single request.
+	requests           flightGroup[[]byte]
+	environmentUpdates flightGroup[struct{}]
+	// revalidating holds the keys of the cache entries being updated in the background.
+	revalidating sync.Map
+
+	// initialised is closed once the first attempt to fetch the environment has completed.
+	initialised     chan struct{}
+	initialisedOnce sync.Once
 }
 
 // Returns context with provided EvaluationContext instance set.
@@ -55,70 +91,117 @@ func GetEvaluationContextFromCtx(ctx context.Context) (ec EvaluationContext, ok
 	return ec, ok
 }
 
-func getOptionQualifiedName(opt Option) string {
-	return runtime.FuncForPC(reflect.ValueOf(opt).Pointer()).Name()
+// NewClient creates instance of Client with given configuration.
+// It panics if the configuration is invalid; use New to handle configuration errors.
+func NewClient(apiKey string, options ...Option) *Client {
+	c, err := New(apiKey, options...)
+	if err != nil {
+		panic(err)
+	}
+	return c
 }
 
-func isClientOption(name string) bool {
-	return strings.Contains(name, OptionWithHTTPClient) || strings.Contains(name, OptionWithRestyClient)
+// New creates a Client with the given configuration. The configuration is validated after all
+// options are applied, so that options can be given in any order. Invalid configurations are
+// reported as *ConfigError values, joined using errors.Join if there are several.
+func New(apiKey string, options ...Option) (*Client, error) {
+	c := newConfiguredClient(apiKey, options)
+	if err := errors.Join(c.validateConfig(), c.validateAPIKey()); err != nil {
+		return nil, err
+	}
+	c.ctxLocalEval = c.cancelOnClose(c.ctxLocalEval)
+	c.ctxAnalytics = c.cancelOnClose(c.ctxAnalytics)
+	c.ctxCache = c.cancelOnClose(nil)
+	c.client = c.newRestyClient()
+	c.breaker = c.newCircuitBreaker()
+	if c.config.enableAnalytics {
+		c.analyticsProcessor = c.newAnalyticsProcessor()
+	}
+	if c.config.localEvaluation && !c.config.offlineMode {
+		c.traitWriter = c.newTraitWriter()
+		go c.traitWriter.start(c.cancelOnClose(nil), c.config.traitFlushInterval)
+	}
+	c.start()
+	return c, nil
 }
 
-// NewClient creates instance of Client with given configuration.
-func NewClient(apiKey string, options ...Option) *Client {
+// newConfiguredClient creates a Client with the given options applied, without validating them.
+func newConfiguredClient(apiKey string, options []Option) *Client {
 	c := &Client{
-		apiKey: apiKey,
-		config: defaultConfig(),
+		apiKey:      apiKey,
+		config:      defaultConfig(),
+		log:         createLogger(),
+		initialised: make(chan struct{}),
 	}
-
-	customClientCount := 0
 	for _, opt := range options {
-		name := getOptionQualifiedName(opt)
-		if isClientOption(name) {
-			customClientCount = customClientCount + 1
-			if customClientCount > 1 {
-				panic("Only one client option can be provided")
-			}
-			opt(c)
-		}
+		opt(c)
 	}
+	return c
+}
 
-	// If a resty custom client has been provided, client is already set - otherwise we use a custom http client or default to a resty
-	if c.client == nil {
-		if c.httpClient != nil {
-			c.client = resty.NewWithClient(c.httpClient)
-			c.config.userProvidedClient = true
-		} else {
-			c.client = resty.New()
-		}
-	} else {
+// newRestyClient returns the configured HTTP client. The environment key header is only set
+// on the client if the Client has an environment key, and is otherwise sent with each request.
+func (c *Client) newRestyClient() *resty.Client {
+	// A custom resty client takes precedence; otherwise we use a custom http client or default to a resty
+	var client *resty.Client
+	switch {
+	case c.client != nil:
+		client = c.client
+		c.config.userProvidedClient = true
+	case c.httpClient != nil:
+		client = resty.NewWithClient(c.httpClient)
 		c.config.userProvidedClient = true
+	default:
+		client = resty.New()
 	}
 
-	c.client.SetHeaders(map[string]string{
-		"Accept":             "application/json",
-		"User-Agent":         getUserAgent(),
-		EnvironmentKeyHeader: c.apiKey,
+	client.SetHeaders(map[string]string{
+		"Accept":     "application/json",
+		"User-Agent": getUserAgent(),
 	})
-
-	if c.client.GetClient().Timeout == 0 {
-		c.client.SetTimeout(c.config.timeout)
+	if c.apiKey != "" {
+		client.SetHeader(EnvironmentKeyHeader, c.apiKey)
 	}
 
-	c.log = createLogger()
-
-	for _, opt := range options {
-		name := getOptionQualifiedName(opt)
-		if isClientOption(name) {
-			continue
+	if client.GetClient().Timeout == 0 || !c.config.userProvidedClient {
+		client.SetTimeout(c.config.timeout)
+	}
+	if c.config.requestTimeout != 0 && !c.config.userProvidedClient {
+		client.SetTimeout(c.config.requestTimeout)
+	}
+	if c.config.userProvidedClient && client.RetryCount > 0 && c.config.retryPolicy.MaxAttempts > 1 {
+		c.log.Warn("the custom resty client retries every attempt of the retry policy, multiplying the number of requests",
+			"resty_retry_count", client.RetryCount, "max_attempts", c.config.retryPolicy.MaxAttempts)
+	}
+	if !c.config.userProvidedClient {
+		client.SetHeaders(c.config.customHeaders)
+		if c.config.proxyURL != "" {
+			client.SetProxy(c.config.proxyURL)
 		}
-		opt(c)
 	}
 
-	c.client = c.client.
+	return client.
 		SetLogger(newSlogToRestyAdapter(c.log)).
 		OnBeforeRequest(newRestyLogRequestMiddleware(c.log)).
 		OnAfterResponse(newRestyLogResponseMiddleware(c.log))
+}
 
+func (c *Client) newAnalyticsProcessor() *AnalyticsProcessor {
+	return newAnalyticsProcessor(
+		c.ctxAnalytics,
+		c.client,
+		c.config.baseURL,
+		nil,
+		newSlogToLoggerAdapter(
+			c.log.With(slog.String("worker", "analytics")),
+		),
+		c.execute,
+	)
+}
+
+// start loads the offline environment, and starts the goroutines updating the environment
+// in local evaluation mode.
+func (c *Client) start() {
 	c.log.Info("initialising Flagsmith client",
 		"base_url", c.config.baseURL,
 		"local_evaluation", c.config.localEvaluation,
@@ -130,25 +213,17 @@ func NewClient(apiKey string, options ...Option) *Client {
 		"timeout", c.config.timeout,
 	)
 
-	if c.config.offlineMode && c.offlineHandler == nil {
-		panic("offline handler must be provided to use offline mode.")
-	}
-	if c.defaultFlagHandler != nil && c.offlineHandler != nil {
-		panic("default flag handler and offline handler cannot be used together.")
-	}
-	if c.config.localEvaluation && c.offlineHandler != nil {
-		panic("local evaluation and offline handler cannot be used together.")
-	}
 	if c.offlineHandler != nil {
-		env := c.offlineHandler.GetEnvironment()
-		c.environment.Store(env)
-		engineEvalCtx := engine_eval.MapEnvironmentDocumentToEvaluationContext(env)
-		c.engineEvaluationContext.Store(&engineEvalCtx)
+		// Watch before reading the environment, so that no document reloaded in between is missed.
+		if watcher, ok := c.offlineHandler.(EnvironmentWatcher); ok {
+			c.unwatchOfflineHandler = watcher.Watch(c.onOfflineEnvironmentReload)
+		}
+		c.setOfflineEnvironment()
 	}
 
 	if c.config.localEvaluation {
-		if !strings.HasPrefix(apiKey, "ser.") {
-			panic("In order to use local evaluation, please generate a server key in the environment settings page.")
+		if c.config.snapshotStore != nil {
+			c.loadSnapshot(c.ctxLocalEval)
 		}
 		if c.config.polling || !c.config.useRealtime {
 			// Poll indefinitely
@@ -159,19 +234,80 @@ func NewClient(apiKey string, options ...Option) *Client {
 			go c.pollThenStartRealtime(c.ctxLocalEval)
 		}
 	}
-	// Initialise analytics processor
-	if c.config.enableAnalytics {
-		c.analyticsProcessor = NewAnalyticsProcessor(
-			c.ctxAnalytics,
-			c.client,
-			c.config.baseURL,
-			nil,
-			newSlogToLoggerAdapter(
-				c.log.With(slog.String("worker", "analytics")),
-			),
-		)
+}
+
+// newRequest creates a request to the Flagsmith API on behalf of the Client's environment.
+func (c *Client) newRequest(ctx context.Context) *resty.Request {
+	return c.client.NewRequest().
+		SetContext(ctx).
+		SetHeader(EnvironmentKeyHeader, c.apiKey).
+		ForceContentType("application/json")
+}
+
+// markInitialised records that the first attempt to fetch the environment has completed.
+func (c *Client) markInitialised() {
+	c.initialisedOnce.Do(func() { close(c.initialised) })
+}
+
+// cancelOnClose derives a context from ctx, or context.Background if nil, which is cancelled by Close.
+func (c *Client) cancelOnClose(ctx context.Context) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
 	}
-	return c
+	ctx, cancel := context.WithCancel(ctx)
+	c.cancelFuncs = append(c.cancelFuncs, cancel)
+	return ctx
+}
+
+// Close stops the background goroutines updating the environment and uploading analytics, and
+// flushes any pending analytics data and trait writes. Methods called after Close return
+// ErrClientClosed. Closing a closed client has no effect.
+func (c *Client) Close() error {
+	if !c.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.timeout)
+	defer cancel()
+	var errs []error
+	if c.traitWriter != nil {
+		errs = append(errs, c.traitWriter.flush(ctx))
+	}
+	for _, cancel := range c.cancelFuncs {
+		cancel()
+	}
+	if c.unwatchOfflineHandler != nil {
+		c.unwatchOfflineHandler()
+	}
+	if c.analyticsProcessor != nil && c.config.enableAnalytics {
+		errs = append(errs, c.analyticsProcessor.Flush(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// validateConfig reports every invalid combination of options.
+func (c *Client) validateConfig() error {
+	var errs []error
+	if len(c.config.customClients) > 1 {
+		errs = append(errs, &ConfigError{Options: c.config.customClients, Err: ErrMultipleCustomClients})
+	}
+	if len(c.config.customClients) > 0 && len(c.config.clientSettings) > 0 {
+		errs = append(errs, &ConfigError{Options: c.config.clientSettings, Err: ErrCustomClientOption})
+	}
+	if c.config.offlineMode && c.offlineHandler == nil {
+		errs = append(errs, &ConfigError{Options: []string{"WithOfflineMode"}, Err: ErrOfflineHandlerRequired})
+	}
+	if c.defaultFlagHandler != nil && c.offlineHandler != nil {
+		errs = append(errs, &ConfigError{Options: []string{"WithDefaultHandler", "WithOfflineHandler"}, Err: ErrDefaultAndOfflineHandler})
+	}
+	return errors.Join(errs...)
+}
+
+// validateAPIKey reports whether the environment key can be used with the configured evaluation mode.
+func (c *Client) validateAPIKey() error {
+	if c.config.localEvaluation && !strings.HasPrefix(c.apiKey, "ser.") {
+		return &ConfigError{Options: []string{"WithLocalEvaluation"}, Err: ErrServerKeyRequired}
+	}
+	return nil
 }
 
 // GetFlags evaluates the feature flags within an EvaluationContext.
@@ -194,6 +330,9 @@ func (c *Client) GetFlags(ctx context.Context, ec *EvaluationContext) (f Flags,
 // GetEnvironmentFlags calls GetFlags using the current environment as the EvaluationContext.
 // Equivalent to GetFlags(ctx, nil).
 func (c *Client) GetEnvironmentFlags(ctx context.Context) (f Flags, err error) {
+	if c.closed.Load() {
+		return Flags{}, ErrClientClosed
+	}
 	if c.config.localEvaluation || c.config.offlineMode {
 		if f, err = c.getEnvironmentFlagsFromEnvironment(); err == nil {
 			return f, nil
@@ -208,13 +347,16 @@ func (c *Client) GetEnvironmentFlags(ctx context.Context) (f Flags, err error) {
 	} else if c.defaultFlagHandler != nil {
 		return Flags{defaultFlagHandler: c.defaultFlagHandler}, nil
 	}
-	return Flags{}, &FlagsmithClientError{msg: fmt.Sprintf("Failed to fetch flags with error: %s", err)}
+	return Flags{}, &FlagsmithClientError{msg: fmt.Sprintf("Failed to fetch flags with error: %s", err), Err: err}
 }
 
 // GetIdentityFlags calls GetFlags using this identifier and traits as the EvaluationContext.
 func (c *Client) GetIdentityFlags(ctx context.Context, identifier string, traits []*Trait) (f Flags, err error) {
+	if c.closed.Load() {
+		return Flags{}, ErrClientClosed
+	}
 	if c.config.localEvaluation || c.config.offlineMode {
-		if f, err = c.getIdentityFlagsFromEnvironment(identifier, traits); err == nil {
+		if f, err = c.getIdentityFlagsFromEnvironment(ctx, identifier, traits); err == nil {
 			return f, nil
 		}
 	} else {
@@ -223,51 +365,74 @@ func (c *Client) GetIdentityFlags(ctx context.Context, identifier string, traits
 		}
 	}
 	if c.offlineHandler != nil {
-		return c.getIdentityFlagsFromEnvironment(identifier, traits)
+		return c.getIdentityFlagsFromEnvironment(ctx, identifier, traits)
 	} else if c.defaultFlagHandler != nil {
 		return Flags{defaultFlagHandler: c.defaultFlagHandler}, nil
 	}
-	return Flags{}, &FlagsmithClientError{msg: fmt.Sprintf("Failed to fetch flags with error: %s", err)}
+	return Flags{}, &FlagsmithClientError{msg: fmt.Sprintf("Failed to fetch flags with error: %s", err), Err: err}
 }
 
 // Returns an array of segments that the given identity is part of.
 func (c *Client) GetIdentitySegments(identifier string, traits []*Trait) ([]*segments.SegmentModel, error) {
-	if evalCtx, ok := c.engineEvaluationContext.Load().(*engine_eval.EngineEvaluationContext); ok {
+	if c.closed.Load() {
+		return nil, ErrClientClosed
+	}
+	if evalCtx, ok := c.loadEngineEvaluationContext(); ok {
 		engineEvalCtx := engine_eval.MapContextAndIdentityDataToContext(*evalCtx, identifier, traits)
-		result := flagengine.GetEvaluationResult(&engineEvalCtx)
+		result := flagengine.GetEvaluationResult(&engineEvalCtx, c.evaluationOptions()...)
 		return engine_eval.MapEvaluationResultSegmentsToSegmentModels(&result), nil
 	}
-	return nil, &FlagsmithClientError{msg: "flagsmith: Local evaluation required to obtain identity segments"}
+	return nil, &FlagsmithClientError{msg: "flagsmith: Local evaluation required to obtain identity segments", Err: ErrLocalEvaluationRequired}
+}
+
+// GetBucket returns the percentage bucket, between 0 and 100, which the identity is assigned to
+// for the given feature or segment, using the configured bucketing strategy.
+// Multivariate features are keyed by their feature state ID, or the feature state UUID for
+// identity overrides, and percentage split segments by their segment ID.
+// An identity receives a multivariate variant, or matches a percentage split condition,
+// depending on whether its bucket falls within the configured allocation.
+//
+// GetBucket requires the environment to be loaded in local evaluation or offline mode,
+// and returns -1 otherwise.
+func (c *Client) GetBucket(identifier string, featureOrSegmentKey string) float64 {
+	evalCtx, ok := c.loadEngineEvaluationContext()
+	if !ok {
+		return -1
+	}
+	identityKey := fmt.Sprintf("%s_%s", evalCtx.Environment.Key, identifier)
+	o := engine_eval.NewEvaluationOptions(c.evaluationOptions()...)
+	return o.HashedPercentage([]string{featureOrSegmentKey, identityKey})
 }
 
 // BulkIdentify can be used to create/overwrite identities(with traits) in bulk
 // NOTE: This method only works with Edge API endpoint.
 func (c *Client) BulkIdentify(ctx context.Context, batch []*IdentityTraits) error {
+	if c.closed.Load() {
+		return ErrClientClosed
+	}
 	if len(batch) > BulkIdentifyMaxCount {
 		msg := fmt.Sprintf("flagsmith: batch size must be less than %d", BulkIdentifyMaxCount)
-		return &FlagsmithAPIError{Msg: msg}
+		return &FlagsmithAPIError{Msg: msg, Err: ErrBatchTooLarge}
 	}
 
+	return c.bulkIdentify(ctx, batch, c.retryPolicy(c.config.baseURL+"bulk-identities/"))
+}
+
+// bulkIdentify sends a batch of identities, retrying according to the policy.
+func (c *Client) bulkIdentify(ctx context.Context, batch []*IdentityTraits, policy RetryPolicy) error {
 	body := struct {
 		Data []*IdentityTraits `json:"data"`
 	}{Data: batch}
 
-	resp, err := c.client.NewRequest().
-		SetBody(&body).
-		SetContext(ctx).
-		ForceContentType("application/json").
-		Post(c.config.baseURL + "bulk-identities/")
-	if resp.StatusCode() == 404 {
-		msg := "flagsmith: Bulk identify endpoint not found; Please make sure you are using Edge API endpoint"
-		return &FlagsmithAPIError{Msg: msg, Err: err, ResponseStatusCode: resp.StatusCode(), ResponseStatus: resp.Status()}
-	}
-	if err != nil {
-		msg := fmt.Sprintf("flagsmith: error performing request to Flagsmith API: %s", err)
-		return &FlagsmithAPIError{Msg: msg, Err: err, ResponseStatusCode: resp.StatusCode(), ResponseStatus: resp.Status()}
+	endpoint := c.config.baseURL + "bulk-identities/"
+	resp, err := c.send(c.newRequest(ctx).SetBody(&body), http.MethodPost, endpoint, policy, false)
+	if err == nil && resp.StatusCode() == 404 {
+		apiErr := newAPIError(http.MethodPost, endpoint, resp, err)
+		apiErr.Msg = "flagsmith: Bulk identify endpoint not found; Please make sure you are using Edge API endpoint"
+		return apiErr
 	}
-	if !resp.IsSuccess() {
-		msg := fmt.Sprintf("flagsmith: unexpected response from Flagsmith API: %s", resp.Status())
-		return &FlagsmithAPIError{Msg: msg, Err: err, ResponseStatusCode: resp.StatusCode(), ResponseStatus: resp.Status()}
+	if err != nil || !resp.IsSuccess() {
+		return newAPIError(http.MethodPost, endpoint, resp, err)
 	}
 	return nil
 }
@@ -275,43 +440,59 @@ func (c *Client) BulkIdentify(ctx context.Context, batch []*IdentityTraits) erro
 // GetEnvironmentFlagsFromAPI tries to contact the Flagsmith API to get the latest environment data.
 // Will return an error in case of failure or unexpected response.
 func (c *Client) GetEnvironmentFlagsFromAPI(ctx context.Context) (Flags, error) {
-	req := c.client.NewRequest()
-	ec, ok := GetEvaluationContextFromCtx(ctx)
-	if ok {
-		envCtx := ec.Environment
-		if envCtx != nil {
-			req.SetHeader(EnvironmentKeyHeader, envCtx.APIKey)
+	if c.closed.Load() {
+		return Flags{}, ErrClientClosed
+	}
+	environmentKey := c.apiKey
+	if ec, ok := GetEvaluationContextFromCtx(ctx); ok && ec.Environment != nil {
+		environmentKey = ec.Environment.APIKey
+	}
+	endpoint := c.config.baseURL + "flags/"
+	fetch := func(ctx context.Context) ([]byte, error) {
+		body, err := c.requests.do(ctx, environmentFlagsCacheKey(c.config.baseURL, environmentKey), func(ctx context.Context) ([]byte, error) {
+			req := c.newRequest(ctx).
+				SetHeader(EnvironmentKeyHeader, environmentKey)
+			resp, err := c.execute(req, http.MethodGet, endpoint)
+			if err != nil || !resp.IsSuccess() {
+				return nil, newAPIError(http.MethodGet, endpoint, resp, err)
+			}
+			return resp.Body(), nil
+		})
+		if err != nil && err == ctx.Err() {
+			return nil, newAPIError(http.MethodGet, endpoint, nil, err)
 		}
+		return body, err
 	}
-	resp, err := req.
-		SetContext(ctx).
-		ForceContentType("application/json").
-		Get(c.config.baseURL + "flags/")
-	if err != nil {
-		msg := fmt.Sprintf("flagsmith: error performing request to Flagsmith API: %s", err)
-		return Flags{}, &FlagsmithAPIError{Msg: msg, Err: err, ResponseStatusCode: resp.StatusCode(), ResponseStatus: resp.Status()}
+	var body []byte
+	var err error
+	if c.config.cache != nil {
+		body, err = c.cachedRequest(ctx, environmentFlagsCacheKey(c.config.baseURL, environmentKey), fetch)
+	} else {
+		body, err = fetch(ctx)
 	}
-	if !resp.IsSuccess() {
-		msg := fmt.Sprintf("flagsmith: unexpected response from Flagsmith API: %s", resp.Status())
-		return Flags{}, &FlagsmithAPIError{Msg: msg, Err: err, ResponseStatusCode: resp.StatusCode(), ResponseStatus: resp.Status()}
+	if err != nil {
+		return Flags{}, err
 	}
-	return makeFlagsFromAPIFlags(resp.Body(), c.analyticsProcessor, c.defaultFlagHandler)
+	return makeFlagsFromAPIFlags(body, c.analyticsProcessor, c.defaultFlagHandler)
 }
 
 // GetIdentityFlagsFromAPI tries to contact the Flagsmith API to get the latest identity flags.
 // Will return an error in case of failure or unexpected response.
 func (c *Client) GetIdentityFlagsFromAPI(ctx context.Context, identifier string, traits []*Trait) (Flags, error) {
+	if c.closed.Load() {
+		return Flags{}, ErrClientClosed
+	}
 	body := struct {
 		Identifier string   `json:"identifier"`
 		Traits     []*Trait `json:"traits,omitempty"`
 		Transient  *bool    `json:"transient,omitempty"`
 	}{Identifier: identifier, Traits: traits}
-	req := c.client.NewRequest()
+	environmentKey := c.apiKey
 	ec, ok := GetEvaluationContextFromCtx(ctx)
 	if ok {
 		envCtx := ec.Environment
 		if envCtx != nil {
-			req.SetHeader(EnvironmentKeyHeader, envCtx.APIKey)
+			environmentKey = envCtx.APIKey
 		}
 		idCtx := ec.Identity
 		if idCtx != nil {
@@ -319,36 +500,61 @@ func (c *Client) GetIdentityFlagsFromAPI(ctx context.Context, identifier string,
 			body.Transient = idCtx.Transient
 		}
 	}
-	resp, err := req.
-		SetBody(&body).
-		SetContext(ctx).
-		ForceContentType("application/json").
-		Post(c.config.baseURL + "identities/")
-	if err != nil {
-		msg := fmt.Sprintf("flagsmith: error performing request to Flagsmith API: %s", err)
-		return Flags{}, &FlagsmithAPIError{Msg: msg, Err: err, ResponseStatusCode: resp.StatusCode(), ResponseStatus: resp.Status()}
+	endpoint := c.config.baseURL + "identities/"
+	transient := body.Transient != nil && *body.Transient
+	cacheKey := identityFlagsCacheKey(c.config.baseURL, environmentKey, identifier, traits)
+	fetch := func(ctx context.Context) ([]byte, error) {
+		requestKey := cacheKey
+		if transient {
+			requestKey += ":transient"
+		}
+		respBody, err := c.requests.do(ctx, requestKey, func(ctx context.Context) ([]byte, error) {
+			req := c.newRequest(ctx).
+				SetHeader(EnvironmentKeyHeader, environmentKey).
+				SetBody(&body)
+			resp, err := c.execute(req, http.MethodPost, endpoint)
+			if err != nil || !resp.IsSuccess() {
+				return nil, newAPIError(http.MethodPost, endpoint, resp, err)
+			}
+			return resp.Body(), nil
+		})
+		if err != nil && err == ctx.Err() {
+			return nil, newAPIError(http.MethodPost, endpoint, nil, err)
+		}
+		return respBody, err
+	}
+	var respBody []byte
+	var err error
+	// Requests storing traits are always sent, as serving them from the cache would drop the write.
+	storesTraits := !transient && slices.ContainsFunc(traits, func(t *Trait) bool { return t != nil && !t.Transient })
+	if c.config.cache != nil && (!transient || c.config.cacheTransientIdentities) && !storesTraits {
+		respBody, err = c.cachedRequest(ctx, cacheKey, fetch)
+	} else {
+		respBody, err = fetch(ctx)
 	}
-	if !resp.IsSuccess() {
-		msg := fmt.Sprintf("flagsmith: unexpected response from Flagsmith API: %s", resp.Status())
-		return Flags{}, &FlagsmithAPIError{Msg: msg, Err: err, ResponseStatusCode: resp.StatusCode(), ResponseStatus: resp.Status()}
+	if err != nil {
+		return Flags{}, err
 	}
-	return makeFlagsfromIdentityAPIJson(resp.Body(), c.analyticsProcessor, c.defaultFlagHandler)
+	return makeFlagsfromIdentityAPIJson(respBody, c.analyticsProcessor, c.defaultFlagHandler)
 }
 
-func (c *Client) getIdentityFlagsFromEnvironment(identifier string, traits []*Trait) (Flags, error) {
-	evalCtx, ok := c.engineEvaluationContext.Load().(*engine_eval.EngineEvaluationContext)
+func (c *Client) getIdentityFlagsFromEnvironment(ctx context.Context, identifier string, traits []*Trait) (Flags, error) {
+	evalCtx, ok := c.loadEngineEvaluationContext()
 	if !ok {
-		return Flags{}, fmt.Errorf("flagsmith: local environment has not yet been updated")
+		return Flags{}, ErrEnvironmentNotReady
 	}
 	engineEvalCtx := engine_eval.MapContextAndIdentityDataToContext(*evalCtx, identifier, traits)
-	result := flagengine.GetEvaluationResult(&engineEvalCtx)
+	if ec, ok := GetEvaluationContextFromCtx(ctx); ok {
+		engineEvalCtx.Custom = ec.Custom
+	}
+	result := flagengine.GetEvaluationResult(&engineEvalCtx, c.evaluationOptions()...)
 	return makeFlagsFromEngineEvaluationResult(&result, c.analyticsProcessor, c.defaultFlagHandler), nil
 }
 
 func (c *Client) getEnvironmentFlagsFromEnvironment() (Flags, error) {
-	evalCtx, ok := c.engineEvaluationContext.Load().(*engine_eval.EngineEvaluationContext)
+	evalCtx, ok := c.loadEngineEvaluationContext()
 	if !ok {
-		return Flags{}, fmt.Errorf("flagsmith: local environment has not yet been updated")
+		return Flags{}, ErrEnvironmentNotReady
 	}
 	// Clear segments and identity for environment evaluation
 	environmentEvalCtx := engine_eval.EngineEvaluationContext{
@@ -358,10 +564,130 @@ func (c *Client) getEnvironmentFlagsFromEnvironment() (Flags, error) {
 		Segments:    nil,
 	}
 
-	result := flagengine.GetEvaluationResult(&environmentEvalCtx)
+	result := flagengine.GetEvaluationResult(&environmentEvalCtx, c.evaluationOptions()...)
 	return makeFlagsFromEngineEvaluationResult(&result, c.analyticsProcessor, c.defaultFlagHandler), nil
 }
 
+// evaluationOptions returns the engine options derived from the client configuration.
+func (c *Client) evaluationOptions() []engine_eval.EvaluationOption {
+	var opts []engine_eval.EvaluationOption
+	if c.config.typedTraits {
+		opts = append(opts, engine_eval.WithTypedTraits())
+	}
+	if c.config.clock != nil {
+		opts = append(opts, engine_eval.WithClock(c.config.clock))
+	}
+	if c.config.operators != nil {
+		opts = append(opts, engine_eval.WithOperatorRegistry(c.config.operators))
+	}
+	if c.config.bucketing != nil {
+		opts = append(opts, engine_eval.WithBucketingStrategy(c.config.bucketing))
+	}
+	return opts
+}
+
+// setEnvironment installs a newly loaded environment document. The evaluation context is
+// mapped and checked before anything is stored, so that readers never observe a partially
+// installed environment.
+func (c *Client) setEnvironment(env *environments.EnvironmentModel) {
+	engineEvalCtx := engine_eval.MapEnvironmentDocumentToEvaluationContext(env)
+	c.setEnvironmentContext(env, &engineEvalCtx)
+}
+
+// setEnvironmentContext installs an environment and the evaluation context mapped from it.
+func (c *Client) setEnvironmentContext(env *environments.EnvironmentModel, engineEvalCtx *engine_eval.EngineEvaluationContext) {
+	c.checkEngineEvaluationContext(engineEvalCtx)
+	c.environment.Store(env)
+	c.engineEvaluationContext.Store(engineEvalCtx)
+}
+
+// setOfflineEnvironment installs the offline handler's current environment. In local evaluation
+// mode, it is kept apart from the fetched environment, which takes precedence once available.
+// The environment is read under offlineMu, so that a reload racing with start cannot be replaced
+// by an older document.
+func (c *Client) setOfflineEnvironment() {
+	c.offlineMu.Lock()
+	defer c.offlineMu.Unlock()
+	env := c.offlineHandler.GetEnvironment()
+	if !c.config.localEvaluation {
+		c.setEnvironment(env)
+		return
+	}
+	engineEvalCtx := engine_eval.MapEnvironmentDocumentToEvaluationContext(env)
+	c.checkEngineEvaluationContext(&engineEvalCtx)
+	c.offlineEngineEvaluationContext.Store(&engineEvalCtx)
+}
+
+// loadEngineEvaluationContext returns the evaluation context of the fetched environment,
+// falling back to the offline handler's environment while the fetched one is missing or stale.
+func (c *Client) loadEngineEvaluationContext() (*engine_eval.EngineEvaluationContext, bool) {
+	evalCtx, ok := c.engineEvaluationContext.Load().(*engine_eval.EngineEvaluationContext)
+	if ok && !c.environmentStale() {
+		if c.servingOffline.CompareAndSwap(true, false) {
+			c.log.Info("environment updated again; no longer using the offline environment")
+		}
+		return evalCtx, true
+	}
+	if offlineCtx, offline := c.offlineEngineEvaluationContext.Load().(*engine_eval.EngineEvaluationContext); offline {
+		if ok && c.servingOffline.CompareAndSwap(false, true) {
+			c.log.Warn("environment failed to update for longer than the offline fallback delay; using the offline environment",
+				"offline_fallback_after", c.config.offlineFallbackAfter)
+		}
+		return offlineCtx, true
+	}
+	return evalCtx, ok
+}
+
+// environmentStale reports whether the fetched environment was last updated longer ago than
+// the offline fallback delay.
+func (c *Client) environmentStale() bool {
+	updatedAt := c.environmentUpdatedAt.Load()
+	if c.config.offlineFallbackAfter <= 0 || updatedAt == 0 {
+		return false
+	}
+	return time.Since(time.Unix(0, updatedAt)) > c.config.offlineFallbackAfter
+}
+
+// markEnvironmentUpdated records a successful update of the environment at the given time.
+func (c *Client) markEnvironmentUpdated(at time.Time) {
+	c.environmentUpdatedAt.Store(at.UnixNano())
+}
+
+// onOfflineEnvironmentReload installs environments reloaded by a watching offline handler.
+func (c *Client) onOfflineEnvironmentReload(env *environments.EnvironmentModel, err error) {
+	if err != nil {
+		c.log.Error("failed to reload environment document; serving the last valid document", "error", err)
+		if c.errorHandler != nil {
+			c.errorHandler(&FlagsmithAPIError{Msg: err.Error(), Err: err})
+		}
+		return
+	}
+	c.setOfflineEnvironment()
+	c.log.Info("environment reloaded", "environment", env.APIKey, "updated_at", env.UpdatedAt)
+}
+
+// checkEngineEvaluationContext reports problems found in a newly loaded environment.
+// The environment is still used, as rejecting it would stop all flag updates.
+func (c *Client) checkEngineEvaluationContext(ec *engine_eval.EngineEvaluationContext) {
+	diagnostics := engine_eval.Validate(*ec, c.evaluationOptions()...)
+	if len(diagnostics) == 0 {
+		return
+	}
+	for _, d := range diagnostics {
+		c.log.Warn("invalid segment rule will never match",
+			"segment", d.SegmentName,
+			"path", d.Path,
+			"operator", d.Operator,
+			"property", d.Property,
+			"problem", d.Message,
+		)
+	}
+	if c.errorHandler != nil {
+		err := &engine_eval.ValidationError{Diagnostics: diagnostics}
+		c.errorHandler(&FlagsmithAPIError{Msg: err.Error(), Err: err})
+	}
+}
+
 func (c *Client) pollEnvironment(ctx context.Context, pollForever bool) {
 	log := c.log.With(slog.String("worker", "poll"))
 	update := func() {
@@ -374,6 +700,7 @@ func (c *Client) pollEnvironment(ctx context.Context, pollForever bool) {
 		}
 	}
 	update()
+	c.markInitialised()
 	ticker := time.NewTicker(c.config.envRefreshInterval)
 	defer func() {
 		ticker.Stop()
@@ -411,6 +738,7 @@ func (c *Client) pollThenStartRealtime(ctx context.Context) {
 		}
 	}
 	update()
+	c.markInitialised()
 	defer func() {
 		c.log.Info("initial polling stopped")
 	}()
@@ -432,70 +760,87 @@ func (c *Client) pollThenStartRealtime(ctx context.Context) {
 	}
 }
 
+// UpdateEnvironment fetches the environment document used for local evaluation.
+// Concurrent calls, e.g. by polling and real-time updates, share a single update.
 func (c *Client) UpdateEnvironment(ctx context.Context) error {
-	start := time.Now()
-
-	var env environments.EnvironmentModel
-	nextPage := ""
-	pageCount := 0
+	if c.closed.Load() {
+		return ErrClientClosed
+	}
+	_, err := c.environmentUpdates.do(ctx, "", func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, c.updateEnvironment(ctx)
+	})
+	if err != nil && err == ctx.Err() {
+		return newAPIError(http.MethodGet, c.config.baseURL+"environment-document/", nil, err)
+	}
+	return err
+}
 
-	for {
-		var page environments.EnvironmentModel
-		req := c.client.NewRequest().
-			SetContext(ctx).
-			SetResult(&page).
-			ForceContentType("application/json")
-		if nextPage != "" {
-			req = req.SetQueryParam("page_id", nextPage)
-		}
+func (c *Client) updateEnvironment(ctx context.Context) error {
+	start := time.Now()
 
-		resp, err := req.Get(c.config.baseURL + "environment-document/")
+	previousVersion := c.documentVersion.Load()
+	fetch := c.pendingDocument.Swap(nil)
+	if fetch != nil {
+		resumable, err := c.resumablePendingDocument(ctx, fetch)
 		if err != nil {
-			msg := fmt.Sprintf("flagsmith: error performing request to Flagsmith API: %s", err)
-			f := &FlagsmithAPIError{Msg: msg, Err: err, ResponseStatusCode: resp.StatusCode(), ResponseStatus: resp.Status()}
-			if c.errorHandler != nil {
-				c.errorHandler(f)
-			}
-			return f
-		}
-		if resp.StatusCode() != 200 {
-			msg := fmt.Sprintf("flagsmith: unexpected response from Flagsmith API: %s", resp.Status())
-			f := &FlagsmithAPIError{Msg: msg, Err: err, ResponseStatusCode: resp.StatusCode(), ResponseStatus: resp.Status()}
-			if c.errorHandler != nil {
-				c.errorHandler(f)
-			}
-			return f
+			c.pendingDocument.Store(fetch)
+			return c.environmentUpdateFailed(err)
 		}
-
-		pageCount++
-		nextPage = c.ExtractNextPage(resp.Header().Get("link"))
-
-		if pageCount == 1 {
-			env = page
-		} else {
-			env.IdentityOverrides = append(env.IdentityOverrides, page.IdentityOverrides...)
+		fetch = resumable
+	}
+	if fetch != nil {
+		fetch.resumed = true
+		c.log.Info("resuming environment document fetch", "page", fetch.pages+1)
+	} else {
+		fetch = c.newDocumentFetch()
+	}
+	notModified, err := c.fetchEnvironmentDocument(ctx, fetch, previousVersion)
+	var apiErr *FlagsmithAPIError
+	if fetch.resumed && errors.As(err, &apiErr) && apiErr.ResponseStatusCode >= 400 && apiErr.ResponseStatusCode < 500 {
+		// The page could not be resumed, e.g. because it expired, so start again.
+		c.log.Warn("failed to resume environment document fetch; fetching it again", "error", err)
+		fetch = c.newDocumentFetch()
+		notModified, err = c.fetchEnvironmentDocument(ctx, fetch, previousVersion)
+	}
+	if notModified {
+		c.log.Debug("environment not modified")
+		c.markEnvironmentUpdated(time.Now())
+		return nil
+	}
+	if err != nil {
+		if fetch.resumable(err) {
+			c.log.Warn("failed to fetch environment document page; the next update resumes from it",
+				"page", fetch.pages+1, "error", err)
+			c.pendingDocument.Store(fetch)
 		}
+		return c.environmentUpdateFailed(err)
+	}
 
-		if nextPage == "" {
-			break
-		}
+	version := fetch.version()
+	c.documentVersion.Store(version)
+	if previousVersion.sameContent(version.hash) && c.environment.Load() != nil {
+		c.log.Debug("environment unchanged")
+		c.markEnvironmentUpdated(time.Now())
+		return nil
 	}
 
+	decoder := fetch.decoder
+	env := decoder.Environment()
 	isNew := false
 	previousEnv := c.environment.Load()
 	if previousEnv == nil || env.UpdatedAt.After(previousEnv.(*environments.EnvironmentModel).UpdatedAt) {
 		isNew = true
 	}
-	c.environment.Store(&env)
-
-	engineEvalCtx := engine_eval.MapEnvironmentDocumentToEvaluationContext(&env)
-	c.engineEvaluationContext.Store(&engineEvalCtx)
+	engineEvalCtx := decoder.EvaluationContext()
+	c.setEnvironmentContext(env, &engineEvalCtx)
+	c.markEnvironmentUpdated(time.Now())
+	c.saveSnapshot(ctx, env)
 
 	if isNew {
 		c.log.Info("environment updated", "environment", env.APIKey, "updated_at", env.UpdatedAt)
 	}
 
-	c.log.Debug("IdentityOverrides", "len", len(env.IdentityOverrides))
+	c.log.Debug("IdentityOverrides", "len", decoder.IdentityOverrideCount())
 
 	if elapsed := time.Since(start); c.config.envRefreshInterval > 0 && elapsed > c.config.envRefreshInterval {
 		c.log.Warn(
@@ -508,21 +853,23 @@ func (c *Client) UpdateEnvironment(ctx context.Context) error {
 	return nil
 }
 
+// environmentUpdateFailed reports the error of an environment update to the error handler.
+func (c *Client) environmentUpdateFailed(err error) error {
+	var f *FlagsmithAPIError
+	if !errors.As(err, &f) {
+		f = newAPIError(http.MethodGet, c.config.baseURL+"environment-document/", nil, err)
+	}
+	if c.errorHandler != nil {
+		c.errorHandler(f)
+	}
+	return f
+}
+
 // ExtractNextPage parses the Link header from the environment-document API and
 // returns the decoded page_id value when a next page exists, or empty string otherwise.
 // Expected format: </api/v1/environment-document/?page_id=xxx>; rel="next".
 func (c *Client) ExtractNextPage(linkHeader string) string {
-	parts := strings.SplitN(linkHeader, ">", 2)
-	if len(parts) == 0 {
-		return ""
-	}
-
-	u, err := url.Parse(strings.TrimPrefix(parts[0], "<"))
-	if err != nil {
-		return ""
-	}
-
-	pageID := u.Query().Get("page_id")
+	pageID := nextPageID([]string{linkHeader})
 	c.log.Debug("environment-document next page", "link", linkHeader, "page_id", pageID)
 
 	return pageID
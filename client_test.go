@@ -8,13 +8,18 @@ import (
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	flagsmith "github.com/Flagsmith/flagsmith-go-client/v5"
 	"github.com/Flagsmith/flagsmith-go-client/v5/fixtures"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/engine_eval"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/utils"
 	"github.com/go-resty/resty/v2"
 	"github.com/stretchr/testify/assert"
 )
@@ -49,17 +54,13 @@ func TestClientErrorsIfLocalEvaluationWithNonServerSideKey(t *testing.T) {
 
 func TestClientErrorsIfOfflineModeWithoutOfflineHandler(t *testing.T) {
 	// When
-	defer func() {
-		if r := recover(); r != nil {
-			// Then
-			errMsg := fmt.Sprintf("%v", r)
-			expectedErrMsg := "offline handler must be provided to use offline mode."
-			assert.Equal(t, expectedErrMsg, errMsg, "Unexpected error message")
-		}
-	}()
+	_, err := flagsmith.New("key", flagsmith.WithOfflineMode())
 
-	// Trigger panic
-	_ = flagsmith.NewClient("key", flagsmith.WithOfflineMode())
+	// Then
+	assert.ErrorIs(t, err, flagsmith.ErrOfflineHandlerRequired)
+	var configErr *flagsmith.ConfigError
+	assert.ErrorAs(t, err, &configErr)
+	assert.Equal(t, []string{"WithOfflineMode"}, configErr.Options)
 }
 
 func TestClientErrorsIfDefaultHandlerAndOfflineHandlerAreBothSet(t *testing.T) {
@@ -69,42 +70,152 @@ func TestClientErrorsIfDefaultHandlerAndOfflineHandlerAreBothSet(t *testing.T) {
 	assert.NoError(t, err)
 
 	// When
-	defer func() {
-		if r := recover(); r != nil {
-			// Then
-			errMsg := fmt.Sprintf("%v", r)
-			expectedErrMsg := "default flag handler and offline handler cannot be used together."
-			assert.Equal(t, expectedErrMsg, errMsg, "Unexpected error message")
-		}
-	}()
-
-	// Trigger panic
-	_ = flagsmith.NewClient("key",
+	_, err = flagsmith.New("key",
 		flagsmith.WithOfflineHandler(offlineHandler),
 		flagsmith.WithDefaultHandler(func(featureName string) (flagsmith.Flag, error) {
 			return flagsmith.Flag{IsDefault: true}, nil
 		}))
+
+	// Then
+	assert.ErrorIs(t, err, flagsmith.ErrDefaultAndOfflineHandler)
 }
-func TestClientErrorsIfLocalEvaluationModeAndOfflineHandlerAreBothSet(t *testing.T) {
-	// Given
-	envJsonPath := "./fixtures/environment.json"
-	offlineHandler, err := flagsmith.NewLocalFileHandler(envJsonPath)
-	assert.NoError(t, err)
 
+func TestNewReportsAllConfigErrors(t *testing.T) {
 	// When
-	defer func() {
-		if r := recover(); r != nil {
+	_, err := flagsmith.New("key",
+		flagsmith.WithOfflineMode(),
+		flagsmith.WithLocalEvaluation(context.Background()))
+
+	// Then
+	assert.ErrorIs(t, err, flagsmith.ErrOfflineHandlerRequired)
+	assert.ErrorIs(t, err, flagsmith.ErrServerKeyRequired)
+}
+
+func TestNewReportsCustomClientOptionsRegardlessOfOrder(t *testing.T) {
+	restyClient := resty.New()
+	orders := map[string][]flagsmith.Option{
+		"client first": {flagsmith.WithRestyClient(restyClient), flagsmith.WithRequestTimeout(time.Second)},
+		"client last":  {flagsmith.WithRequestTimeout(time.Second), flagsmith.WithRestyClient(restyClient)},
+	}
+	for name, options := range orders {
+		t.Run(name, func(t *testing.T) {
+			// When
+			_, err := flagsmith.New(fixtures.EnvironmentAPIKey, options...)
+
 			// Then
-			errMsg := fmt.Sprintf("%v", r)
-			expectedErrMsg := "local evaluation and offline handler cannot be used together."
-			assert.Equal(t, expectedErrMsg, errMsg, "Unexpected error message")
+			assert.ErrorIs(t, err, flagsmith.ErrCustomClientOption)
+			var configErr *flagsmith.ConfigError
+			assert.ErrorAs(t, err, &configErr)
+			assert.Equal(t, []string{"WithRequestTimeout"}, configErr.Options)
+		})
+	}
+}
+
+func TestLocalEvaluationFallsBackToOfflineHandler(t *testing.T) {
+	// Given: an offline document and a Flagsmith API which is initially down
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	offlineJson := strings.Replace(fixtures.EnvironmentJson, `"feature_state_value": "some_value"`, `"feature_state_value": "offline_value"`, 1)
+	offlineHandler, err := flagsmith.NewOfflineHandlerFromBytes([]byte(offlineJson))
+	assert.NoError(t, err)
+
+	var available atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if !available.Load() {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
 		}
-	}()
+		fixtures.EnvironmentDocumentHandler(rw, req)
+	}))
+	defer server.Close()
 
-	// Trigger panic
-	_ = flagsmith.NewClient("key",
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey,
+		flagsmith.WithLocalEvaluation(ctx),
+		flagsmith.WithEnvironmentRefreshInterval(time.Hour),
+		flagsmith.WithBaseURL(server.URL+"/api/v1/"),
 		flagsmith.WithOfflineHandler(offlineHandler),
-		flagsmith.WithLocalEvaluation(context.Background()))
+		flagsmith.WithOfflineFallbackAfter(30*time.Second))
+
+	assertFeatureValue := func(expected string) {
+		t.Helper()
+		flags, err := client.GetEnvironmentFlags(ctx)
+		assert.NoError(t, err)
+		value, err := flags.GetFeatureValue(fixtures.Feature1Name)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, value)
+
+		flags, err = client.GetIdentityFlags(ctx, "test_identity", nil)
+		assert.NoError(t, err)
+		value, err = flags.GetFeatureValue(fixtures.Feature1Name)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, value)
+	}
+
+	// Then: the offline document is served until the environment is fetched
+	assert.Error(t, client.UpdateEnvironment(ctx))
+	assertFeatureValue("offline_value")
+
+	// When: the environment is fetched
+	available.Store(true)
+	assert.NoError(t, client.UpdateEnvironment(ctx))
+
+	// Then: the fetched environment is served
+	assertFeatureValue(fixtures.Feature1Value)
+
+	// When: the Flagsmith API goes down again
+	available.Store(false)
+	assert.Error(t, client.UpdateEnvironment(ctx))
+
+	// Then: the last fetched environment is still served
+	assertFeatureValue(fixtures.Feature1Value)
+
+	// When: updates keep failing for longer than the offline fallback delay
+	flagsmith.MarkEnvironmentUpdatedForTest(client, time.Now().Add(-time.Minute))
+	assert.Error(t, client.UpdateEnvironment(ctx))
+
+	// Then: the offline document is served again
+	assertFeatureValue("offline_value")
+
+	// When: the Flagsmith API is back
+	available.Store(true)
+	assert.NoError(t, client.UpdateEnvironment(ctx))
+
+	// Then: the fetched environment is served again
+	assertFeatureValue(fixtures.Feature1Value)
+}
+
+func TestLocalEvaluationFallsBackToReloadedOfflineDocument(t *testing.T) {
+	// Given: a watched offline document, and a Flagsmith API which is down
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(t.TempDir(), "environment.json")
+	assert.NoError(t, os.WriteFile(path, []byte(fixtures.EnvironmentJson), 0o600))
+	offlineHandler, err := flagsmith.NewWatchingFileHandler(ctx, path, time.Hour)
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey,
+		flagsmith.WithLocalEvaluation(ctx),
+		flagsmith.WithEnvironmentRefreshInterval(time.Hour),
+		flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithOfflineHandler(offlineHandler))
+
+	// When: the offline document changes
+	reloadedJson := strings.Replace(fixtures.EnvironmentJson, `"feature_state_value": "some_value"`, `"feature_state_value": "reloaded_value"`, 1)
+	assert.NoError(t, os.WriteFile(path, []byte(reloadedJson), 0o600))
+	_, err = offlineHandler.Reload()
+	assert.NoError(t, err)
+
+	// Then
+	flags, err := client.GetEnvironmentFlags(ctx)
+	assert.NoError(t, err)
+	value, err := flags.GetFeatureValue(fixtures.Feature1Name)
+	assert.NoError(t, err)
+	assert.Equal(t, "reloaded_value", value)
 }
 
 func TestUserAgentHeaderIsSent(t *testing.T) {
@@ -449,6 +560,94 @@ func TestGetEnvironmentFlagsIgnoresSegmentOverrides(t *testing.T) {
 	assert.Equal(t, "some_value", flag.Value)
 }
 
+func TestGetIdentityFlagsEvaluatesRelativeDatesWithClock(t *testing.T) {
+	// Given: a segment matching identities which signed up more than 7 days ago
+	ctx := context.Background()
+	environmentJson := strings.NewReplacer(
+		`"operator": "EQUAL"`, `"operator": "LESS_THAN"`,
+		`"property_": "$.environment.name"`, `"property_": "signed_up_at"`,
+		`"value": "Test Environment"`, `"value": "now-7d:date"`,
+	).Replace(fixtures.EnvironmentJsonWithSegmentOverride)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(rw, environmentJson)
+	}))
+	defer server.Close()
+
+	now := time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC)
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey,
+		flagsmith.WithLocalEvaluation(ctx),
+		flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithClock(func() time.Time { return now }))
+	err := client.UpdateEnvironment(ctx)
+	assert.NoError(t, err)
+
+	cases := []struct {
+		signedUpAt string
+		expected   string
+	}{
+		{"2024-06-01T00:00:00Z", "segment_override"},
+		{"2024-06-10T00:00:00Z", fixtures.Feature1Value},
+	}
+	for _, c := range cases {
+		// When
+		flags, err := client.GetIdentityFlags(ctx, "test_identity", []*flagsmith.Trait{
+			{TraitKey: "signed_up_at", TraitValue: c.signedUpAt},
+		})
+
+		// Then
+		assert.NoError(t, err)
+		value, err := flags.GetFeatureValue(fixtures.Feature1Name)
+		assert.NoError(t, err)
+		assert.Equal(t, c.expected, value)
+	}
+}
+
+func TestGetFlagsTargetsCustomContextAttributes(t *testing.T) {
+	// Given: a segment matching enterprise tenants
+	ctx := context.Background()
+	environmentJson := strings.NewReplacer(
+		`"property_": "$.environment.name"`, `"property_": "$.custom.tenant.plan"`,
+		`"value": "Test Environment"`, `"value": "enterprise"`,
+	).Replace(fixtures.EnvironmentJsonWithSegmentOverride)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(rw, environmentJson)
+	}))
+	defer server.Close()
+
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey,
+		flagsmith.WithLocalEvaluation(ctx),
+		flagsmith.WithBaseURL(server.URL+"/api/v1/"))
+	err := client.UpdateEnvironment(ctx)
+	assert.NoError(t, err)
+
+	cases := []struct {
+		plan     string
+		expected string
+	}{
+		{"enterprise", "segment_override"},
+		{"free", fixtures.Feature1Value},
+	}
+	for _, c := range cases {
+		ec := flagsmith.NewEvaluationContext("test_identity", nil)
+		ec.Custom = map[string]any{
+			"tenant": map[string]any{"plan": c.plan},
+		}
+
+		// When
+		flags, err := client.GetFlags(ctx, &ec)
+
+		// Then
+		assert.NoError(t, err)
+		value, err := flags.GetFeatureValue(fixtures.Feature1Name)
+		assert.NoError(t, err)
+		assert.Equal(t, c.expected, value)
+	}
+}
+
 func TestGetIdentityFlagsUseslocalEnvironmentWhenAvailable(t *testing.T) {
 	// Given
 	ctx := context.Background()
@@ -924,6 +1123,68 @@ func TestPollErrorHandlerIsUsedWhenPollFails(t *testing.T) {
 	assert.Equal(t, status, "500 Internal Server Error")
 }
 
+func TestUnknownOperatorsAreReportedWhenEnvironmentIsUpdated(t *testing.T) {
+	// Given: a segment using an operator missing from the default registry
+	ctx := context.Background()
+	environmentJson := strings.Replace(fixtures.EnvironmentJsonWithSegmentOverride,
+		`"operator": "EQUAL"`, `"operator": "STARTS_WITH"`, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(rw, environmentJson)
+	}))
+	defer server.Close()
+
+	newClient := func(opts ...flagsmith.Option) (*flagsmith.Client, func() []error) {
+		var mu sync.Mutex
+		var reported []error
+		opts = append(opts,
+			flagsmith.WithLocalEvaluation(ctx),
+			flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+			flagsmith.WithErrorHandler(func(handler *flagsmith.FlagsmithAPIError) {
+				mu.Lock()
+				defer mu.Unlock()
+				reported = append(reported, handler.Err)
+			}))
+		return flagsmith.NewClient(fixtures.EnvironmentAPIKey, opts...), func() []error {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]error(nil), reported...)
+		}
+	}
+
+	// When
+	client, reported := newClient()
+	err := client.UpdateEnvironment(ctx)
+
+	// Then: the environment is loaded, the problem is reported, and the condition does not match
+	assert.NoError(t, err)
+	assert.NotEmpty(t, reported())
+	for _, err := range reported() {
+		var validationErr *engine_eval.ValidationError
+		assert.True(t, errors.As(err, &validationErr))
+		assert.Equal(t, engine_eval.Operator("STARTS_WITH"), validationErr.Diagnostics[0].Operator)
+	}
+	flags, err := client.GetIdentityFlags(ctx, "test_identity", nil)
+	assert.NoError(t, err)
+	value, _ := flags.GetFeatureValue(fixtures.Feature1Name)
+	assert.Equal(t, fixtures.Feature1Value, value)
+
+	// When: the operator is registered
+	registry := engine_eval.NewOperatorRegistry()
+	assert.NoError(t, registry.Register("STARTS_WITH", engine_eval.StartsWithOperator))
+	client, reported = newClient(flagsmith.WithOperatorRegistry(registry))
+	err = client.UpdateEnvironment(ctx)
+
+	// Then: nothing is reported and the condition matches
+	assert.NoError(t, err)
+	assert.Empty(t, reported())
+	flags, err = client.GetIdentityFlags(ctx, "test_identity", nil)
+	assert.NoError(t, err)
+	value, _ = flags.GetFeatureValue(fixtures.Feature1Name)
+	assert.Equal(t, "segment_override", value)
+}
+
 func TestRealtime(t *testing.T) {
 	// Given
 	mux := http.NewServeMux()
@@ -1212,10 +1473,6 @@ func TestCustomClientOptionsShoudPanic(t *testing.T) {
 			name:   "WithRequestTimeout",
 			option: flagsmith.WithRequestTimeout(5 * time.Second),
 		},
-		{
-			name:   "WithRetries",
-			option: flagsmith.WithRetries(3, time.Second),
-		},
 		{
 			name:   "WithCustomHeaders",
 			option: flagsmith.WithCustomHeaders(map[string]string{"X-Custom": "value"}),
@@ -1237,6 +1494,41 @@ func TestCustomClientOptionsShoudPanic(t *testing.T) {
 	}
 }
 
+func TestRetriesCanBeCombinedWithCustomClients(t *testing.T) {
+	// Given
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if requests.Add(1) == 1 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, err := io.WriteString(rw, fixtures.FlagsJson)
+		assert.NoError(t, err)
+	}))
+	defer server.Close()
+	customClients := map[string]flagsmith.Option{
+		"WithHTTPClient":  flagsmith.WithHTTPClient(&http.Client{}),
+		"WithRestyClient": flagsmith.WithRestyClient(resty.New()),
+	}
+	for name, customClient := range customClients {
+		t.Run(name, func(t *testing.T) {
+			requests.Store(0)
+
+			// When
+			client, err := flagsmith.New(fixtures.EnvironmentAPIKey,
+				flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+				customClient,
+				flagsmith.WithRetries(1, time.Millisecond))
+			assert.NoError(t, err)
+			_, err = client.GetEnvironmentFlagsFromAPI(context.Background())
+
+			// Then
+			assert.NoError(t, err)
+			assert.Equal(t, int32(2), requests.Load())
+		})
+	}
+}
+
 func TestExtractNextPage(t *testing.T) {
 	client := flagsmith.NewClient("test-key")
 
@@ -1260,6 +1552,26 @@ func TestExtractNextPage(t *testing.T) {
 			header:   "</api/v1/environment-document/>; rel=\"next\"",
 			expected: "",
 		},
+		{
+			name:     "next link after other links",
+			header:   "</api/v1/environment-document/?page_id=first>; rel=\"first\", </api/v1/environment-document/?page_id=2>; rel=\"next\"",
+			expected: "2",
+		},
+		{
+			name:     "absolute URL with several relation types",
+			header:   "<https://edge.api.flagsmith.com/api/v1/environment-document/?page_id=2>; title=\"a, b\"; REL=\"last next\"",
+			expected: "2",
+		},
+		{
+			name:     "unquoted relation type",
+			header:   "</api/v1/environment-document/?page_id=2>;rel=next",
+			expected: "2",
+		},
+		{
+			name:     "no next link",
+			header:   "</api/v1/environment-document/?page_id=2>; rel=\"prev\"",
+			expected: "",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -1391,3 +1703,74 @@ func TestUpdateEnvironmentDoesNotLogWarningWhenWithinRefreshInterval(t *testing.
 
 	assert.NotContains(t, logStr, "fetching environment took longer")
 }
+
+func TestGetBucketUsesConfiguredBucketingStrategy(t *testing.T) {
+	// Given: a segment matching half of the identities
+	ctx := context.Background()
+	environmentJson := strings.NewReplacer(
+		`"operator": "EQUAL"`, `"operator": "PERCENTAGE_SPLIT"`,
+		`"property_": "$.environment.name"`, `"property_": null`,
+		`"value": "Test Environment"`, `"value": "50"`,
+	).Replace(fixtures.EnvironmentJsonWithSegmentOverride)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(rw, environmentJson)
+	}))
+	defer server.Close()
+
+	bucketing := utils.BucketingStrategyFunc(func(objectIds []string) float64 {
+		if objectIds[1] == "B62qaMZNwfiqT76p38ggrQ_low" {
+			return 10
+		}
+		return 90
+	})
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey,
+		flagsmith.WithLocalEvaluation(ctx),
+		flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithBucketingStrategy(bucketing))
+	assert.Equal(t, -1.0, client.GetBucket("low", "1"))
+	err := client.UpdateEnvironment(ctx)
+	assert.NoError(t, err)
+
+	cases := []struct {
+		identifier string
+		bucket     float64
+		expected   string
+	}{
+		{"low", 10, "segment_override"},
+		{"high", 90, fixtures.Feature1Value},
+	}
+	for _, c := range cases {
+		// When
+		bucket := client.GetBucket(c.identifier, "1")
+		flags, err := client.GetIdentityFlags(ctx, c.identifier, nil)
+
+		// Then
+		assert.Equal(t, c.bucket, bucket)
+		assert.NoError(t, err)
+		value, err := flags.GetFeatureValue(fixtures.Feature1Name)
+		assert.NoError(t, err)
+		assert.Equal(t, c.expected, value)
+	}
+}
+
+func TestGetBucketDefaultsToMD5Bucketing(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(fixtures.EnvironmentDocumentHandler))
+	defer server.Close()
+
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey,
+		flagsmith.WithLocalEvaluation(ctx),
+		flagsmith.WithBaseURL(server.URL+"/api/v1/"))
+	err := client.UpdateEnvironment(ctx)
+	assert.NoError(t, err)
+
+	// When
+	bucket := client.GetBucket("test_identity", "1")
+
+	// Then
+	expected := utils.GetHashedPercentageForObjectIds([]string{"1", "B62qaMZNwfiqT76p38ggrQ_test_identity"}, 1)
+	assert.Equal(t, expected, bucket)
+}
@@ -0,0 +1,227 @@
+// Command flagsmith provides tools for working with Flagsmith environment documents.
+//
+// Usage:
+//
+//	flagsmith variants -environment environment.json -feature my_feature [-identifiers ids.txt | -count 10000 -prefix user_] [-json]
+//
+// The variants subcommand reports how the values of a multivariate feature are distributed
+// across identities, including segment and identity overrides, and how far the observed
+// distribution deviates from the configured weights. Identifiers are read from a file with one
+// identifier per line ("-" reads standard input), or generated by appending a sequence number
+// to a prefix.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/environments"
+)
+
+const usage = `Usage: flagsmith <command> [flags]
+
+Commands:
+  variants    report the distribution of a multivariate feature's values across identities
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	switch args[0] {
+	case "variants":
+		return runVariants(args[1:], stdin, stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "flagsmith: unknown command %q\n%s", args[0], usage)
+		return 2
+	}
+}
+
+func runVariants(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("variants", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	environmentPath := flags.String("environment", "", "path to the environment document, or - for standard input")
+	featureName := flags.String("feature", "", "name of the feature to report")
+	identifiersPath := flags.String("identifiers", "", "path to a file containing one identifier per line, or - for standard input")
+	count := flags.Int("count", 10000, "number of identifiers to generate when -identifiers is not set")
+	prefix := flags.String("prefix", "identity_", "prefix of the generated identifiers")
+	asJSON := flags.Bool("json", false, "write the report as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *environmentPath == "" || *featureName == "" {
+		fmt.Fprintln(stderr, "flagsmith variants: -environment and -feature are required")
+		flags.Usage()
+		return 2
+	}
+	if *environmentPath == "-" && *identifiersPath == "-" {
+		fmt.Fprintln(stderr, "flagsmith variants: -environment and -identifiers cannot both read standard input")
+		return 2
+	}
+
+	env, err := readEnvironment(*environmentPath, stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "flagsmith variants: %s\n", err)
+		return 1
+	}
+
+	var identifiers iter.Seq[string]
+	var readErr error
+	if *identifiersPath != "" {
+		r, closeFn, err := open(*identifiersPath, stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "flagsmith variants: %s\n", err)
+			return 1
+		}
+		defer closeFn()
+		identifiers = readLines(r, &readErr)
+	} else {
+		identifiers = generateIdentifiers(*prefix, *count)
+	}
+
+	report, err := flagengine.ReportVariants(env, *featureName, identifiers)
+	if err == nil {
+		err = readErr
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "flagsmith variants: %s\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		err = writeJSON(stdout, report)
+	} else {
+		err = writeTable(stdout, report)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "flagsmith variants: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func open(path string, stdin io.Reader) (io.Reader, func(), error) {
+	if path == "-" {
+		return stdin, func() {}, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, func() { _ = f.Close() }, nil
+}
+
+func readEnvironment(path string, stdin io.Reader) (*environments.EnvironmentModel, error) {
+	r, closeFn, err := open(path, stdin)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFn()
+	var env environments.EnvironmentModel
+	if err := json.NewDecoder(r).Decode(&env); err != nil {
+		return nil, fmt.Errorf("invalid environment document: %w", err)
+	}
+	return &env, nil
+}
+
+// readLines yields the non-blank lines of r, storing any read error in errp.
+func readLines(r io.Reader, errp *error) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			if !yield(line) {
+				return
+			}
+		}
+		*errp = scanner.Err()
+	}
+}
+
+func generateIdentifiers(prefix string, count int) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for i := range count {
+			if !yield(prefix + strconv.Itoa(i)) {
+				return
+			}
+		}
+	}
+}
+
+func writeTable(w io.Writer, report *flagengine.VariantReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Feature %q, %d identities\n\n", report.Feature, report.Identities)
+	fmt.Fprintln(tw, "SEGMENT\tVALUE\tCONFIGURED\tCOUNT\tOBSERVED\tDEVIATION")
+	for _, allocation := range report.Allocations {
+		segment := allocation.Segment
+		if segment == "" {
+			segment = "(environment default)"
+		}
+		for _, v := range allocation.Values {
+			value := fmt.Sprintf("%v", v.Value)
+			if v.Control {
+				value += " (control)"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%.2f%%\t%d\t%.2f%%\t%+.2f\n",
+				segment, value, v.ConfiguredWeight, v.Count, v.ObservedWeight, v.Deviation)
+		}
+	}
+	return tw.Flush()
+}
+
+func writeJSON(w io.Writer, report *flagengine.VariantReport) error {
+	type value struct {
+		Value            any     `json:"value"`
+		Control          bool    `json:"control"`
+		ConfiguredWeight float64 `json:"configured_weight"`
+		Count            int     `json:"count"`
+		ObservedWeight   float64 `json:"observed_weight"`
+		Deviation        float64 `json:"deviation"`
+	}
+	type allocation struct {
+		Segment      string  `json:"segment"`
+		Identities   int     `json:"identities"`
+		MaxDeviation float64 `json:"max_deviation"`
+		Values       []value `json:"values"`
+	}
+	out := struct {
+		Feature     string       `json:"feature"`
+		Identities  int          `json:"identities"`
+		Allocations []allocation `json:"allocations"`
+	}{Feature: report.Feature, Identities: report.Identities, Allocations: []allocation{}}
+	for _, a := range report.Allocations {
+		values := make([]value, len(a.Values))
+		for i, v := range a.Values {
+			values[i] = value(*v)
+		}
+		out.Allocations = append(out.Allocations, allocation{
+			Segment:      a.Segment,
+			Identities:   a.Identities,
+			MaxDeviation: a.MaxDeviation(),
+			Values:       values,
+		})
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Flagsmith/flagsmith-go-client/v5/fixtures"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVariantsReportsIdentifiersReadFromStandardInput(t *testing.T) {
+	// Given
+	dir := t.TempDir()
+	environmentPath := dir + "/environment.json"
+	assert.NoError(t, os.WriteFile(environmentPath, []byte(fixtures.EnvironmentJson), 0o600))
+	stdin := strings.NewReader(fixtures.OverriddenIdentifier + "\n\nsome-identity\nanother-identity\n")
+	var stdout, stderr bytes.Buffer
+
+	// When
+	code := run([]string{"variants", "-environment", environmentPath, "-feature", fixtures.Feature1Name,
+		"-identifiers", "-", "-json"}, stdin, &stdout, &stderr)
+
+	// Then
+	assert.Equal(t, 0, code, stderr.String())
+	var report struct {
+		Feature     string `json:"feature"`
+		Identities  int    `json:"identities"`
+		Allocations []struct {
+			Segment    string `json:"segment"`
+			Identities int    `json:"identities"`
+			Values     []struct {
+				Value any `json:"value"`
+				Count int `json:"count"`
+			} `json:"values"`
+		} `json:"allocations"`
+	}
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &report))
+	assert.Equal(t, fixtures.Feature1Name, report.Feature)
+	assert.Equal(t, 3, report.Identities)
+	assert.Len(t, report.Allocations, 2)
+	assert.Equal(t, "identity_overrides", report.Allocations[0].Segment)
+	assert.Equal(t, fixtures.Feature1OverriddenValue, report.Allocations[0].Values[0].Value)
+	assert.Equal(t, "", report.Allocations[1].Segment)
+	assert.Equal(t, 2, report.Allocations[1].Values[0].Count)
+}
+
+func TestVariantsRequiresEnvironmentAndFeature(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	code := run([]string{"variants", "-feature", fixtures.Feature1Name}, nil, &stdout, &stderr)
+
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr.String(), "-environment and -feature are required")
+}
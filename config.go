@@ -2,6 +2,9 @@ package flagsmith
 
 import (
 	"time"
+
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/engine_eval"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/utils"
 )
 
 const (
@@ -14,6 +17,13 @@ const (
 
 	BulkIdentifyMaxCount   = 100
 	DefaultRealtimeBaseUrl = "https://realtime.flagsmith.com/"
+
+	// Default time after which a MultiClient stops updating an unused environment.
+	DefaultIdleEnvironmentTimeout = 10 * time.Minute
+
+	// Default time after which an environment which failed to update is considered missing,
+	// and the offline handler's environment is used instead. Zero disables the fallback.
+	DefaultOfflineFallbackAfter = time.Duration(0)
 )
 
 // config contains all configurable Client settings.
@@ -28,15 +38,66 @@ type config struct {
 	useRealtime        bool
 	polling            bool
 	userProvidedClient bool
+	typedTraits        bool
+	clock              func() time.Time
+	operators          *engine_eval.OperatorRegistry
+	bucketing          utils.BucketingStrategy
+	snapshotStore      SnapshotStore
+	snapshotMaxAge     time.Duration
+	idleEnvTimeout     time.Duration
+	// offlineFallbackAfter is how long the fetched environment is used after its last successful
+	// update before falling back to the offline handler's environment. Zero disables the fallback.
+	offlineFallbackAfter time.Duration
+
+	// Settings of the cache of remotely evaluated flags.
+	cache                    Cache
+	cacheTTL                 time.Duration
+	staleWhileRevalidate     time.Duration
+	staleIfError             time.Duration
+	cacheTransientIdentities bool
+
+	// Settings of the circuit breaker, which is disabled if the failure threshold is zero.
+	circuitFailureThreshold int
+	circuitOpenDuration     time.Duration
+	circuitProbes           int
+
+	// Limits of the size of environment document pages and of the whole document, if positive.
+	maxDocumentPageBytes int64
+	maxDocumentBytes     int64
+	// documentProgressHandler is called after every page of the environment document.
+	documentProgressHandler func(EnvironmentDocumentProgress)
+
+	// Settings of the queue of trait writes in local evaluation mode.
+	traitQueueSize     int
+	traitFlushInterval time.Duration
+
+	// Retry policies of requests, by default and by endpoint path relative to the base URL.
+	retryPolicy           RetryPolicy
+	endpointRetryPolicies map[string]RetryPolicy
+
+	// Settings applied to the HTTP client created by the Client.
+	requestTimeout time.Duration
+	customHeaders  map[string]string
+	proxyURL       string
+
+	// Names of the options providing a custom HTTP client, and of the options modifying
+	// the HTTP client, which cannot be combined.
+	customClients  []string
+	clientSettings []string
 }
 
 // defaultConfig returns default configuration.
 func defaultConfig() config {
 	return config{
-		baseURL:            DefaultBaseURL,
-		timeout:            DefaultTimeout,
-		envRefreshInterval: time.Second * 60,
-		realtimeBaseUrl:    DefaultRealtimeBaseUrl,
-		userProvidedClient: false,
+		baseURL:              DefaultBaseURL,
+		timeout:              DefaultTimeout,
+		envRefreshInterval:   time.Second * 60,
+		realtimeBaseUrl:      DefaultRealtimeBaseUrl,
+		idleEnvTimeout:       DefaultIdleEnvironmentTimeout,
+		offlineFallbackAfter: DefaultOfflineFallbackAfter,
+		cacheTTL:             DefaultCacheTTL,
+		traitQueueSize:       DefaultTraitQueueSize,
+		traitFlushInterval:   DefaultTraitFlushInterval,
+		userProvidedClient:   false,
 	}
 }
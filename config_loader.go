@@ -0,0 +1,278 @@
+package flagsmith
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultEnvPrefix is the prefix of the environment variables read by NewClientFromEnv.
+const DefaultEnvPrefix = "FLAGSMITH_"
+
+// ErrEnvironmentKeyRequired is returned when a Config does not provide an environment key.
+var ErrEnvironmentKeyRequired = errors.New("flagsmith: environment key required")
+
+// Config holds the commonly used Client settings in a form which can be read from environment
+// variables, using ConfigFromEnv, or from a YAML or JSON file, using LoadConfigFile.
+// Zero values leave the corresponding setting at its default.
+//
+// The environment variable of each setting is given below without its prefix, and the YAML and
+// JSON key is the variable name in lower case, e.g. "local_evaluation".
+type Config struct {
+	// ENVIRONMENT_KEY: the environment key, which is required.
+	EnvironmentKey string `json:"environment_key" yaml:"environment_key"`
+	// BASE_URL: the Flagsmith API URL, see WithBaseURL.
+	BaseURL string `json:"base_url" yaml:"base_url"`
+	// LOCAL_EVALUATION: whether to evaluate flags locally, see WithLocalEvaluation.
+	LocalEvaluation bool `json:"local_evaluation" yaml:"local_evaluation"`
+	// ENVIRONMENT_REFRESH_INTERVAL: see WithEnvironmentRefreshInterval.
+	EnvironmentRefreshInterval Duration `json:"environment_refresh_interval" yaml:"environment_refresh_interval"`
+	// REALTIME: whether to receive environment updates in real time, see WithRealtime.
+	Realtime bool `json:"realtime" yaml:"realtime"`
+	// REALTIME_BASE_URL: see WithRealtimeBaseURL.
+	RealtimeBaseURL string `json:"realtime_base_url" yaml:"realtime_base_url"`
+	// POLLING: whether to keep polling when using real time updates, see WithPolling.
+	Polling bool `json:"polling" yaml:"polling"`
+	// ANALYTICS: whether to track flag usage, see WithAnalytics.
+	Analytics bool `json:"analytics" yaml:"analytics"`
+	// REQUEST_TIMEOUT: see WithRequestTimeout.
+	RequestTimeout Duration `json:"request_timeout" yaml:"request_timeout"`
+	// RETRIES and RETRY_WAIT_TIME: see WithRetries.
+	Retries       int      `json:"retries" yaml:"retries"`
+	RetryWaitTime Duration `json:"retry_wait_time" yaml:"retry_wait_time"`
+	// PROXY: see WithProxy.
+	Proxy string `json:"proxy" yaml:"proxy"`
+	// CUSTOM_HEADERS: see WithCustomHeaders. The environment variable holds comma separated
+	// name=value pairs.
+	CustomHeaders map[string]string `json:"custom_headers" yaml:"custom_headers"`
+	// OFFLINE_ENVIRONMENT_PATH: path to an environment document used by a LocalFileHandler,
+	// see WithOfflineHandler.
+	OfflineEnvironmentPath string `json:"offline_environment_path" yaml:"offline_environment_path"`
+	// OFFLINE_MODE: whether to evaluate flags using only the offline environment, see WithOfflineMode.
+	OfflineMode bool `json:"offline_mode" yaml:"offline_mode"`
+	// SNAPSHOT_PATH and SNAPSHOT_MAX_AGE: see WithSnapshotPath and WithSnapshotMaxAge.
+	SnapshotPath   string   `json:"snapshot_path" yaml:"snapshot_path"`
+	SnapshotMaxAge Duration `json:"snapshot_max_age" yaml:"snapshot_max_age"`
+	// TYPED_TRAITS: see WithTypedTraits.
+	TypedTraits bool `json:"typed_traits" yaml:"typed_traits"`
+}
+
+// Duration is a time.Duration read from a duration string such as "30s" or "1m30s".
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// ConfigFromEnv reads a Config from the environment variables named by the prefix followed by
+// the setting name, e.g. FLAGSMITH_ENVIRONMENT_KEY for the prefix DefaultEnvPrefix.
+// Booleans are parsed using strconv.ParseBool and durations using time.ParseDuration.
+// All invalid variables are reported, joined using errors.Join.
+func ConfigFromEnv(prefix string) (*Config, error) {
+	r := envReader{prefix: prefix}
+	cfg := &Config{
+		EnvironmentKey:             r.string("ENVIRONMENT_KEY"),
+		BaseURL:                    r.string("BASE_URL"),
+		LocalEvaluation:            r.bool("LOCAL_EVALUATION"),
+		EnvironmentRefreshInterval: r.duration("ENVIRONMENT_REFRESH_INTERVAL"),
+		Realtime:                   r.bool("REALTIME"),
+		RealtimeBaseURL:            r.string("REALTIME_BASE_URL"),
+		Polling:                    r.bool("POLLING"),
+		Analytics:                  r.bool("ANALYTICS"),
+		RequestTimeout:             r.duration("REQUEST_TIMEOUT"),
+		Retries:                    r.int("RETRIES"),
+		RetryWaitTime:              r.duration("RETRY_WAIT_TIME"),
+		Proxy:                      r.string("PROXY"),
+		CustomHeaders:              r.headers("CUSTOM_HEADERS"),
+		OfflineEnvironmentPath:     r.string("OFFLINE_ENVIRONMENT_PATH"),
+		OfflineMode:                r.bool("OFFLINE_MODE"),
+		SnapshotPath:               r.string("SNAPSHOT_PATH"),
+		SnapshotMaxAge:             r.duration("SNAPSHOT_MAX_AGE"),
+		TypedTraits:                r.bool("TYPED_TRAITS"),
+	}
+	if err := errors.Join(r.errs...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadConfigFile reads a Config from a JSON file, if its name ends with ".json", or from a
+// YAML file otherwise. Unknown keys are reported as errors.
+func LoadConfigFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&cfg)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("flagsmith: invalid configuration file %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Options returns the options applying the configuration. Background goroutines started for
+// local evaluation and analytics run until the Client is closed.
+//
+// The offline environment document, if any, is read by Options.
+func (cfg *Config) Options() ([]Option, error) {
+	var options []Option
+	if cfg.BaseURL != "" {
+		options = append(options, WithBaseURL(cfg.BaseURL))
+	}
+	if cfg.LocalEvaluation {
+		options = append(options, WithLocalEvaluation(context.Background()))
+	}
+	if cfg.EnvironmentRefreshInterval != 0 {
+		options = append(options, WithEnvironmentRefreshInterval(time.Duration(cfg.EnvironmentRefreshInterval)))
+	}
+	if cfg.Realtime {
+		options = append(options, WithRealtime())
+	}
+	if cfg.RealtimeBaseURL != "" {
+		options = append(options, WithRealtimeBaseURL(cfg.RealtimeBaseURL))
+	}
+	if cfg.Polling {
+		options = append(options, WithPolling())
+	}
+	if cfg.Analytics {
+		options = append(options, WithAnalytics(context.Background()))
+	}
+	if cfg.RequestTimeout != 0 {
+		options = append(options, WithRequestTimeout(time.Duration(cfg.RequestTimeout)))
+	}
+	if cfg.Retries != 0 || cfg.RetryWaitTime != 0 {
+		options = append(options, WithRetries(cfg.Retries, time.Duration(cfg.RetryWaitTime)))
+	}
+	if cfg.Proxy != "" {
+		options = append(options, WithProxy(cfg.Proxy))
+	}
+	if len(cfg.CustomHeaders) > 0 {
+		options = append(options, WithCustomHeaders(cfg.CustomHeaders))
+	}
+	if cfg.OfflineEnvironmentPath != "" {
+		handler, err := NewLocalFileHandler(cfg.OfflineEnvironmentPath)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, WithOfflineHandler(handler))
+	}
+	if cfg.OfflineMode {
+		options = append(options, WithOfflineMode())
+	}
+	if cfg.SnapshotPath != "" {
+		options = append(options, WithSnapshotPath(cfg.SnapshotPath))
+	}
+	if cfg.SnapshotMaxAge != 0 {
+		options = append(options, WithSnapshotMaxAge(time.Duration(cfg.SnapshotMaxAge)))
+	}
+	if cfg.TypedTraits {
+		options = append(options, WithTypedTraits())
+	}
+	return options, nil
+}
+
+// NewFromConfig creates a Client using the configuration, followed by the given options.
+// The resulting configuration is validated like New does.
+func NewFromConfig(cfg *Config, options ...Option) (*Client, error) {
+	if cfg.EnvironmentKey == "" {
+		return nil, ErrEnvironmentKeyRequired
+	}
+	configOptions, err := cfg.Options()
+	if err != nil {
+		return nil, err
+	}
+	return New(cfg.EnvironmentKey, append(configOptions, options...)...)
+}
+
+// NewClientFromEnv creates a Client configured by the environment variables prefixed by
+// DefaultEnvPrefix, followed by the given options. See Config for the supported variables.
+func NewClientFromEnv(options ...Option) (*Client, error) {
+	cfg, err := ConfigFromEnv(DefaultEnvPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromConfig(cfg, options...)
+}
+
+// envReader reads environment variables, collecting parsing errors.
+type envReader struct {
+	prefix string
+	errs   []error
+}
+
+func (r *envReader) string(name string) string {
+	return strings.TrimSpace(os.Getenv(r.prefix + name))
+}
+
+func (r *envReader) parse(name string, parse func(string) error) {
+	if value := r.string(name); value != "" {
+		if err := parse(value); err != nil {
+			r.errs = append(r.errs, fmt.Errorf("flagsmith: invalid %s%s: %w", r.prefix, name, err))
+		}
+	}
+}
+
+func (r *envReader) bool(name string) (b bool) {
+	r.parse(name, func(value string) (err error) {
+		b, err = strconv.ParseBool(value)
+		return err
+	})
+	return b
+}
+
+func (r *envReader) int(name string) (i int) {
+	r.parse(name, func(value string) (err error) {
+		i, err = strconv.Atoi(value)
+		return err
+	})
+	return i
+}
+
+func (r *envReader) duration(name string) (d Duration) {
+	r.parse(name, func(value string) error {
+		return d.UnmarshalText([]byte(value))
+	})
+	return d
+}
+
+func (r *envReader) headers(name string) (headers map[string]string) {
+	r.parse(name, func(value string) error {
+		headers = make(map[string]string)
+		for _, pair := range strings.Split(value, ",") {
+			key, val, ok := strings.Cut(pair, "=")
+			if !ok || strings.TrimSpace(key) == "" {
+				return fmt.Errorf("expected name=value, got %q", pair)
+			}
+			headers[strings.TrimSpace(key)] = strings.TrimSpace(val)
+		}
+		return nil
+	})
+	return headers
+}
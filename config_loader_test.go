@@ -0,0 +1,161 @@
+package flagsmith_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	flagsmith "github.com/Flagsmith/flagsmith-go-client/v5"
+	"github.com/Flagsmith/flagsmith-go-client/v5/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var expectedConfig = &flagsmith.Config{
+	EnvironmentKey:             "ser.key",
+	BaseURL:                    "https://flagsmith.example.com/api/v1/",
+	LocalEvaluation:            true,
+	EnvironmentRefreshInterval: flagsmith.Duration(30 * time.Second),
+	RequestTimeout:             flagsmith.Duration(2 * time.Second),
+	Retries:                    3,
+	RetryWaitTime:              flagsmith.Duration(500 * time.Millisecond),
+	CustomHeaders:              map[string]string{"X-Service": "checkout", "X-Team": "payments"},
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	// Given
+	t.Setenv("CHECKOUT_FLAGSMITH_ENVIRONMENT_KEY", "ser.key")
+	t.Setenv("CHECKOUT_FLAGSMITH_BASE_URL", "https://flagsmith.example.com/api/v1/")
+	t.Setenv("CHECKOUT_FLAGSMITH_LOCAL_EVALUATION", "true")
+	t.Setenv("CHECKOUT_FLAGSMITH_ENVIRONMENT_REFRESH_INTERVAL", "30s")
+	t.Setenv("CHECKOUT_FLAGSMITH_REQUEST_TIMEOUT", "2s")
+	t.Setenv("CHECKOUT_FLAGSMITH_RETRIES", "3")
+	t.Setenv("CHECKOUT_FLAGSMITH_RETRY_WAIT_TIME", "500ms")
+	t.Setenv("CHECKOUT_FLAGSMITH_CUSTOM_HEADERS", "X-Service=checkout, X-Team=payments")
+
+	// When
+	cfg, err := flagsmith.ConfigFromEnv("CHECKOUT_FLAGSMITH_")
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, expectedConfig, cfg)
+}
+
+func TestConfigFromEnvReportsAllInvalidVariables(t *testing.T) {
+	// Given
+	t.Setenv("FLAGSMITH_LOCAL_EVALUATION", "yes please")
+	t.Setenv("FLAGSMITH_REQUEST_TIMEOUT", "10")
+	t.Setenv("FLAGSMITH_CUSTOM_HEADERS", "X-Service")
+
+	// When
+	_, err := flagsmith.ConfigFromEnv(flagsmith.DefaultEnvPrefix)
+
+	// Then
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "FLAGSMITH_LOCAL_EVALUATION")
+	assert.Contains(t, err.Error(), "FLAGSMITH_REQUEST_TIMEOUT")
+	assert.Contains(t, err.Error(), "FLAGSMITH_CUSTOM_HEADERS")
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	files := map[string]string{
+		"flagsmith.yaml": `
+environment_key: ser.key
+base_url: https://flagsmith.example.com/api/v1/
+local_evaluation: true
+environment_refresh_interval: 30s
+request_timeout: 2s
+retries: 3
+retry_wait_time: 500ms
+custom_headers:
+  X-Service: checkout
+  X-Team: payments
+`,
+		"flagsmith.json": `{
+	"environment_key": "ser.key",
+	"base_url": "https://flagsmith.example.com/api/v1/",
+	"local_evaluation": true,
+	"environment_refresh_interval": "30s",
+	"request_timeout": "2s",
+	"retries": 3,
+	"retry_wait_time": "500ms",
+	"custom_headers": {"X-Service": "checkout", "X-Team": "payments"}
+}`,
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			path := filepath.Join(t.TempDir(), name)
+			require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+			// When
+			cfg, err := flagsmith.LoadConfigFile(path)
+
+			// Then
+			require.NoError(t, err)
+			assert.Equal(t, expectedConfig, cfg)
+		})
+	}
+}
+
+func TestLoadConfigFileRejectsUnknownKeys(t *testing.T) {
+	// Given
+	path := filepath.Join(t.TempDir(), "flagsmith.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("environment_key: ser.key\nlocal_evalutaion: true\n"), 0o600))
+
+	// When
+	_, err := flagsmith.LoadConfigFile(path)
+
+	// Then
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "local_evalutaion")
+}
+
+func TestNewClientFromEnv(t *testing.T) {
+	// Given
+	server := httptest.NewServer(http.HandlerFunc(fixtures.EnvironmentDocumentHandler))
+	defer server.Close()
+	t.Setenv("FLAGSMITH_ENVIRONMENT_KEY", fixtures.EnvironmentAPIKey)
+	t.Setenv("FLAGSMITH_BASE_URL", server.URL+"/api/v1/")
+	t.Setenv("FLAGSMITH_LOCAL_EVALUATION", "true")
+
+	// When
+	client, err := flagsmith.NewClientFromEnv()
+
+	// Then
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	require.NoError(t, client.UpdateEnvironment(context.Background()))
+	flags, err := client.GetEnvironmentFlags(context.Background())
+	require.NoError(t, err)
+	value, err := flags.GetFeatureValue(fixtures.Feature1Name)
+	require.NoError(t, err)
+	assert.Equal(t, fixtures.Feature1Value, value)
+}
+
+func TestNewClientFromEnvRequiresEnvironmentKey(t *testing.T) {
+	// Given
+	t.Setenv("FLAGSMITH_ENVIRONMENT_KEY", "")
+
+	// When
+	_, err := flagsmith.NewClientFromEnv()
+
+	// Then
+	assert.ErrorIs(t, err, flagsmith.ErrEnvironmentKeyRequired)
+}
+
+func TestNewFromConfigValidatesOptions(t *testing.T) {
+	// Given
+	cfg := &flagsmith.Config{EnvironmentKey: "client-side-key", LocalEvaluation: true, OfflineMode: true}
+
+	// When
+	_, err := flagsmith.NewFromConfig(cfg)
+
+	// Then
+	assert.ErrorIs(t, err, flagsmith.ErrServerKeyRequired)
+	assert.ErrorIs(t, err, flagsmith.ErrOfflineHandlerRequired)
+}
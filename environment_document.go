@@ -0,0 +1,338 @@
+package flagsmith
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/engine_eval"
+	"github.com/go-resty/resty/v2"
+)
+
+// documentVersion identifies the last environment document fetched by the Client.
+type documentVersion struct {
+	// pages holds the validators of every page of the document, which are sent with conditional
+	// requests for the next update.
+	pages []pageVersion
+	// hash is the hash of the bodies of every page of the document.
+	hash []byte
+}
+
+// pageVersion identifies a page of an environment document using its validators, if any.
+type pageVersion struct {
+	// id is the ID of the page, empty for the first page.
+	id           string
+	etag         string
+	lastModified string
+}
+
+// setConditionalHeaders makes the request conditional on the page having changed since it was
+// fetched.
+func (v *pageVersion) setConditionalHeaders(req *resty.Request) {
+	if v == nil {
+		return
+	}
+	if v.etag != "" {
+		req.SetHeader("If-None-Match", v.etag)
+	}
+	if v.lastModified != "" {
+		req.SetHeader("If-Modified-Since", v.lastModified)
+	}
+}
+
+func (v *pageVersion) hasValidators() bool {
+	return v.etag != "" || v.lastModified != ""
+}
+
+// sameContent reports whether the document has the given hash.
+func (v *documentVersion) sameContent(hash []byte) bool {
+	return v != nil && bytes.Equal(v.hash, hash)
+}
+
+// EnvironmentDocumentProgress describes the progress of fetching the environment document,
+// reported after every page to the handler set using WithEnvironmentDocumentProgressHandler.
+type EnvironmentDocumentProgress struct {
+	// Pages is the number of pages fetched so far.
+	Pages int
+	// PageBytes is the size of the last page fetched.
+	PageBytes int64
+	// Bytes is the size of the pages fetched so far.
+	Bytes int64
+	// IdentityOverrides is the number of identity overrides fetched so far.
+	IdentityOverrides int
+	// Resumed reports whether fetching resumed from the pages fetched by an earlier update,
+	// which failed.
+	Resumed bool
+	// Done reports whether the last page was fetched.
+	Done bool
+}
+
+// documentFetch holds the pages of an environment document fetched so far, so that fetching
+// can resume after a page failed.
+type documentFetch struct {
+	decoder *engine_eval.EnvironmentDocumentDecoder
+	// hash is the hash of the hashes of the pages fetched so far.
+	hash hash.Hash
+	// validators holds the validators of the pages fetched so far.
+	validators []pageVersion
+	pages      int
+	bytes      int64
+	// nextPage is the ID of the next page to fetch, empty for the first page.
+	nextPage string
+	resumed  bool
+	// startedAt is the time the first page was requested.
+	startedAt time.Time
+}
+
+func (c *Client) newDocumentFetch() *documentFetch {
+	decoder := engine_eval.NewEnvironmentDocumentDecoder()
+	decoder.KeepIdentityOverrides = c.config.snapshotStore != nil
+	return &documentFetch{decoder: decoder, hash: sha256.New(), startedAt: time.Now()}
+}
+
+// resumablePendingDocument returns the fetch to resume, or nil if fetching must start again
+// from the first page, so that pages of different versions of the document are never mixed.
+// Fetches older than the refresh interval are discarded, and the pages fetched by the others
+// are requested again, conditional on their validators: unless they are all not modified, the
+// document changed since the fetch started. Without validators, only the age of the fetch is
+// checked.
+func (c *Client) resumablePendingDocument(ctx context.Context, fetch *documentFetch) (*documentFetch, error) {
+	if age := time.Since(fetch.startedAt); c.config.envRefreshInterval > 0 && age > c.config.envRefreshInterval {
+		c.log.Info("discarding environment document fetch older than the refresh interval", "age", age)
+		return nil, nil
+	}
+	notModified, err := c.pagesNotModified(ctx, fetch.validators)
+	switch {
+	case err != nil:
+		return nil, err
+	case !notModified:
+		c.log.Info("environment document changed since the failed fetch; fetching it again")
+		return nil, nil
+	}
+	return fetch, nil
+}
+
+// pagesNotModified requests the given pages again, conditional on their validators, and reports
+// whether none of them was modified. Pages without validators cannot be checked, and are assumed
+// to change only along with a page which has validators, such as the first page.
+func (c *Client) pagesNotModified(ctx context.Context, pages []pageVersion) (bool, error) {
+	for _, page := range pages {
+		if !page.hasValidators() {
+			continue
+		}
+		r := c.requestDocumentPage(ctx, page.id, &page)
+		resp, err := r.wait()
+		r.close()
+		switch {
+		case err == nil && resp.StatusCode() == http.StatusNotModified:
+		case err == nil && (resp.StatusCode() == http.StatusOK || resp.StatusCode() == http.StatusNotFound):
+			// The page changed, or no longer exists in the current version of the document.
+			return false, nil
+		default:
+			return false, newAPIError(http.MethodGet, c.config.baseURL+"environment-document/", resp, err)
+		}
+	}
+	return true, nil
+}
+
+func (f *documentFetch) version() *documentVersion {
+	return &documentVersion{pages: slices.Clone(f.validators), hash: f.hash.Sum(nil)}
+}
+
+func (f *documentFetch) progress(pageBytes int64) EnvironmentDocumentProgress {
+	return EnvironmentDocumentProgress{
+		Pages:             f.pages,
+		PageBytes:         pageBytes,
+		Bytes:             f.bytes,
+		IdentityOverrides: f.decoder.IdentityOverrideCount(),
+		Resumed:           f.resumed,
+		Done:              f.nextPage == "",
+	}
+}
+
+// decodePage streams the body of a page into the decoder, within the size limits. If it fails,
+// the fetch is left as it was before the page.
+func (f *documentFetch) decodePage(resp *resty.Response, maxPageBytes, maxDocumentBytes int64) (int64, error) {
+	body := &limitedReader{r: resp.RawBody(), remaining: -1}
+	if maxPageBytes > 0 {
+		body.remaining = maxPageBytes
+		body.err = fmt.Errorf("%w: page exceeds %d bytes", ErrDocumentTooLarge, maxPageBytes)
+	}
+	if remaining := maxDocumentBytes - f.bytes; maxDocumentBytes > 0 && (body.remaining < 0 || remaining < body.remaining) {
+		body.remaining = remaining
+		body.err = fmt.Errorf("%w: document exceeds %d bytes", ErrDocumentTooLarge, maxDocumentBytes)
+	}
+	pageHash := sha256.New()
+	if err := f.decoder.DecodePage(io.TeeReader(body, pageHash)); err != nil {
+		return 0, err
+	}
+	// Read the rest of the body, e.g. trailing whitespace, so that it counts towards the limits.
+	if _, err := io.Copy(pageHash, body); err != nil {
+		return 0, err
+	}
+	f.validators = append(f.validators, pageVersion{
+		id:           f.nextPage,
+		etag:         resp.Header().Get("ETag"),
+		lastModified: resp.Header().Get("Last-Modified"),
+	})
+	f.pages++
+	f.bytes += body.read
+	f.hash.Write(pageHash.Sum(nil))
+	return body.read, nil
+}
+
+// limitedReader fails with err once more than remaining bytes are read, unless remaining is negative.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	err       error
+	read      int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining >= 0 && int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.remaining >= 0 {
+		if int64(n) > l.remaining {
+			return 0, l.err
+		}
+		l.remaining -= int64(n)
+	}
+	return n, err
+}
+
+// pageRequest is a request for a page of the environment document, sent in the background while
+// the previous page is decoded. Only the next page is prefetched: its ID is given by the Link
+// header of the previous page, so pages cannot be requested further ahead.
+type pageRequest struct {
+	done   chan struct{}
+	resp   *resty.Response
+	err    error
+	cancel context.CancelFunc
+}
+
+// requestDocumentPage requests the page with the given ID, or the first page if it is empty,
+// making the request conditional on the page having changed since version, unless it is nil.
+func (c *Client) requestDocumentPage(ctx context.Context, pageID string, version *pageVersion) *pageRequest {
+	ctx, cancel := context.WithCancel(ctx)
+	r := &pageRequest{done: make(chan struct{}), cancel: cancel}
+	req := c.newRequest(ctx)
+	if pageID != "" {
+		req.SetQueryParam("page_id", pageID)
+	}
+	version.setConditionalHeaders(req)
+	go func() {
+		defer close(r.done)
+		r.resp, r.err = c.executeStream(req, http.MethodGet, c.config.baseURL+"environment-document/")
+	}()
+	return r
+}
+
+func (r *pageRequest) wait() (*resty.Response, error) {
+	<-r.done
+	return r.resp, r.err
+}
+
+// close cancels the request if it is still in flight, and closes the body of its response.
+func (r *pageRequest) close() {
+	r.cancel()
+	<-r.done
+	if r.resp != nil && r.resp.RawResponse != nil {
+		_ = r.resp.RawBody().Close()
+	}
+}
+
+// fetchEnvironmentDocument fetches the remaining pages of the document into the fetch, one after
+// the other, prefetching the next page while a page is decoded. It reports whether the document was not
+// modified since version: the first page is requested conditional on its validators and, if it
+// was not modified, the later pages are checked too before the document is considered unchanged.
+func (c *Client) fetchEnvironmentDocument(ctx context.Context, fetch *documentFetch, version *documentVersion) (bool, error) {
+	endpoint := c.config.baseURL + "environment-document/"
+	var first *pageVersion
+	if fetch.nextPage == "" && c.environment.Load() != nil && version != nil && len(version.pages) > 0 {
+		first = &version.pages[0]
+	}
+	pending := c.requestDocumentPage(ctx, fetch.nextPage, first)
+	if first != nil {
+		resp, err := pending.wait()
+		if err == nil && resp.StatusCode() == http.StatusNotModified {
+			pending.close()
+			notModified, err := c.pagesNotModified(ctx, version.pages[1:])
+			if notModified || err != nil {
+				return notModified, err
+			}
+			c.log.Debug("environment document page changed; fetching the document again")
+			pending = c.requestDocumentPage(ctx, "", nil)
+		}
+	}
+	for {
+		resp, err := pending.wait()
+		if err != nil || resp.StatusCode() != http.StatusOK {
+			pending.close()
+			return false, newAPIError(http.MethodGet, endpoint, resp, err)
+		}
+
+		nextPage := nextPageID(resp.Header().Values("Link"))
+		var next *pageRequest
+		if nextPage != "" {
+			next = c.requestDocumentPage(ctx, nextPage, nil)
+		}
+		pageBytes, err := fetch.decodePage(resp, c.config.maxDocumentPageBytes, c.config.maxDocumentBytes)
+		pending.close()
+		if err != nil {
+			if next != nil {
+				next.close()
+			}
+			return false, newAPIError(http.MethodGet, endpoint, resp, err)
+		}
+
+		fetch.nextPage = nextPage
+		progress := fetch.progress(pageBytes)
+		c.log.Debug("environment document page fetched",
+			"page", progress.Pages,
+			"page_bytes", progress.PageBytes,
+			"bytes", progress.Bytes,
+			"identity_overrides", progress.IdentityOverrides,
+		)
+		if c.config.documentProgressHandler != nil {
+			c.config.documentProgressHandler(progress)
+		}
+		if next == nil {
+			return false, nil
+		}
+		pending = next
+	}
+}
+
+// resumable reports whether fetching the document can resume from the failed page, rather than
+// starting again from the first page.
+func (f *documentFetch) resumable(err error) bool {
+	return f.pages > 0 && !errors.Is(err, ErrDocumentTooLarge)
+}
+
+// nextPageID returns the page_id of the link to the next page of the environment document,
+// or an empty string if there is none.
+func nextPageID(linkHeaders []string) string {
+	for _, l := range parseLinkHeader(linkHeaders...) {
+		if !l.hasRel("next") {
+			continue
+		}
+		u, err := url.Parse(l.target)
+		if err != nil {
+			continue
+		}
+		return u.Query().Get("page_id")
+	}
+	return ""
+}
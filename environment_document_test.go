@@ -0,0 +1,451 @@
+package flagsmith_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	flagsmith "github.com/Flagsmith/flagsmith-go-client/v5"
+	"github.com/Flagsmith/flagsmith-go-client/v5/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	documentETag         = `"v1"`
+	documentLastModified = "Wed, 21 Oct 2026 07:28:00 GMT"
+)
+
+// conditionalServer serves the environment document with validators, and responds with 304 Not
+// Modified to requests which are conditional on it. It records the conditional request headers.
+func conditionalServer(t *testing.T) (*httptest.Server, func() (full, notModified int, headers []http.Header)) {
+	var mu sync.Mutex
+	var full, notModified int
+	var headers []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		headers = append(headers, req.Header.Clone())
+		if req.Header.Get("If-None-Match") == documentETag {
+			notModified++
+			rw.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full++
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Header().Set("ETag", documentETag)
+		rw.Header().Set("Last-Modified", documentLastModified)
+		_, err := io.WriteString(rw, fixtures.EnvironmentJson)
+		assert.NoError(t, err)
+	}))
+	return server, func() (int, int, []http.Header) {
+		mu.Lock()
+		defer mu.Unlock()
+		return full, notModified, headers
+	}
+}
+
+func TestUpdateEnvironmentSendsConditionalRequests(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server, requests := conditionalServer(t)
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithLocalEvaluation(ctx))
+	require.NoError(t, client.UpdateEnvironment(ctx))
+	evalCtx := flagsmith.EngineEvaluationContextForTest(client)
+
+	// When
+	err := client.UpdateEnvironment(ctx)
+
+	// Then
+	require.NoError(t, err)
+	full, notModified, headers := requests()
+	assert.Equal(t, 1, full)
+	assert.Equal(t, 1, notModified)
+	assert.Empty(t, headers[0].Get("If-None-Match"))
+	assert.Equal(t, documentETag, headers[1].Get("If-None-Match"))
+	assert.Equal(t, documentLastModified, headers[1].Get("If-Modified-Since"))
+	assert.Same(t, evalCtx, flagsmith.EngineEvaluationContextForTest(client))
+
+	flags, err := client.GetEnvironmentFlags(ctx)
+	require.NoError(t, err)
+	value, err := flags.GetFeatureValue(fixtures.Feature1Name)
+	require.NoError(t, err)
+	assert.Equal(t, fixtures.Feature1Value, value)
+}
+
+func TestUpdateEnvironmentSkipsMappingUnchangedDocument(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		_, err := io.WriteString(rw, fixtures.EnvironmentJson)
+		assert.NoError(t, err)
+	}))
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithLocalEvaluation(ctx))
+	require.NoError(t, client.UpdateEnvironment(ctx))
+	evalCtx := flagsmith.EngineEvaluationContextForTest(client)
+
+	// When
+	err := client.UpdateEnvironment(ctx)
+
+	// Then
+	require.NoError(t, err)
+	assert.Same(t, evalCtx, flagsmith.EngineEvaluationContextForTest(client))
+}
+
+func TestUpdateEnvironmentFetchesDocumentIfOnlyLaterPageChanged(t *testing.T) {
+	// Given: a paged document with validators on every page, whose second page then changes
+	ctx := context.Background()
+	var revision atomic.Int32
+	var mu sync.Mutex
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		pageID := req.URL.Query().Get("page_id")
+		etag := `"page` + pageID + `"`
+		page := fixtures.EnvironmentJson
+		if pageID == "1" {
+			etag = `"page1-` + strconv.Itoa(int(revision.Load())) + `"`
+			page = strings.Replace(fixtures.EnvironmentJsonPage2, `"some-overridden-value"`,
+				`"value_`+strconv.Itoa(int(revision.Load()))+`"`, 1)
+		} else {
+			rw.Header().Add("Link", `<http://`+req.Host+`/api/v1/environment-document/?page_id=1>; rel="next"`)
+		}
+		mu.Lock()
+		requested = append(requested, pageID+req.Header.Get("If-None-Match"))
+		mu.Unlock()
+		if req.Header.Get("If-None-Match") == etag {
+			rw.WriteHeader(http.StatusNotModified)
+			return
+		}
+		rw.Header().Set("ETag", etag)
+		_, err := io.WriteString(rw, page)
+		assert.NoError(t, err)
+	}))
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithLocalEvaluation(ctx))
+	require.NoError(t, client.UpdateEnvironment(ctx))
+	require.NoError(t, client.UpdateEnvironment(ctx))
+	revision.Store(1)
+
+	// When
+	err := client.UpdateEnvironment(ctx)
+
+	// Then: the unchanged document is checked page by page, and fetched again once a page changed
+	require.NoError(t, err)
+	mu.Lock()
+	assert.Equal(t, []string{
+		"", "1",
+		`"page"`, `1"page1-0"`,
+		`"page"`, `1"page1-0"`, "", "1",
+	}, requested)
+	mu.Unlock()
+	flags, err := client.GetIdentityFlags(ctx, "overridden-id-page2", nil)
+	require.NoError(t, err)
+	value, err := flags.GetFeatureValue(fixtures.Feature1Name)
+	require.NoError(t, err)
+	assert.Equal(t, "value_1", value)
+}
+
+func TestUpdateEnvironmentStreamsDocumentWithinRetryBudget(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		requests++
+		first := requests == 1
+		mu.Unlock()
+		if first {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		_, err := io.WriteString(rw, fixtures.EnvironmentJson)
+		assert.NoError(t, err)
+	}))
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithLocalEvaluation(ctx),
+		flagsmith.WithRetryPolicy(flagsmith.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, Budget: time.Second}))
+
+	// When
+	err := client.UpdateEnvironment(ctx)
+
+	// Then
+	require.NoError(t, err)
+	flags, err := client.GetIdentityFlags(ctx, fixtures.OverriddenIdentifier, nil)
+	require.NoError(t, err)
+	value, err := flags.GetFeatureValue(fixtures.Feature1Name)
+	require.NoError(t, err)
+	assert.Equal(t, fixtures.Feature1OverriddenValue, value)
+}
+
+// pagedDocumentServer serves the environment document in the given pages, linking each page
+// to the next. status returns the status to respond with instead of a page, or zero. It records
+// the index of every page requested.
+func pagedDocumentServer(t *testing.T, pages []string, status func(page int) int) (*httptest.Server, func() []int) {
+	var mu sync.Mutex
+	var requested []int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		page := 0
+		if id := req.URL.Query().Get("page_id"); id != "" {
+			var err error
+			page, err = strconv.Atoi(id)
+			require.NoError(t, err)
+		}
+		mu.Lock()
+		requested = append(requested, page)
+		mu.Unlock()
+		if s := status(page); s != 0 {
+			rw.WriteHeader(s)
+			return
+		}
+		if page+1 < len(pages) {
+			rw.Header().Add("Link", `<http://`+req.Host+`/api/v1/environment-document/?page_id=`+strconv.Itoa(page+1)+`>; rel="next"`)
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		_, err := io.WriteString(rw, pages[page])
+		assert.NoError(t, err)
+	}))
+	return server, func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(requested)
+	}
+}
+
+func TestUpdateEnvironmentResumesFromFailedPage(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	var failing atomic.Bool
+	failing.Store(true)
+	server, requested := pagedDocumentServer(t,
+		[]string{fixtures.EnvironmentJson, fixtures.EnvironmentJsonPage2, fixtures.EnvironmentJsonPage2},
+		func(page int) int {
+			if page == 2 && failing.Load() {
+				return http.StatusBadGateway
+			}
+			return 0
+		})
+	defer server.Close()
+	var progress []flagsmith.EnvironmentDocumentProgress
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithEnvironmentDocumentProgressHandler(func(p flagsmith.EnvironmentDocumentProgress) {
+			progress = append(progress, p)
+		}))
+	require.Error(t, client.UpdateEnvironment(ctx))
+	failing.Store(false)
+
+	// When
+	err := client.UpdateEnvironment(ctx)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 2, 2}, requested())
+	require.Len(t, progress, 3)
+	assert.False(t, progress[1].Resumed)
+	last := progress[2]
+	assert.True(t, last.Resumed)
+	assert.True(t, last.Done)
+	assert.Equal(t, 3, last.Pages)
+	assert.Equal(t, int64(len(fixtures.EnvironmentJson)+2*len(fixtures.EnvironmentJsonPage2)), last.Bytes)
+	assert.Equal(t, 3, last.IdentityOverrides)
+}
+
+func TestUpdateEnvironmentStartsAgainIfDocumentChangedBeforeResuming(t *testing.T) {
+	// Given: a paged document whose third page fails, and whose first page then changes
+	ctx := context.Background()
+	var revision atomic.Int32
+	var mu sync.Mutex
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		pageID := req.URL.Query().Get("page_id")
+		etag := `"` + strconv.Itoa(int(revision.Load())) + `"`
+		mu.Lock()
+		requested = append(requested, pageID+req.Header.Get("If-None-Match"))
+		mu.Unlock()
+		page := fixtures.EnvironmentJsonPage2
+		switch pageID {
+		case "":
+			if req.Header.Get("If-None-Match") == etag {
+				rw.WriteHeader(http.StatusNotModified)
+				return
+			}
+			rw.Header().Set("ETag", etag)
+			page = strings.Replace(fixtures.EnvironmentJson, `"feature_state_value": "some_value"`,
+				`"feature_state_value": "value_`+strconv.Itoa(int(revision.Load()))+`"`, 1)
+			rw.Header().Add("Link", `<http://`+req.Host+`/api/v1/environment-document/?page_id=1>; rel="next"`)
+		case "1":
+			rw.Header().Add("Link", `<http://`+req.Host+`/api/v1/environment-document/?page_id=2>; rel="next"`)
+		case "2":
+			if revision.Load() == 0 {
+				rw.WriteHeader(http.StatusBadGateway)
+				return
+			}
+		}
+		_, err := io.WriteString(rw, page)
+		assert.NoError(t, err)
+	}))
+	defer server.Close()
+	snapshotPath := filepath.Join(t.TempDir(), "environment.json")
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithSnapshotPath(snapshotPath))
+	require.Error(t, client.UpdateEnvironment(ctx))
+	revision.Store(1)
+
+	// When
+	err := client.UpdateEnvironment(ctx)
+
+	// Then: the document is fetched again from the first page
+	require.NoError(t, err)
+	mu.Lock()
+	assert.Equal(t, []string{"", "1", "2", `"0"`, "", "1", "2"}, requested)
+	mu.Unlock()
+	snapshot, err := os.ReadFile(snapshotPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(snapshot), `"value_1"`)
+	assert.NotContains(t, string(snapshot), `"value_0"`)
+}
+
+func TestUpdateEnvironmentDiscardsFetchOlderThanRefreshInterval(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	var failing atomic.Bool
+	failing.Store(true)
+	server, requested := pagedDocumentServer(t,
+		[]string{fixtures.EnvironmentJson, fixtures.EnvironmentJsonPage2},
+		func(page int) int {
+			if page == 1 && failing.Load() {
+				return http.StatusBadGateway
+			}
+			return 0
+		})
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithEnvironmentRefreshInterval(20*time.Millisecond))
+	require.Error(t, client.UpdateEnvironment(ctx))
+	failing.Store(false)
+	time.Sleep(30 * time.Millisecond)
+
+	// When
+	err := client.UpdateEnvironment(ctx)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 0, 1}, requested())
+}
+
+func TestUpdateEnvironmentStartsAgainIfPageCannotBeResumed(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	var failures atomic.Int32
+	failures.Store(2)
+	server, requested := pagedDocumentServer(t,
+		[]string{fixtures.EnvironmentJson, fixtures.EnvironmentJsonPage2},
+		func(page int) int {
+			if page == 1 && failures.Add(-1) >= 0 {
+				if failures.Load() == 1 {
+					return http.StatusServiceUnavailable
+				}
+				return http.StatusNotFound
+			}
+			return 0
+		})
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"))
+	require.Error(t, client.UpdateEnvironment(ctx))
+
+	// When
+	err := client.UpdateEnvironment(ctx)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 1, 0, 1}, requested())
+}
+
+func TestUpdateEnvironmentEnforcesDocumentLimits(t *testing.T) {
+	pages := []string{fixtures.EnvironmentJson, fixtures.EnvironmentJsonPage2}
+	total := int64(len(fixtures.EnvironmentJson) + len(fixtures.EnvironmentJsonPage2))
+	for name, option := range map[string]flagsmith.Option{
+		"page limit":     flagsmith.WithEnvironmentDocumentLimits(int64(len(fixtures.EnvironmentJson))-1, 0),
+		"document limit": flagsmith.WithEnvironmentDocumentLimits(0, total-1),
+	} {
+		t.Run(name, func(t *testing.T) {
+			// Given
+			ctx := context.Background()
+			server, _ := pagedDocumentServer(t, pages, func(int) int { return 0 })
+			defer server.Close()
+			client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"), option)
+
+			// When
+			err := client.UpdateEnvironment(ctx)
+
+			// Then
+			assert.ErrorIs(t, err, flagsmith.ErrDocumentTooLarge)
+		})
+	}
+
+	// Given
+	ctx := context.Background()
+	server, _ := pagedDocumentServer(t, pages, func(int) int { return 0 })
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithEnvironmentDocumentLimits(int64(len(fixtures.EnvironmentJson)), total))
+
+	// When
+	err := client.UpdateEnvironment(ctx)
+
+	// Then
+	assert.NoError(t, err)
+}
+
+func TestUpdateEnvironmentRequestsNextPageWhileDecoding(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	secondPageRequested := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		if req.URL.Query().Get("page_id") != "" {
+			close(secondPageRequested)
+			_, err := io.WriteString(rw, fixtures.EnvironmentJsonPage2)
+			assert.NoError(t, err)
+			return
+		}
+		rw.Header().Set("Link", `</api/v1/environment-document/?page_id=2>; rel="next"`)
+		half := len(fixtures.EnvironmentJson) / 2
+		_, err := io.WriteString(rw, fixtures.EnvironmentJson[:half])
+		assert.NoError(t, err)
+		rw.(http.Flusher).Flush()
+		select {
+		case <-secondPageRequested:
+		case <-time.After(time.Second):
+			t.Error("second page was not requested before the first page was read")
+		}
+		_, err = io.WriteString(rw, fixtures.EnvironmentJson[half:])
+		assert.NoError(t, err)
+	}))
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"))
+
+	// When
+	err := client.UpdateEnvironment(ctx)
+
+	// Then
+	assert.NoError(t, err)
+}
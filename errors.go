@@ -1,20 +1,140 @@
 package flagsmith
 
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// Errors wrapped by a ConfigError, identifying the configuration problem.
+var (
+	ErrMultipleCustomClients    = errors.New("only one of WithHTTPClient and WithRestyClient can be used")
+	ErrCustomClientOption       = errors.New("options modifying the HTTP client cannot be used with a custom client")
+	ErrOfflineHandlerRequired   = errors.New("offline mode requires an offline handler")
+	ErrDefaultAndOfflineHandler = errors.New("default flag handler and offline handler cannot be used together")
+	ErrServerKeyRequired        = errors.New("local evaluation requires a server-side environment key, which can be generated in the environment settings page")
+	ErrMultiClientOption        = errors.New("option cannot be used with a MultiClient")
+)
+
+// ConfigError reports an invalid client configuration.
+type ConfigError struct {
+	// Options names the options causing the problem.
+	Options []string
+	// Err describes the problem, and is one of the Err* configuration errors.
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return "flagsmith: invalid configuration (" + strings.Join(e.Options, ", ") + "): " + e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// Errors identifying why a Client method failed, which can be tested using errors.Is.
+var (
+	// ErrFeatureNotFound is returned when requesting a flag for a feature which does not exist.
+	ErrFeatureNotFound = errors.New("flagsmith: feature not found")
+	// ErrEnvironmentNotReady is returned when evaluating flags locally before an environment was loaded.
+	ErrEnvironmentNotReady = errors.New("flagsmith: local environment has not yet been updated")
+	// ErrClientClosed is returned when using a Client after calling Close.
+	ErrClientClosed = errors.New("flagsmith: client is closed")
+	// ErrLocalEvaluationRequired is returned by methods which require local evaluation or offline mode.
+	ErrLocalEvaluationRequired = errors.New("flagsmith: local evaluation required")
+	// ErrBatchTooLarge is returned when a batch exceeds the size accepted by the Flagsmith API.
+	ErrBatchTooLarge = errors.New("flagsmith: batch too large")
+	// ErrCircuitOpen is returned instead of sending requests to the Flagsmith API while the
+	// circuit breaker is open.
+	ErrCircuitOpen = errors.New("flagsmith: circuit breaker is open")
+	// ErrDocumentTooLarge is returned when the environment document exceeds the limits set using
+	// WithEnvironmentDocumentLimits.
+	ErrDocumentTooLarge = errors.New("flagsmith: environment document too large")
+	// ErrOfflineMode is returned by methods which require the Flagsmith API in offline mode.
+	ErrOfflineMode = errors.New("flagsmith: not available in offline mode")
+	// ErrIdentifierRequired is returned when an identity without identifier is given.
+	ErrIdentifierRequired = errors.New("flagsmith: identifier required")
+	// ErrTransientTrait is returned by SetTraits for transient traits, which are never persisted.
+	ErrTransientTrait = errors.New("flagsmith: transient traits cannot be set")
+	// ErrNilTrait is returned by SetTraits for nil traits.
+	ErrNilTrait = errors.New("flagsmith: nil traits cannot be set")
+)
+
+// FlagsmithClientError reports a failure to provide flags. Err holds the underlying error.
 type FlagsmithClientError struct {
 	msg string
+	Err error
 }
 
+// FlagsmithAPIError reports a failed request to the Flagsmith API.
+//
+// The error handler set using WithErrorHandler also receives FlagsmithAPIErrors for problems
+// found in environment documents, which are not tied to a request: Method, Endpoint and the
+// response status are then empty, and Err is an *engine_eval.ValidationError for segment rules
+// which cannot be evaluated, or an *EnvironmentDocumentError (or a file system error) for an
+// offline document which failed to reload. Use errors.As to tell them apart. These reports reuse
+// FlagsmithAPIError rather than a type of their own because the handler accepts only
+// *FlagsmithAPIError, and changing its signature would break existing handlers in v5.
 type FlagsmithAPIError struct {
-	Msg                string
+	Msg string
+	// Err is the error which caused the request to fail, if any, such as a context.DeadlineExceeded.
 	Err                error
 	ResponseStatusCode int
 	ResponseStatus     string
+	// Method and Endpoint identify the failed request, if any.
+	Method   string
+	Endpoint string
+	// RetryAfter is the delay requested by the Retry-After response header, or zero.
+	RetryAfter time.Duration
 }
 
 func (e FlagsmithClientError) Error() string {
 	return e.msg
 }
 
+func (e FlagsmithClientError) Unwrap() error {
+	return e.Err
+}
+
 func (e FlagsmithAPIError) Error() string {
 	return e.Msg
 }
+
+func (e FlagsmithAPIError) Unwrap() error {
+	return e.Err
+}
+
+// newAPIError describes a request which failed with err, or received an unsuccessful response.
+func newAPIError(method, endpoint string, resp *resty.Response, err error) *FlagsmithAPIError {
+	apiErr := &FlagsmithAPIError{Err: err, Method: method, Endpoint: endpoint}
+	if resp != nil && resp.RawResponse != nil {
+		apiErr.ResponseStatusCode = resp.StatusCode()
+		apiErr.ResponseStatus = resp.Status()
+		apiErr.RetryAfter = parseRetryAfter(resp.Header().Get("Retry-After"), time.Now())
+	}
+	if err != nil {
+		apiErr.Msg = fmt.Sprintf("flagsmith: error performing request to Flagsmith API: %s", err)
+	} else {
+		apiErr.Msg = fmt.Sprintf("flagsmith: unexpected response from Flagsmith API: %s", apiErr.ResponseStatus)
+	}
+	return apiErr
+}
+
+// parseRetryAfter parses a Retry-After header holding either a number of seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,175 @@
+package flagsmith_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	flagsmith "github.com/Flagsmith/flagsmith-go-client/v5"
+	"github.com/Flagsmith/flagsmith-go-client/v5/fixtures"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetFlagReturnsErrFeatureNotFound(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(fixtures.EnvironmentDocumentHandler))
+	defer server.Close()
+
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithLocalEvaluation(ctx),
+		flagsmith.WithBaseURL(server.URL+"/api/v1/"))
+	assert.NoError(t, client.UpdateEnvironment(ctx))
+	flags, err := client.GetEnvironmentFlags(ctx)
+	assert.NoError(t, err)
+
+	// When
+	_, err = flags.GetFlag("feature_that_does_not_exist")
+
+	// Then
+	assert.ErrorIs(t, err, flagsmith.ErrFeatureNotFound)
+	var clientErr *flagsmith.FlagsmithClientError
+	assert.True(t, errors.As(err, &clientErr))
+}
+
+func TestGetFlagsReturnsErrEnvironmentNotReady(t *testing.T) {
+	// Given
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithLocalEvaluation(ctx),
+		flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithEnvironmentRefreshInterval(time.Hour))
+
+	// When
+	_, err := client.GetEnvironmentFlags(ctx)
+
+	// Then
+	assert.ErrorIs(t, err, flagsmith.ErrEnvironmentNotReady)
+	var clientErr *flagsmith.FlagsmithClientError
+	assert.True(t, errors.As(err, &clientErr))
+}
+
+func TestGetIdentitySegmentsReturnsErrLocalEvaluationRequired(t *testing.T) {
+	// Given
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey)
+
+	// When
+	_, err := client.GetIdentitySegments("test_identity", nil)
+
+	// Then
+	assert.ErrorIs(t, err, flagsmith.ErrLocalEvaluationRequired)
+}
+
+func TestBulkIdentifyReturnsErrBatchTooLarge(t *testing.T) {
+	// Given
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey)
+	batch := make([]*flagsmith.IdentityTraits, flagsmith.BulkIdentifyMaxCount+1)
+
+	// When
+	err := client.BulkIdentify(context.Background(), batch)
+
+	// Then
+	assert.ErrorIs(t, err, flagsmith.ErrBatchTooLarge)
+}
+
+func TestFlagsmithAPIErrorDescribesTheFailedRequest(t *testing.T) {
+	// Given
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Retry-After", "30")
+		rw.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"))
+
+	// When
+	_, err := client.GetIdentityFlags(context.Background(), "test_identity", nil)
+
+	// Then
+	var apiErr *flagsmith.FlagsmithAPIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.MethodPost, apiErr.Method)
+	assert.Equal(t, server.URL+"/api/v1/identities/", apiErr.Endpoint)
+	assert.Equal(t, http.StatusTooManyRequests, apiErr.ResponseStatusCode)
+	assert.Equal(t, 30*time.Second, apiErr.RetryAfter)
+}
+
+func TestFlagsmithAPIErrorUnwrapsRequestError(t *testing.T) {
+	// Given
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// When
+	_, err := client.GetEnvironmentFlagsFromAPI(ctx)
+
+	// Then
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	var apiErr *flagsmith.FlagsmithAPIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.MethodGet, apiErr.Method)
+	assert.Zero(t, apiErr.ResponseStatusCode)
+}
+
+func TestClosedClientReturnsErrClientClosed(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(fixtures.EnvironmentDocumentHandler))
+	defer server.Close()
+
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithLocalEvaluation(ctx),
+		flagsmith.WithBaseURL(server.URL+"/api/v1/"))
+	assert.NoError(t, client.UpdateEnvironment(ctx))
+
+	// When
+	assert.NoError(t, client.Close())
+	assert.NoError(t, client.Close())
+
+	// Then
+	_, err := client.GetEnvironmentFlags(ctx)
+	assert.ErrorIs(t, err, flagsmith.ErrClientClosed)
+	_, err = client.GetIdentityFlags(ctx, "test_identity", nil)
+	assert.ErrorIs(t, err, flagsmith.ErrClientClosed)
+	_, err = client.GetIdentitySegments("test_identity", nil)
+	assert.ErrorIs(t, err, flagsmith.ErrClientClosed)
+	assert.ErrorIs(t, client.UpdateEnvironment(ctx), flagsmith.ErrClientClosed)
+}
+
+func TestCloseFlushesAnalytics(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	analyticsRequests := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/api/v1/analytics/flags/" {
+			analyticsRequests <- struct{}{}
+			return
+		}
+		fixtures.EnvironmentDocumentHandler(rw, req)
+	}))
+	defer server.Close()
+
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithLocalEvaluation(ctx),
+		flagsmith.WithAnalytics(ctx), flagsmith.WithBaseURL(server.URL+"/api/v1/"))
+	assert.NoError(t, client.UpdateEnvironment(ctx))
+	flags, err := client.GetEnvironmentFlags(ctx)
+	assert.NoError(t, err)
+	_, err = flags.GetFlag(fixtures.Feature1Name)
+	assert.NoError(t, err)
+
+	// When
+	err = client.Close()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Len(t, analyticsRequests, 1)
+}
@@ -2,16 +2,36 @@ package flagsmith
 
 // EvaluationContext represents a context in which feature flags can be evaluated.
 // Flagsmith flags are always evaluated in an EnvironmentEvaluationContext, with an optional IdentityEvaluationContext.
+//
+// When flags are evaluated locally, segment conditions can address the context using JSONPath
+// properties, in addition to plain trait names:
+//
+//   - $.environment.key: the client-side key of the environment document in use
+//   - $.environment.name: the name of the environment
+//   - $.identity.identifier: the identifier of the identity
+//   - $.identity.key: the key used for % split segmentation, "<environment key>_<identifier>"
+//   - $.identity.traits.<name>: the value of a trait
+//   - $.custom.<name>: an attribute from Custom, e.g. $.custom.device.os
+//
+// Segments only apply to identities, so Custom attributes are ignored when evaluating
+// environment flags.
 type EvaluationContext struct {
 	Environment *EnvironmentEvaluationContext `json:"environment,omitempty"`
 	Identity    *IdentityEvaluationContext    `json:"identity,omitempty"`
 	Feature     *FeatureEvaluationContext     `json:"feature,omitempty"`
+	// Custom holds application-defined attributes, such as request metadata, device information or
+	// the tenant, which segment conditions can target using JSONPath properties like $.custom.tenant.plan.
+	// Values can be primitives, maps, slices or structs, whose fields are addressed by their JSON names.
+	// Custom attributes are only used by local evaluation, and are not sent to the Flagsmith API.
+	Custom map[string]any `json:"custom,omitempty"`
 }
 
 // EnvironmentEvaluationContext represents a Flagsmith environment used in an EvaluationContext.
-// It is ignored if the evaluating Client was created using WithLocalEvaluation.
+// It is ignored if the evaluating Client was created using WithLocalEvaluation, and selects the
+// environment to evaluate flags in when using a MultiClient.
 type EnvironmentEvaluationContext struct {
 	// APIKey is an identifier for this environment. It is also known as the environment ID or client-side SDK key.
+	// A MultiClient requires the server-side key of the environment.
 	APIKey string `json:"api_key"`
 }
 
@@ -1,5 +1,10 @@
 package flagsmith
 
+import (
+	"context"
+	"time"
+)
+
 // This file exports internal functions for testing purposes only.
 // It is compiled only when running tests (no build tags needed).
 
@@ -7,3 +12,30 @@ package flagsmith
 func GetUserAgentForTest() string {
 	return getUserAgent()
 }
+
+// EngineEvaluationContextForTest returns the evaluation context mapped from the client's
+// environment, so that external tests can tell whether it was mapped again.
+func EngineEvaluationContextForTest(c *Client) any {
+	return c.engineEvaluationContext.Load()
+}
+
+// MarkEnvironmentUpdatedForTest records a successful update of the client's environment at the
+// given time, so that external tests can make it stale without waiting.
+func MarkEnvironmentUpdatedForTest(c *Client, at time.Time) {
+	c.markEnvironmentUpdated(at)
+}
+
+// PinEnvironmentForTest returns the client of a MultiClient's environment as GetFlags does,
+// keeping it open until unpin is called.
+func PinEnvironmentForTest(m *MultiClient, ctx context.Context, apiKey string) (c *Client, unpin func(), err error) {
+	env, err := m.pin(ctx, apiKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return env.client, func() { m.unpin(env) }, nil
+}
+
+// EvictEnvironmentsForTest evicts every environment of a MultiClient, as if they were idle.
+func EvictEnvironmentsForTest(m *MultiClient) {
+	m.evictEnvironmentsUnusedSince(time.Now().Add(time.Hour))
+}
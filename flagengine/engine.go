@@ -6,7 +6,6 @@ import (
 	"sort"
 
 	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/engine_eval"
-	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/utils"
 )
 
 type featureContextWithSegmentName struct {
@@ -21,13 +20,13 @@ func getPriorityOrDefault(priority *float64) float64 {
 	return math.Inf(1) // Weakest possible priority
 }
 
-func getMatchingSegmentsAndOverrides(ec *engine_eval.EngineEvaluationContext) ([]engine_eval.SegmentResult, map[string]featureContextWithSegmentName) {
+func getMatchingSegmentsAndOverrides(ec *engine_eval.EngineEvaluationContext, opts []engine_eval.EvaluationOption) ([]engine_eval.SegmentResult, map[string]featureContextWithSegmentName) {
 	segmentResults := []engine_eval.SegmentResult{}
 	featureOverrides := make(map[string]featureContextWithSegmentName)
 
 	// Process segments in deterministic order (sorted by key)
 	for _, segmentContext := range getSortedSegments(ec.Segments) {
-		if !engine_eval.IsContextInSegment(ec, &segmentContext) {
+		if !engine_eval.IsContextInSegment(ec, &segmentContext, opts...) {
 			continue
 		}
 
@@ -82,7 +81,7 @@ func applySegmentOverrides(segment *engine_eval.SegmentContext, featureOverrides
 	}
 }
 
-func getFlagResults(ec *engine_eval.EngineEvaluationContext, featureOverrides map[string]featureContextWithSegmentName) map[string]*engine_eval.FlagResult {
+func getFlagResults(ec *engine_eval.EngineEvaluationContext, featureOverrides map[string]featureContextWithSegmentName, o *engine_eval.EvaluationOptions) map[string]*engine_eval.FlagResult {
 	flags := make(map[string]*engine_eval.FlagResult)
 
 	// Get identity key if identity exists
@@ -105,7 +104,7 @@ func getFlagResults(ec *engine_eval.EngineEvaluationContext, featureOverrides ma
 				featureContext = *override.featureContext
 				reason = fmt.Sprintf("TARGETING_MATCH; segment=%s", override.segmentName)
 			}
-			flagResult := getFlagResultFromFeatureContext(featureName, &featureContext, identityKey, reason)
+			flagResult := getFlagResultFromFeatureContext(featureName, &featureContext, identityKey, reason, o)
 			flags[featureName] = &flagResult
 		}
 	}
@@ -114,12 +113,12 @@ func getFlagResults(ec *engine_eval.EngineEvaluationContext, featureOverrides ma
 }
 
 // GetEvaluationResult computes flags and matched segments.
-func GetEvaluationResult(ec *engine_eval.EngineEvaluationContext) engine_eval.EvaluationResult {
+func GetEvaluationResult(ec *engine_eval.EngineEvaluationContext, opts ...engine_eval.EvaluationOption) engine_eval.EvaluationResult {
 	// Process segments and get overrides
-	segmentResults, featureOverrides := getMatchingSegmentsAndOverrides(ec)
+	segmentResults, featureOverrides := getMatchingSegmentsAndOverrides(ec, opts)
 
 	// Get flag results
-	flags := getFlagResults(ec, featureOverrides)
+	flags := getFlagResults(ec, featureOverrides, engine_eval.NewEvaluationOptions(opts...))
 
 	return engine_eval.EvaluationResult{
 		Flags:    flags,
@@ -128,7 +127,7 @@ func GetEvaluationResult(ec *engine_eval.EngineEvaluationContext) engine_eval.Ev
 }
 
 // getFlagResultFromFeatureContext creates a FlagResult from a FeatureContext.
-func getFlagResultFromFeatureContext(featureName string, featureContext *engine_eval.FeatureContext, identityKey *string, reason string) engine_eval.FlagResult {
+func getFlagResultFromFeatureContext(featureName string, featureContext *engine_eval.FeatureContext, identityKey *string, reason string, o *engine_eval.EvaluationOptions) engine_eval.FlagResult {
 	value := featureContext.Value
 
 	// Handle multivariate features
@@ -138,17 +137,11 @@ func getFlagResultFromFeatureContext(featureName string, featureContext *engine_
 
 		// Calculate hash percentage for the identity and feature combination
 		objectIds := []string{featureContext.Key, *identityKey}
-		hashPercentage := utils.GetHashedPercentageForObjectIds(objectIds, 1)
-
-		// Select variant based on weighted distribution
-		cumulativeWeight := 0.0
-		for _, variant := range sortedVariants {
-			cumulativeWeight += variant.Weight
-			if hashPercentage <= cumulativeWeight {
-				value = variant.Value
-				reason = fmt.Sprintf("SPLIT; weight=%g", variant.Weight)
-				break
-			}
+		hashPercentage := o.HashedPercentage(objectIds)
+
+		if i := selectVariant(sortedVariants, hashPercentage); i >= 0 {
+			value = sortedVariants[i].Value
+			reason = fmt.Sprintf("SPLIT; weight=%g", sortedVariants[i].Weight)
 		}
 	}
 
@@ -163,6 +156,19 @@ func getFlagResultFromFeatureContext(featureName string, featureContext *engine_
 	return flagResult
 }
 
+// selectVariant returns the index of the variant whose cumulative weight range contains the
+// hash percentage, or -1 if the identity falls outside all variants and receives the control value.
+func selectVariant(sortedVariants []engine_eval.FeatureValue, hashPercentage float64) int {
+	cumulativeWeight := 0.0
+	for i, variant := range sortedVariants {
+		cumulativeWeight += variant.Weight
+		if hashPercentage <= cumulativeWeight {
+			return i
+		}
+	}
+	return -1
+}
+
 // getSortedVariantsByPriority returns a copy of variants sorted by priority (lower priority number = higher priority).
 // Variants without priority are treated as having the weakest priority (placed at the end).
 func getSortedVariantsByPriority(variants []engine_eval.FeatureValue) []engine_eval.FeatureValue {
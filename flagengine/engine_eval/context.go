@@ -7,6 +7,10 @@ import (
 )
 
 // A context object containing the necessary information to evaluate Flagsmith feature flags.
+//
+// Segment conditions whose property starts with "$." address the context using JSONPath,
+// based on the JSON names of its fields, e.g. $.environment.name or $.custom.tenant.plan.
+// Other properties are trait names.
 type EngineEvaluationContext struct {
 	// Environment context required for evaluation.
 	Environment EnvironmentContext `json:"environment"`
@@ -16,6 +20,9 @@ type EngineEvaluationContext struct {
 	Identity *IdentityContext `json:"identity,omitempty"`
 	// Segments applicable to the evaluation context.
 	Segments map[string]SegmentContext `json:"segments,omitempty"`
+	// Application-defined attributes which segment conditions can address using JSONPath,
+	// e.g. $.custom.device.os. Values may be primitives, maps, slices or structs.
+	Custom map[string]any `json:"custom,omitempty"`
 }
 
 // Environment context required for evaluation.
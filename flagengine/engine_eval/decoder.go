@@ -0,0 +1,192 @@
+package engine_eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/environments"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/identities"
+)
+
+// identityOverridesField is the field of the environment document holding identity overrides.
+const identityOverridesField = "identity_overrides"
+
+// EnvironmentDocumentDecoder builds the EngineEvaluationContext of an environment document
+// while streaming it, in one or more pages, as returned by the environment-document API.
+// Identity overrides are grouped into segments as they are decoded, so that the document is
+// never held in memory as a whole.
+type EnvironmentDocumentDecoder struct {
+	// KeepIdentityOverrides keeps the decoded identity overrides in the environment returned by
+	// Environment, e.g. to save it as a snapshot, at the cost of holding them in memory.
+	KeepIdentityOverrides bool
+
+	env        environments.EnvironmentModel
+	pages      int
+	identities int
+	overrides  identityOverrideGroups
+}
+
+// NewEnvironmentDocumentDecoder returns a decoder for a new environment document.
+func NewEnvironmentDocumentDecoder() *EnvironmentDocumentDecoder {
+	return &EnvironmentDocumentDecoder{}
+}
+
+// DecodePage decodes the next page of the environment document from r. The environment is
+// taken from the first page, while further pages only contribute identity overrides.
+// If decoding fails, the decoder is left as it was before the page, so that the page can be
+// decoded again.
+func (d *EnvironmentDocumentDecoder) DecodePage(r io.Reader) error {
+	identities := d.identities
+	keptOverrides := len(d.env.IdentityOverrides)
+	groups := d.overrides.checkpoint()
+	if err := d.decodePage(r); err != nil {
+		d.identities = identities
+		d.env.IdentityOverrides = d.env.IdentityOverrides[:keptOverrides]
+		d.overrides.restore(groups)
+		return err
+	}
+	d.pages++
+	return nil
+}
+
+func (d *EnvironmentDocumentDecoder) decodePage(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	first := d.pages == 0
+
+	// Fields other than identity overrides are small, and decoded into the environment at once.
+	fields := make(map[string]json.RawMessage)
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return fmt.Errorf("unexpected token %v in environment document", token)
+		}
+		if key == identityOverridesField {
+			if err := d.decodeIdentityOverrides(dec); err != nil {
+				return err
+			}
+			continue
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		fields[key] = value
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return err
+	}
+	if !first {
+		return nil
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	overrides := d.env.IdentityOverrides
+	if err := json.Unmarshal(data, &d.env); err != nil {
+		return err
+	}
+	d.env.IdentityOverrides = overrides
+	return nil
+}
+
+// decodeIdentityOverrides decodes an array of identity overrides, one identity at a time.
+func (d *EnvironmentDocumentDecoder) decodeIdentityOverrides(dec *json.Decoder) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("unexpected token %v for %s in environment document", token, identityOverridesField)
+	}
+	for dec.More() {
+		d.identities++
+		if d.KeepIdentityOverrides {
+			identity := &identities.IdentityModel{}
+			if err := dec.Decode(identity); err != nil {
+				return err
+			}
+			d.overrides.add(identity.Identifier, mapIdentityFeaturesToOverrides(identity.IdentityFeatures))
+			d.env.IdentityOverrides = append(d.env.IdentityOverrides, identity)
+			continue
+		}
+		var identity identityOverride
+		if err := dec.Decode(&identity); err != nil {
+			return err
+		}
+		d.overrides.add(identity.Identifier, identity.overrides())
+	}
+	return expectDelim(dec, ']')
+}
+
+// identityOverride holds the fields of an identity override needed for evaluation, which are
+// cheaper to decode than an identities.IdentityModel.
+type identityOverride struct {
+	Identifier       string `json:"identifier"`
+	IdentityFeatures []struct {
+		Feature struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+		} `json:"feature"`
+		Enabled  bool `json:"enabled"`
+		RawValue any  `json:"feature_state_value"`
+	} `json:"identity_features"`
+}
+
+func (i *identityOverride) overrides() overridesKeyList {
+	var overrides overridesKeyList
+	for _, featureState := range i.IdentityFeatures {
+		overrides = append(overrides, overridesKey{
+			featureName:  featureState.Feature.Name,
+			enabled:      featureState.Enabled,
+			featureValue: featureState.RawValue,
+			featureID:    featureState.Feature.ID,
+		})
+	}
+	return overrides
+}
+
+// Environment returns the decoded environment. Its identity overrides are only set if
+// KeepIdentityOverrides is.
+func (d *EnvironmentDocumentDecoder) Environment() *environments.EnvironmentModel {
+	return &d.env
+}
+
+// IdentityOverrideCount returns the number of identity overrides decoded so far.
+func (d *EnvironmentDocumentDecoder) IdentityOverrideCount() int {
+	return d.identities
+}
+
+// EvaluationContext returns the evaluation context of the decoded environment, equal to the
+// result of MapEnvironmentDocumentToEvaluationContext for the whole document.
+func (d *EnvironmentDocumentDecoder) EvaluationContext() EngineEvaluationContext {
+	env := d.env
+	env.IdentityOverrides = nil
+	ctx := MapEnvironmentDocumentToEvaluationContext(&env)
+	if d.identities > 0 {
+		addSegments(&ctx, d.overrides.segments())
+	}
+	return ctx
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != want {
+		return fmt.Errorf("unexpected token %v in environment document, expected %v", token, want)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package engine_eval
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/environments"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// generateEnvironmentDocument returns the pages of an environment document with the given number
+// of identity overrides, spread across a few distinct sets of feature overrides.
+func generateEnvironmentDocument(identityOverrides, pages int) [][]byte {
+	const header = `"id": 1, "name": "Generated", "api_key": "generated-key", "updated_at": "2026-10-18T12:00:00Z",
+		"project": {"id": 1, "name": "Project", "hide_disabled_flags": false, "organisation": {"id": 1, "name": "Org"},
+			"segments": [{"id": 1, "name": "segment", "rules": [{"type": "ALL", "rules": [],
+				"conditions": [{"operator": "EQUAL", "property_": "plan", "value": "pro"}]}]}]},
+		"feature_states": [
+			{"feature": {"id": 1, "name": "feature_1", "type": "STANDARD"}, "enabled": true,
+				"featurestate_uuid": "fs-1", "feature_state_value": "default", "multivariate_feature_state_values": []},
+			{"feature": {"id": 2, "name": "feature_2", "type": "STANDARD"}, "enabled": false,
+				"featurestate_uuid": "fs-2", "feature_state_value": 7, "multivariate_feature_state_values": []}
+		]`
+	result := make([][]byte, pages)
+	perPage := (identityOverrides + pages - 1) / pages
+	for page := range pages {
+		var b strings.Builder
+		b.WriteString("{")
+		if page == 0 {
+			b.WriteString(header)
+		} else {
+			b.WriteString(`"api_key": "generated-key"`)
+		}
+		b.WriteString(`, "identity_overrides": [`)
+		for i := page * perPage; i < min((page+1)*perPage, identityOverrides); i++ {
+			if i > page*perPage {
+				b.WriteString(",")
+			}
+			fmt.Fprintf(&b, `{"identifier": "identity-%[1]d", "identity_uuid": "uuid-%[1]d",
+				"environment_api_key": "generated-key", "created_date": "2026-10-18T12:00:00Z", "identity_traits": [],
+				"identity_features": [
+					{"feature": {"id": 1, "name": "feature_1", "type": "STANDARD"}, "enabled": %[2]t,
+						"featurestate_uuid": "override-%[1]d", "feature_state_value": "value-%[3]d"}
+				]}`, i, i%2 == 0, i%5)
+		}
+		b.WriteString("]}")
+		result[page] = []byte(b.String())
+	}
+	return result
+}
+
+// mapEnvironmentDocumentPages decodes the pages into a single environment model, then maps it.
+func mapEnvironmentDocumentPages(t testing.TB, pages [][]byte) EngineEvaluationContext {
+	var env environments.EnvironmentModel
+	for i, data := range pages {
+		var page environments.EnvironmentModel
+		require.NoError(t, json.Unmarshal(data, &page))
+		if i == 0 {
+			env = page
+		} else {
+			env.IdentityOverrides = append(env.IdentityOverrides, page.IdentityOverrides...)
+		}
+	}
+	return MapEnvironmentDocumentToEvaluationContext(&env)
+}
+
+// decodeEnvironmentDocumentPages streams the pages through an EnvironmentDocumentDecoder.
+func decodeEnvironmentDocumentPages(t testing.TB, pages [][]byte) *EnvironmentDocumentDecoder {
+	d := NewEnvironmentDocumentDecoder()
+	for _, data := range pages {
+		require.NoError(t, d.DecodePage(bytes.NewReader(data)))
+	}
+	return d
+}
+
+func TestEnvironmentDocumentDecoderMatchesMapper(t *testing.T) {
+	// Given
+	pages := generateEnvironmentDocument(1000, 3)
+
+	// When
+	d := decodeEnvironmentDocumentPages(t, pages)
+
+	// Then
+	expected := mapEnvironmentDocumentPages(t, pages)
+	assert.Equal(t, expected, d.EvaluationContext())
+	assert.Len(t, expected.Segments, 11)
+	assert.Equal(t, "generated-key", d.Environment().APIKey)
+	assert.Equal(t, "Generated", d.Environment().Name)
+	assert.Len(t, d.Environment().FeatureStates, 2)
+	assert.Empty(t, d.Environment().IdentityOverrides)
+}
+
+func TestEnvironmentDocumentDecoderKeepsIdentityOverrides(t *testing.T) {
+	// Given
+	pages := generateEnvironmentDocument(10, 2)
+	d := NewEnvironmentDocumentDecoder()
+	d.KeepIdentityOverrides = true
+
+	// When
+	for _, data := range pages {
+		require.NoError(t, d.DecodePage(bytes.NewReader(data)))
+	}
+
+	// Then
+	require.Len(t, d.Environment().IdentityOverrides, 10)
+	assert.Equal(t, "identity-9", d.Environment().IdentityOverrides[9].Identifier)
+}
+
+func TestEnvironmentDocumentDecoderWithoutIdentityOverrides(t *testing.T) {
+	// Given
+	data := []byte(`{"api_key": "key", "feature_states": [], "identity_overrides": null}`)
+
+	// When
+	d := NewEnvironmentDocumentDecoder()
+	err := d.DecodePage(bytes.NewReader(data))
+
+	// Then
+	require.NoError(t, err)
+	var env environments.EnvironmentModel
+	require.NoError(t, json.Unmarshal(data, &env))
+	assert.Equal(t, MapEnvironmentDocumentToEvaluationContext(&env), d.EvaluationContext())
+}
+
+func TestEnvironmentDocumentDecoderRejectsInvalidDocuments(t *testing.T) {
+	for _, data := range []string{
+		`[]`,
+		`{"identity_overrides": {}}`,
+		`{"identity_overrides": [{"identifier": 1}]}`,
+		`{"api_key": "key"`,
+	} {
+		t.Run(data, func(t *testing.T) {
+			assert.Error(t, NewEnvironmentDocumentDecoder().DecodePage(strings.NewReader(data)))
+		})
+	}
+}
+
+func TestEnvironmentDocumentDecoderRetriesFailedPage(t *testing.T) {
+	// Given
+	pages := generateEnvironmentDocument(100, 2)
+	d := NewEnvironmentDocumentDecoder()
+	d.KeepIdentityOverrides = true
+	require.NoError(t, d.DecodePage(bytes.NewReader(pages[0])))
+
+	// When
+	err := d.DecodePage(bytes.NewReader(pages[1][:len(pages[1])/2]))
+	require.Error(t, err)
+	require.NoError(t, d.DecodePage(bytes.NewReader(pages[1])))
+
+	// Then
+	assert.Equal(t, mapEnvironmentDocumentPages(t, pages), d.EvaluationContext())
+	assert.Equal(t, 100, d.IdentityOverrideCount())
+	assert.Len(t, d.Environment().IdentityOverrides, 100)
+}
+
+// The benchmarks compare decoding a document with 50,000 identity overrides in 5 pages into
+// environment models before mapping them, with streaming it through an EnvironmentDocumentDecoder.
+
+func BenchmarkMapEnvironmentDocument(b *testing.B) {
+	pages := generateEnvironmentDocument(50_000, 5)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		mapEnvironmentDocumentPages(b, pages)
+	}
+}
+
+func BenchmarkDecodeEnvironmentDocument(b *testing.B) {
+	pages := generateEnvironmentDocument(50_000, 5)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		decodeEnvironmentDocumentPages(b, pages).EvaluationContext()
+	}
+}
@@ -7,17 +7,17 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/utils"
 	"github.com/ohler55/ojg/jp"
 )
 
 // IsContextInSegment determines if the given evaluation context matches the segment rules.
-func IsContextInSegment(ec *EngineEvaluationContext, segmentContext *SegmentContext) bool {
+func IsContextInSegment(ec *EngineEvaluationContext, segmentContext *SegmentContext, opts ...EvaluationOption) bool {
 	if len(segmentContext.Rules) == 0 {
 		return false
 	}
+	o := NewEvaluationOptions(opts...)
 	for i := range segmentContext.Rules {
-		if !contextMatchesSegmentRule(ec, &segmentContext.Rules[i], segmentContext.Key) {
+		if !contextMatchesSegmentRule(ec, &segmentContext.Rules[i], segmentContext.Key, o) {
 			return false
 		}
 	}
@@ -25,9 +25,9 @@ func IsContextInSegment(ec *EngineEvaluationContext, segmentContext *SegmentCont
 }
 
 // Returns true if conditions match according to the rule type.
-func matchesConditionsByRuleType(ec *EngineEvaluationContext, conditions []Condition, ruleType Type, segmentKey string) bool {
+func matchesConditionsByRuleType(ec *EngineEvaluationContext, conditions []Condition, ruleType Type, segmentKey string, o *EvaluationOptions) bool {
 	for i := range conditions {
-		conditionMatches := contextMatchesCondition(ec, &conditions[i], segmentKey)
+		conditionMatches := contextMatchesCondition(ec, &conditions[i], segmentKey, o)
 
 		switch ruleType {
 		case All:
@@ -51,23 +51,23 @@ func matchesConditionsByRuleType(ec *EngineEvaluationContext, conditions []Condi
 	return ruleType != Any
 }
 
-func contextMatchesSegmentRule(ec *EngineEvaluationContext, segmentRule *SegmentRule, segmentKey string) bool {
+func contextMatchesSegmentRule(ec *EngineEvaluationContext, segmentRule *SegmentRule, segmentKey string, o *EvaluationOptions) bool {
 	if len(segmentRule.Conditions) > 0 {
-		if !matchesConditionsByRuleType(ec, segmentRule.Conditions, segmentRule.Type, segmentKey) {
+		if !matchesConditionsByRuleType(ec, segmentRule.Conditions, segmentRule.Type, segmentKey, o) {
 			return false
 		}
 	}
 
-	return matchesSubRulesByRuleType(ec, segmentRule.Rules, segmentRule.Type, segmentKey)
+	return matchesSubRulesByRuleType(ec, segmentRule.Rules, segmentRule.Type, segmentKey, o)
 }
 
 // matchesSubRulesByRuleType evaluates sub-rules using the parent rule's type (ALL/ANY/NONE).
-func matchesSubRulesByRuleType(ec *EngineEvaluationContext, subRules []SegmentRule, ruleType Type, segmentKey string) bool {
+func matchesSubRulesByRuleType(ec *EngineEvaluationContext, subRules []SegmentRule, ruleType Type, segmentKey string, o *EvaluationOptions) bool {
 	if len(subRules) == 0 {
 		return true
 	}
 	for i := range subRules {
-		subRuleMatches := contextMatchesSegmentRule(ec, &subRules[i], segmentKey)
+		subRuleMatches := contextMatchesSegmentRule(ec, &subRules[i], segmentKey, o)
 		switch ruleType {
 		case All:
 			if !subRuleMatches {
@@ -88,7 +88,7 @@ func matchesSubRulesByRuleType(ec *EngineEvaluationContext, subRules []SegmentRu
 	return ruleType != Any
 }
 
-func matchPercentageSplit(ec *EngineEvaluationContext, segmentCondition *Condition, segmentKey string, contextValue ContextValue) bool {
+func matchPercentageSplit(ec *EngineEvaluationContext, segmentCondition *Condition, segmentKey string, contextValue ContextValue, o *EvaluationOptions) bool {
 	var objectIds []string
 
 	if contextValue != nil {
@@ -106,35 +106,29 @@ func matchPercentageSplit(ec *EngineEvaluationContext, segmentCondition *Conditi
 			if err != nil {
 				return false
 			}
-			return utils.GetHashedPercentageForObjectIds(objectIds, 1) <= floatValue
+			return o.HashedPercentage(objectIds) <= floatValue
 		}
 	}
 	return false
 }
 
-func contextMatchesCondition(ec *EngineEvaluationContext, segmentCondition *Condition, segmentKey string) bool {
+func contextMatchesCondition(ec *EngineEvaluationContext, segmentCondition *Condition, segmentKey string, o *EvaluationOptions) bool {
+	match, ok := o.operators().Lookup(segmentCondition.Operator)
+	if !ok {
+		// Unknown operators are reported by Validate when the environment is loaded
+		return false
+	}
 	var contextValue ContextValue
 	if segmentCondition.Property != "" {
 		contextValue = getContextValue(ec, segmentCondition.Property)
 	}
-	if segmentCondition.Operator == PercentageSplit {
-		return matchPercentageSplit(ec, segmentCondition, segmentKey, contextValue)
-	}
-	if segmentCondition.Operator == In {
-		return matchInOperator(segmentCondition, contextValue)
-	}
-	if segmentCondition.Operator == IsNotSet {
-		return contextValue == nil
-	}
-	if segmentCondition.Operator == IsSet {
-		return contextValue != nil
-	}
-	if contextValue != nil && segmentCondition.Value != nil {
-		if strValue, ok := segmentCondition.Value.(string); ok {
-			return parseAndMatch(segmentCondition.Operator, ToString(contextValue), strValue)
-		}
-	}
-	return false
+	return match(&OperatorArgs{
+		Context:      ec,
+		Condition:    segmentCondition,
+		SegmentKey:   segmentKey,
+		ContextValue: contextValue,
+		Options:      o,
+	})
 }
 
 // matchInOperator handles the IN operator for segment conditions, supporting both StringArray and comma-separated strings.
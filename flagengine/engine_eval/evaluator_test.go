@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -335,6 +336,58 @@ func TestContextMatchesCondition(t *testing.T) {
 	}
 }
 
+func TestContextMatchesConditionWithTypedTraits(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name           string
+		operator       engine_eval.Operator
+		conditionValue string
+		traitValue     any
+		untyped        bool
+		typed          bool
+	}{
+		{"string true equals string condition", engine_eval.Equal, "true", "true", true, true},
+		{"string 1 does not equal true", engine_eval.Equal, "true", "1", true, false},
+		{"bool true equals true", engine_eval.Equal, "true", true, true, true},
+		{"bool false equals false", engine_eval.Equal, "false", false, true, true},
+		{"bool condition is true unless false", engine_eval.Equal, "1", true, true, true},
+		{"int equals int", engine_eval.Equal, "12", 12, true, true},
+		{"int does not equal float", engine_eval.Equal, "12.0", 12, true, false},
+		{"float equals int string", engine_eval.Equal, "12", 12.0, true, true},
+		{"string numbers compare as strings", engine_eval.GreaterThan, "10", "9", false, true},
+		{"int numbers compare as numbers", engine_eval.GreaterThan, "10", 9, false, false},
+		{"int greater than", engine_eval.GreaterThan, "10", 11, true, true},
+		{"int with unparsable condition", engine_eval.GreaterThan, "abc", 11, false, false},
+		{"modulo on string trait", engine_eval.Modulo, "2|0", "4", true, false},
+		{"modulo on int trait", engine_eval.Modulo, "2|0", 4, true, true},
+		{"contains on int trait", engine_eval.Contains, "1", 12, true, false},
+		{"in with int trait", engine_eval.In, "1,2,3", 2, true, true},
+		{"in with bool trait", engine_eval.In, "true,false", true, true, false},
+		{"in with float trait", engine_eval.In, "1.5", 1.5, true, false},
+		{"semver with string trait", engine_eval.GreaterThan, "1.0.0:semver", "1.2.0", true, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			evalContext := createEvaluationContext(map[string]any{
+				traitKey1: c.traitValue,
+			})
+			segmentContext := createSegmentContext("test", "test", []engine_eval.SegmentRule{
+				{
+					Type: engine_eval.All,
+					Conditions: []engine_eval.Condition{
+						{Operator: c.operator, Property: traitKey1, Value: c.conditionValue},
+					},
+				},
+			})
+
+			assert.Equal(t, c.untyped, engine_eval.IsContextInSegment(evalContext, segmentContext))
+			assert.Equal(t, c.typed, engine_eval.IsContextInSegment(evalContext, segmentContext, engine_eval.WithTypedTraits()))
+		})
+	}
+}
+
 func TestContextMatchesConditionInOperatorStringArray(t *testing.T) {
 	traitKey1 := "trait1"
 
@@ -448,11 +501,10 @@ func TestContextMatchesConditionPercentageSplit(t *testing.T) {
 
 			evalContext := createEvaluationContext(nil)
 
-			// Mock the hashing function
-			utils.MockSetHashedPercentageForObjectIds(func(_ []string, _ int) float64 {
+			// Bucket every identity at the same percentage
+			bucketing := utils.BucketingStrategyFunc(func(_ []string) float64 {
 				return c.identityHashedPercentage
 			})
-			defer utils.ResetMocks()
 
 			segmentContext := createSegmentContext("test-segment", "test", []engine_eval.SegmentRule{
 				{
@@ -461,7 +513,7 @@ func TestContextMatchesConditionPercentageSplit(t *testing.T) {
 				},
 			})
 
-			result := engine_eval.IsContextInSegment(evalContext, segmentContext)
+			result := engine_eval.IsContextInSegment(evalContext, segmentContext, engine_eval.WithBucketingStrategy(bucketing))
 			assert.Equal(t, c.expectedResult, result)
 		})
 	}
@@ -516,6 +568,62 @@ func TestGetContextValueIntegration(t *testing.T) {
 	})
 }
 
+func TestGetContextValueJSONPathEnvironmentAndCustom(t *testing.T) {
+	t.Parallel()
+
+	type device struct {
+		OS      string `json:"os"`
+		Version int    `json:"version"`
+	}
+	evalContext := createEvaluationContext(map[string]any{
+		"plan": "free",
+	})
+	evalContext.Custom = map[string]any{
+		"tenant":  map[string]any{"plan": "enterprise", "seats": 250},
+		"device":  device{OS: "ios", Version: 17},
+		"beta":    true,
+		"regions": []any{"eu", "us"},
+	}
+
+	cases := []struct {
+		name     string
+		operator engine_eval.Operator
+		property string
+		value    string
+		expected bool
+	}{
+		{"environment name", engine_eval.Equal, "$.environment.name", "Test Environment", true},
+		{"environment key", engine_eval.Equal, "$.environment.key", "test-env", true},
+		{"identity key", engine_eval.Equal, "$.identity.key", "test-env_test-user", true},
+		{"identity trait", engine_eval.Equal, "$.identity.traits.plan", "free", true},
+		{"custom map attribute", engine_eval.Equal, "$.custom.tenant.plan", "enterprise", true},
+		{"custom numeric attribute", engine_eval.GreaterThan, "$.custom.tenant.seats", "100", true},
+		{"custom struct attribute", engine_eval.Equal, "$.custom.device.os", "ios", true},
+		{"custom struct numeric attribute", engine_eval.LessThan, "$.custom.device.version", "16", false},
+		{"custom boolean attribute", engine_eval.Equal, "$.custom.beta", "true", true},
+		{"custom array element", engine_eval.Equal, "$.custom.regions[1]", "us", true},
+		{"custom attribute is set", engine_eval.IsSet, "$.custom.tenant.plan", "", true},
+		{"missing custom attribute", engine_eval.IsNotSet, "$.custom.tenant.owner", "", true},
+		{"custom object is not a value", engine_eval.IsSet, "$.custom.tenant", "", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			segmentContext := createSegmentContext("test", "test", []engine_eval.SegmentRule{
+				{
+					Type: engine_eval.All,
+					Conditions: []engine_eval.Condition{
+						{Operator: c.operator, Property: c.property, Value: c.value},
+					},
+				},
+			})
+
+			result := engine_eval.IsContextInSegment(evalContext, segmentContext)
+			assert.Equal(t, c.expected, result)
+		})
+	}
+}
+
 func TestToStringIntegration(t *testing.T) {
 	t.Parallel()
 
@@ -655,6 +763,71 @@ func TestSemverComparisons(t *testing.T) {
 	}
 }
 
+func TestDateComparisons(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	cases := []struct {
+		name           string
+		operator       engine_eval.Operator
+		traitValue     any
+		conditionValue string
+		expected       bool
+	}{
+		// Absolute dates
+		{"date before", engine_eval.LessThan, "2023-12-31T23:59:59Z", "2024-01-01T00:00:00Z:date", true},
+		{"date not before", engine_eval.LessThan, "2024-01-01T00:00:00Z", "2024-01-01T00:00:00Z:date", false},
+		{"date before inclusive", engine_eval.LessThanInclusive, "2024-01-01T00:00:00Z", "2024-01-01T00:00:00Z:date", true},
+		{"date after", engine_eval.GreaterThan, "2024-01-01T00:00:01Z", "2024-01-01:date", true},
+		{"date after inclusive", engine_eval.GreaterThanInclusive, "2024-01-01", "2024-01-01:date", true},
+		{"date equal across time zones", engine_eval.Equal, "2024-01-01T02:00:00+02:00", "2024-01-01T00:00:00Z:date", true},
+		{"date not equal", engine_eval.NotEqual, "2024-01-02", "2024-01-01:date", true},
+
+		// Epoch timestamps
+		{"epoch seconds trait", engine_eval.LessThan, int64(1704067199), "2024-01-01:date", true},
+		{"epoch float trait", engine_eval.GreaterThan, 1704067200.5, "2024-01-01:date", true},
+		{"epoch string trait", engine_eval.Equal, "1704067200", "2024-01-01:date", true},
+		{"epoch condition", engine_eval.Equal, "2024-01-01T00:00:00Z", "1704067200:date", true},
+
+		// Relative dates
+		{"after now", engine_eval.GreaterThan, "2024-06-15T12:00:01Z", "now:date", true},
+		{"within the next 7 days", engine_eval.LessThan, "2024-06-20T00:00:00Z", "now+7d:date", true},
+		{"not within the next 7 days", engine_eval.LessThan, "2024-06-23T00:00:00Z", "now+7d:date", false},
+		{"older than 2 weeks", engine_eval.LessThan, "2024-05-31T00:00:00Z", "now-2w:date", true},
+		{"within the last 36 hours", engine_eval.GreaterThanInclusive, "2024-06-14T00:00:00Z", "now-36h:date", true},
+
+		// Invalid values
+		{"invalid trait", engine_eval.LessThan, "yesterday", "2024-01-01:date", false},
+		{"invalid condition", engine_eval.LessThan, "2023-01-01", "last year:date", false},
+		{"invalid relative condition", engine_eval.LessThan, "2023-01-01", "now~7d:date", false},
+		{"relative condition out of range", engine_eval.GreaterThan, "2023-01-01", "now-1000000w:date", false},
+		{"bool trait", engine_eval.LessThan, true, "2024-01-01:date", false},
+		{"unsupported operator", engine_eval.Contains, "2024-01-01", "2024-01-01:date", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			evalContext := createEvaluationContext(map[string]any{
+				"created_at": c.traitValue,
+			})
+
+			segmentContext := createSegmentContext("test", "test", []engine_eval.SegmentRule{
+				{
+					Type: engine_eval.All,
+					Conditions: []engine_eval.Condition{
+						{Operator: c.operator, Property: "created_at", Value: c.conditionValue},
+					},
+				},
+			})
+
+			result := engine_eval.IsContextInSegment(evalContext, segmentContext, engine_eval.WithClock(clock))
+			assert.Equal(t, c.expected, result)
+		})
+	}
+}
+
 func TestComplexSegmentRules(t *testing.T) {
 	t.Parallel()
 
@@ -5,7 +5,9 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/utils"
 	"github.com/blang/semver/v4"
 )
 
@@ -147,6 +149,62 @@ func parseAndMatch(operator Operator, traitValue, conditionValue string) bool {
 	return dispatchOperator(operator, traitValue, conditionValue)
 }
 
+// matchTypedValue compares a trait value with a condition value according to the type of the
+// trait value, following the Flagsmith engine specification. The condition value is parsed
+// into the trait's type, and the condition does not match if it cannot be parsed.
+func matchTypedValue(operator Operator, contextValue ContextValue, conditionValue string) bool {
+	traitValue := utils.NormaliseTraitValue(contextValue)
+
+	switch operator {
+	case Modulo:
+		switch traitValue.(type) {
+		case int64, float64:
+			return evaluateModuloGeneric(ToString(traitValue), conditionValue)
+		}
+		return false
+	case Regex:
+		return evaluateRegexGeneric(ToString(traitValue), conditionValue)
+	case Contains, NotContains:
+		if s, ok := traitValue.(string); ok {
+			return parseAndMatch(operator, s, conditionValue)
+		}
+		return false
+	}
+
+	if strings.HasSuffix(conditionValue, ":semver") {
+		if s, ok := traitValue.(string); ok {
+			return parseAndMatch(operator, s, conditionValue)
+		}
+		return false
+	}
+
+	switch v := traitValue.(type) {
+	case string:
+		return dispatchOperator(operator, v, conditionValue)
+	case bool:
+		return dispatchComparableOperator(operator, v, conditionValue != "false" && conditionValue != "False")
+	case int64:
+		if i, err := strconv.ParseInt(conditionValue, 10, 64); err == nil {
+			return dispatchOperator(operator, v, i)
+		}
+	case float64:
+		if f, err := strconv.ParseFloat(conditionValue, 64); err == nil {
+			return dispatchOperator(operator, v, f)
+		}
+	}
+	return false
+}
+
+// isTypedInCandidate reports whether a typed trait value can match the IN operator.
+// Only strings and integers are compared against the list of condition values.
+func isTypedInCandidate(contextValue ContextValue) bool {
+	switch utils.NormaliseTraitValue(contextValue).(type) {
+	case string, int64:
+		return true
+	}
+	return false
+}
+
 // evaluateRegexGeneric performs regex matching on trait values.
 func evaluateRegexGeneric(traitValue, conditionValue string) bool {
 	match, err := regexp.Match(conditionValue, []byte(traitValue))
@@ -204,3 +262,114 @@ func evaluateSemverGeneric(operator Operator, traitValue string, conditionVersio
 	}
 	return false
 }
+
+// dateSuffix marks condition values which are compared as points in time.
+const dateSuffix = ":date"
+
+// evaluateDateGeneric handles date comparisons. The trait value may be an RFC3339 timestamp,
+// a date in the YYYY-MM-DD format, or a Unix timestamp in seconds given as a number or a string.
+// The condition value accepts the same formats, as well as times relative to now such as
+// "now", "now-7d" or "now+36h".
+func evaluateDateGeneric(operator Operator, traitValue ContextValue, conditionValue string, now time.Time) bool {
+	traitTime, ok := parseDateTraitValue(traitValue)
+	if !ok {
+		return false
+	}
+	conditionTime, ok := parseDateConditionValue(conditionValue, now)
+	if !ok {
+		return false
+	}
+	switch operator {
+	case Equal:
+		return traitTime.Equal(conditionTime)
+	case NotEqual:
+		return !traitTime.Equal(conditionTime)
+	case GreaterThan:
+		return traitTime.After(conditionTime)
+	case LessThan:
+		return traitTime.Before(conditionTime)
+	case GreaterThanInclusive:
+		return !traitTime.Before(conditionTime)
+	case LessThanInclusive:
+		return !traitTime.After(conditionTime)
+	}
+	return false
+}
+
+func parseDateTraitValue(traitValue ContextValue) (time.Time, bool) {
+	switch v := utils.NormaliseTraitValue(traitValue).(type) {
+	case int64:
+		return time.Unix(v, 0), true
+	case float64:
+		return unixFloatToTime(v), true
+	case string:
+		return parseAbsoluteDate(v)
+	}
+	return time.Time{}, false
+}
+
+func parseDateConditionValue(conditionValue string, now time.Time) (time.Time, bool) {
+	rest, ok := strings.CutPrefix(conditionValue, "now")
+	if !ok {
+		return parseAbsoluteDate(conditionValue)
+	}
+	if rest == "" {
+		return now, true
+	}
+	sign := rest[0]
+	if sign != '+' && sign != '-' {
+		return time.Time{}, false
+	}
+	d, ok := parseRelativeDuration(rest[1:])
+	if !ok {
+		return time.Time{}, false
+	}
+	if sign == '-' {
+		d = -d
+	}
+	return now.Add(d), true
+}
+
+func parseAbsoluteDate(value string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, true
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return unixFloatToTime(f), true
+	}
+	return time.Time{}, false
+}
+
+// parseRelativeDuration parses a Go duration string, additionally accepting a single
+// number of days ("7d") or weeks ("2w").
+func parseRelativeDuration(value string) (time.Duration, bool) {
+	var unit time.Duration
+	switch {
+	case strings.HasSuffix(value, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(value, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+	if unit != 0 {
+		f, err := strconv.ParseFloat(value[:len(value)-1], 64)
+		// Reject values that would not fit in a time.Duration, the conversion
+		// below would silently overflow otherwise.
+		if err != nil || f < 0 || f*float64(unit) >= math.MaxInt64 {
+			return 0, false
+		}
+		return time.Duration(f * float64(unit)), true
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, false
+	}
+	return d, true
+}
+
+func unixFloatToTime(f float64) time.Time {
+	seconds, fraction := math.Modf(f)
+	return time.Unix(int64(seconds), int64(fraction*1e9))
+}
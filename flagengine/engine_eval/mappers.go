@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"math"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
@@ -22,7 +23,8 @@ func MapEnvironmentDocumentToEvaluationContext(env *environments.EnvironmentMode
 	ctx := EngineEvaluationContext{}
 
 	// Environment
-	// map environment -> EnvironmentContext
+	// map environment -> EnvironmentContext, addressable as $.environment.key (the
+	// environment's client-side API key) and $.environment.name
 	ctx.Environment = EnvironmentContext{
 		Key:  env.APIKey,
 		Name: env.Name,
@@ -48,18 +50,22 @@ func MapEnvironmentDocumentToEvaluationContext(env *environments.EnvironmentMode
 
 	// Identity overrides (mapped to segments)
 	if len(env.IdentityOverrides) > 0 {
-		identitySegments := mapIdentityOverridesToSegments(env.IdentityOverrides)
-		if ctx.Segments == nil {
-			ctx.Segments = make(map[string]SegmentContext)
-		}
-		for key, segment := range identitySegments {
-			ctx.Segments[key] = segment
-		}
+		addSegments(&ctx, mapIdentityOverridesToSegments(env.IdentityOverrides))
 	}
 
 	return ctx
 }
 
+// addSegments adds segments to the context.
+func addSegments(ctx *EngineEvaluationContext, segments map[string]SegmentContext) {
+	if ctx.Segments == nil {
+		ctx.Segments = make(map[string]SegmentContext, len(segments))
+	}
+	for key, segment := range segments {
+		ctx.Segments[key] = segment
+	}
+}
+
 // mapMultivariateFeatureStateValuesToVariants converts multivariate feature state values to FeatureValue variants.
 func mapMultivariateFeatureStateValuesToVariants(multivariateValues []*features.MultivariateFeatureStateValueModel) []FeatureValue {
 	if len(multivariateValues) == 0 {
@@ -167,7 +173,9 @@ func mapRuleType(t segments.RuleType) Type {
 type overridesKey struct {
 	featureName  string
 	enabled      bool
-	featureValue string
+	featureValue any
+	// featureID is not part of the key, but used to look up the feature's ID.
+	featureID int
 }
 
 // overridesKeyList is a sortable slice of overridesKey.
@@ -177,15 +185,17 @@ func (o overridesKeyList) Len() int           { return len(o) }
 func (o overridesKeyList) Swap(i, j int)      { o[i], o[j] = o[j], o[i] }
 func (o overridesKeyList) Less(i, j int) bool { return o[i].featureName < o[j].featureName }
 
-// generateHash creates a hash from the overrides key for use as segment key.
-func generateHash(overrides overridesKeyList) string {
+// generateHash creates a hash from the overrides key for use as segment key. Values are hashed
+// in their default format, so that segment keys do not depend on the types of values, unless
+// typed is set, which qualifies non-string values with their type.
+func generateHash(overrides overridesKeyList, typed bool) string {
 	// Sort to ensure consistent hash for same set of overrides
 	sort.Sort(overrides)
 
 	// Create a string representation of the overrides
 	var hashInput string
 	for _, override := range overrides {
-		hashInput += fmt.Sprintf("%s:%t:%s;", override.featureName, override.enabled, override.featureValue)
+		hashInput += fmt.Sprintf("%s:%t:%s;", override.featureName, override.enabled, overrideValueHashInput(override.featureValue, typed))
 	}
 
 	// Generate SHA256 hash
@@ -193,49 +203,126 @@ func generateHash(overrides overridesKeyList) string {
 	return hex.EncodeToString(hash[:])[:16] // Use first 16 characters for shorter key
 }
 
+// overrideValueHashInput returns the representation of an override value used for hashing.
+// If typed is set, values other than strings are qualified with their type so that, for
+// example, the string "1" and the number 1 produce distinct hashes.
+func overrideValueHashInput(value any, typed bool) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		if typed {
+			return fmt.Sprintf("%T(%v)", v, v)
+		}
+		return fmt.Sprint(v)
+	}
+}
+
+// sameOverrideValues reports whether both sorted overrides keys hold values of the same types.
+func sameOverrideValues(a, b overridesKeyList) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !reflect.DeepEqual(a[i].featureValue, b[i].featureValue) {
+			return false
+		}
+	}
+	return true
+}
+
 // This groups identities by their common feature overrides and creates segments for each group.
 func mapIdentityOverridesToSegments(identityOverrides []*identities.IdentityModel) map[string]SegmentContext {
+	var groups identityOverrideGroups
+	for _, identityOverride := range identityOverrides {
+		groups.add(identityOverride.Identifier, mapIdentityFeaturesToOverrides(identityOverride.IdentityFeatures))
+	}
+	return groups.segments()
+}
+
+// mapIdentityFeaturesToOverrides creates the overrides key of an identity's features.
+func mapIdentityFeaturesToOverrides(identityFeatures []*features.FeatureStateModel) overridesKeyList {
+	var overrides overridesKeyList
+	for _, featureState := range identityFeatures {
+		overrides = append(overrides, overridesKey{
+			featureName:  featureState.Feature.Name,
+			enabled:      featureState.Enabled,
+			featureValue: featureState.RawValue,
+			featureID:    featureState.Feature.ID,
+		})
+	}
+	return overrides
+}
+
+// identityOverrideGroups groups identities by their common feature overrides, one identity at a
+// time, so that identities need not be kept once added.
+type identityOverrideGroups struct {
 	// Map from overrides key to list of identifiers
-	featuresToIdentifiers := make(map[string][]string)
-	overridesKeyToList := make(map[string]overridesKeyList)
-	featureNameToID := make(map[string]int)
+	featuresToIdentifiers map[string][]string
+	overridesKeyToList    map[string]overridesKeyList
+	featureNameToID       map[string]int
+}
 
-	for _, identityOverride := range identityOverrides {
-		if len(identityOverride.IdentityFeatures) == 0 {
-			continue
-		}
+// add adds an identity to the group of identities sharing its feature overrides.
+func (g *identityOverrideGroups) add(identifier string, overrides overridesKeyList) {
+	if len(overrides) == 0 {
+		return
+	}
+	if g.featuresToIdentifiers == nil {
+		g.featuresToIdentifiers = make(map[string][]string)
+		g.overridesKeyToList = make(map[string]overridesKeyList)
+		g.featureNameToID = make(map[string]int)
+	}
 
-		// Create overrides key from sorted features
-		var overrides overridesKeyList
-		for _, featureState := range identityOverride.IdentityFeatures {
-			featureValue := ""
-			if featureState.RawValue != nil {
-				featureValue = fmt.Sprint(featureState.RawValue)
-			}
+	// Store feature name to ID mapping for later lookup
+	for _, override := range overrides {
+		g.featureNameToID[override.featureName] = override.featureID
+	}
 
-			// Store feature name to ID mapping for later lookup
-			featureNameToID[featureState.Feature.Name] = featureState.Feature.ID
+	// Generate hash for this set of overrides. Overrides whose values only differ by their
+	// types, such as "1" and 1, get a type-qualified hash rather than joining the same group.
+	overridesHash := generateHash(overrides, false)
+	if existing, ok := g.overridesKeyToList[overridesHash]; ok && !sameOverrideValues(existing, overrides) {
+		overridesHash = generateHash(overrides, true)
+	}
 
-			overrides = append(overrides, overridesKey{
-				featureName:  featureState.Feature.Name,
-				enabled:      featureState.Enabled,
-				featureValue: featureValue,
-			})
-		}
+	// Group identifiers by their overrides
+	g.featuresToIdentifiers[overridesHash] = append(g.featuresToIdentifiers[overridesHash], identifier)
+	if _, ok := g.overridesKeyToList[overridesHash]; !ok {
+		g.overridesKeyToList[overridesHash] = overrides
+	}
+}
 
-		// Generate hash for this set of overrides
-		overridesHash := generateHash(overrides)
+// checkpoint returns the number of identifiers of each group, for restore.
+func (g *identityOverrideGroups) checkpoint() map[string]int {
+	sizes := make(map[string]int, len(g.featuresToIdentifiers))
+	for overridesHash, identifiers := range g.featuresToIdentifiers {
+		sizes[overridesHash] = len(identifiers)
+	}
+	return sizes
+}
 
-		// Group identifiers by their overrides
-		featuresToIdentifiers[overridesHash] = append(featuresToIdentifiers[overridesHash], identityOverride.Identifier)
-		overridesKeyToList[overridesHash] = overrides
+// restore removes the identities added since the checkpoint was taken.
+func (g *identityOverrideGroups) restore(sizes map[string]int) {
+	for overridesHash, identifiers := range g.featuresToIdentifiers {
+		size, ok := sizes[overridesHash]
+		if !ok {
+			delete(g.featuresToIdentifiers, overridesHash)
+			delete(g.overridesKeyToList, overridesHash)
+			continue
+		}
+		g.featuresToIdentifiers[overridesHash] = identifiers[:size]
 	}
+}
 
-	// Create segment contexts for each unique set of overrides
-	segmentContexts := make(map[string]SegmentContext)
+// segments creates segment contexts for each unique set of overrides.
+func (g *identityOverrideGroups) segments() map[string]SegmentContext {
+	segmentContexts := make(map[string]SegmentContext, len(g.featuresToIdentifiers))
 
-	for overridesHash, identifiers := range featuresToIdentifiers {
-		overrides := overridesKeyToList[overridesHash]
+	for overridesHash, identifiers := range g.featuresToIdentifiers {
+		overrides := g.overridesKeyToList[overridesHash]
 
 		// Create segment context
 		sc := SegmentContext{
@@ -261,7 +348,7 @@ func mapIdentityOverridesToSegments(identityOverrides []*identities.IdentityMode
 		// Create overrides for each feature
 		for _, override := range overrides {
 			priority := math.Inf(-1) // Strongest possible priority
-			featureID := featureNameToID[override.featureName]
+			featureID := g.featureNameToID[override.featureName]
 			featureOverride := FeatureContext{
 				Key:      "", // Identity overrides never carry multivariate options
 				Name:     override.featureName,
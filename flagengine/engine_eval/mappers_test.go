@@ -1,7 +1,10 @@
 package engine_eval
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"math"
+	"reflect"
 	"testing"
 	"time"
 
@@ -371,6 +374,83 @@ func TestMapEnvironmentDocumentToEvaluationContextWithIdentityOverrides(t *testi
 	}
 }
 
+func TestMapEnvironmentDocumentToEvaluationContextPreservesIdentityOverrideValueTypes(t *testing.T) {
+	identityOverride := func(identifier string, value any) *identities.IdentityModel {
+		return &identities.IdentityModel{
+			Identifier: identifier,
+			IdentityFeatures: []*features.FeatureStateModel{
+				{
+					Enabled:  true,
+					Feature:  &features.FeatureModel{ID: 1, Name: "feature_1"},
+					RawValue: value,
+				},
+			},
+		}
+	}
+	env := &environments.EnvironmentModel{
+		APIKey: "test-api-key",
+		IdentityOverrides: []*identities.IdentityModel{
+			identityOverride("user1", "1"),
+			identityOverride("user2", 1.0),
+			identityOverride("user3", true),
+			identityOverride("user4", nil),
+		},
+	}
+
+	result := MapEnvironmentDocumentToEvaluationContext(env)
+
+	values := make(map[string]any)
+	for _, segment := range result.Segments {
+		values[segment.Rules[0].Conditions[0].Value.(string)] = segment.Overrides[0].Value
+	}
+	expected := map[string]any{
+		"user1": "1",
+		"user2": 1.0,
+		"user3": true,
+		"user4": nil,
+	}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("Expected identity override values %v, got %v", expected, values)
+	}
+}
+
+func TestMapEnvironmentDocumentToEvaluationContextKeepsIdentityOverrideSegmentKeys(t *testing.T) {
+	// Segment keys hash values in their default format, as before values kept their types
+	legacyKey := func(value string) string {
+		hash := sha256.Sum256([]byte("feature_1:true:" + value + ";"))
+		return hex.EncodeToString(hash[:])[:16]
+	}
+	env := &environments.EnvironmentModel{
+		APIKey: "test-api-key",
+		IdentityOverrides: []*identities.IdentityModel{
+			{
+				Identifier: "user1",
+				IdentityFeatures: []*features.FeatureStateModel{
+					{Enabled: true, Feature: &features.FeatureModel{ID: 1, Name: "feature_1"}, RawValue: 1.0},
+				},
+			},
+			{
+				Identifier: "user2",
+				IdentityFeatures: []*features.FeatureStateModel{
+					{Enabled: true, Feature: &features.FeatureModel{ID: 1, Name: "feature_1"}, RawValue: true},
+				},
+			},
+		},
+	}
+
+	result := MapEnvironmentDocumentToEvaluationContext(env)
+
+	for key, identifier := range map[string]string{legacyKey("1"): "user1", legacyKey("true"): "user2"} {
+		segment, ok := result.Segments[key]
+		if !ok {
+			t.Fatalf("Expected segment %s for %s, got %v", key, identifier, result.Segments)
+		}
+		if segment.Rules[0].Conditions[0].Value != identifier {
+			t.Errorf("Expected segment %s to hold %s, got %v", key, identifier, segment.Rules[0].Conditions[0].Value)
+		}
+	}
+}
+
 func TestMapContextAndIdentityDataToContext(t *testing.T) {
 	// Create a base context
 	baseContext := EngineEvaluationContext{
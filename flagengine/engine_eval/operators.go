@@ -0,0 +1,177 @@
+package engine_eval
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// OperatorArgs holds the inputs available to an OperatorFunc when evaluating a condition.
+type OperatorArgs struct {
+	// Context is the evaluation context the condition is evaluated against.
+	Context *EngineEvaluationContext
+	// Condition is the condition being evaluated. Its Value holds the raw condition value.
+	Condition *Condition
+	// SegmentKey is the key of the segment the condition belongs to.
+	SegmentKey string
+	// ContextValue is the value resolved from the condition's property,
+	// or nil if the property is empty or not set in the context.
+	ContextValue ContextValue
+	// Options are the options the evaluation was started with.
+	Options *EvaluationOptions
+}
+
+// OperatorFunc reports whether a condition matches. It must be safe for concurrent use
+// and must not modify its arguments.
+type OperatorFunc func(args *OperatorArgs) bool
+
+// StringOperator adapts a function comparing string representations into an OperatorFunc.
+// The condition does not match if the context value is not set or the condition value is not a string.
+func StringOperator(match func(traitValue, conditionValue string) bool) OperatorFunc {
+	return func(args *OperatorArgs) bool {
+		conditionValue, ok := args.Condition.Value.(string)
+		if args.ContextValue == nil || !ok {
+			return false
+		}
+		return match(ToString(args.ContextValue), conditionValue)
+	}
+}
+
+// Operators which are not defined by the Flagsmith engine specification, e.g. for legacy rules.
+// They are not registered by default: register them under the names used by the conditions,
+// e.g. registry.Register("STARTS_WITH", engine_eval.StartsWithOperator).
+var (
+	// StartsWithOperator matches trait values starting with the condition value.
+	StartsWithOperator = StringOperator(strings.HasPrefix)
+	// EndsWithOperator matches trait values ending with the condition value.
+	EndsWithOperator = StringOperator(strings.HasSuffix)
+	// EqualFoldOperator matches trait values equal to the condition value, ignoring case.
+	EqualFoldOperator = StringOperator(strings.EqualFold)
+	// InCIDROperator matches IP address trait values within the network given by the condition
+	// value in CIDR notation, e.g. "10.0.0.0/8".
+	InCIDROperator = StringOperator(matchCIDR)
+)
+
+func matchCIDR(traitValue, conditionValue string) bool {
+	network, err := netip.ParsePrefix(conditionValue)
+	if err != nil {
+		return false
+	}
+	addr, err := netip.ParseAddr(traitValue)
+	return err == nil && network.Contains(addr.Unmap())
+}
+
+// ErrOperatorAlreadyRegistered is returned when registering an operator name twice.
+var ErrOperatorAlreadyRegistered = errors.New("operator already registered")
+
+// OperatorRegistry maps operator names to their implementations.
+// Registries are safe for concurrent use.
+type OperatorRegistry struct {
+	mu        sync.Mutex
+	operators atomic.Pointer[map[Operator]OperatorFunc]
+}
+
+// NewOperatorRegistry returns a registry containing the built-in operators.
+func NewOperatorRegistry() *OperatorRegistry {
+	r := &OperatorRegistry{}
+	operators := make(map[Operator]OperatorFunc, len(builtinOperatorFuncs))
+	for op, fn := range builtinOperatorFuncs {
+		operators[op] = fn
+	}
+	r.operators.Store(&operators)
+	return r
+}
+
+// Register adds an operator implementation to the registry.
+// Registering a name which is already taken, including the name of a built-in operator, fails
+// with ErrOperatorAlreadyRegistered.
+func (r *OperatorRegistry) Register(operator Operator, fn OperatorFunc) error {
+	if operator == "" {
+		return errors.New("operator name must not be empty")
+	}
+	if fn == nil {
+		return fmt.Errorf("operator %s: implementation must not be nil", operator)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current := *r.operators.Load()
+	if _, exists := current[operator]; exists {
+		return fmt.Errorf("%w: %s", ErrOperatorAlreadyRegistered, operator)
+	}
+	// Copy on write, so that lookups never need to take the lock
+	operators := make(map[Operator]OperatorFunc, len(current)+1)
+	for op, f := range current {
+		operators[op] = f
+	}
+	operators[operator] = fn
+	r.operators.Store(&operators)
+	return nil
+}
+
+// Lookup returns the implementation registered for the operator.
+func (r *OperatorRegistry) Lookup(operator Operator) (OperatorFunc, bool) {
+	fn, ok := (*r.operators.Load())[operator]
+	return fn, ok
+}
+
+// Operators returns the sorted names of all registered operators.
+func (r *OperatorRegistry) Operators() []Operator {
+	operators := *r.operators.Load()
+	names := make([]Operator, 0, len(operators))
+	for op := range operators {
+		names = append(names, op)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// builtinOperatorFuncs implements the operators defined by the Flagsmith engine specification.
+var builtinOperatorFuncs = map[Operator]OperatorFunc{
+	Equal:                matchComparison,
+	NotEqual:             matchComparison,
+	GreaterThan:          matchComparison,
+	GreaterThanInclusive: matchComparison,
+	LessThan:             matchComparison,
+	LessThanInclusive:    matchComparison,
+	Contains:             matchComparison,
+	NotContains:          matchComparison,
+	Regex:                matchComparison,
+	Modulo:               matchComparison,
+	In: func(args *OperatorArgs) bool {
+		if args.Options.TypedTraits && !isTypedInCandidate(args.ContextValue) {
+			return false
+		}
+		return matchInOperator(args.Condition, args.ContextValue)
+	},
+	IsSet: func(args *OperatorArgs) bool {
+		return args.ContextValue != nil
+	},
+	IsNotSet: func(args *OperatorArgs) bool {
+		return args.ContextValue == nil
+	},
+	PercentageSplit: func(args *OperatorArgs) bool {
+		return matchPercentageSplit(args.Context, args.Condition, args.SegmentKey, args.ContextValue, args.Options)
+	},
+}
+
+// builtinOperators is the registry used when no registry is configured.
+var builtinOperators = NewOperatorRegistry()
+
+// matchComparison implements the operators comparing a context value with a string condition value.
+func matchComparison(args *OperatorArgs) bool {
+	strValue, ok := args.Condition.Value.(string)
+	if args.ContextValue == nil || !ok {
+		return false
+	}
+	if strings.HasSuffix(strValue, dateSuffix) {
+		return evaluateDateGeneric(args.Condition.Operator, args.ContextValue, strValue[:len(strValue)-len(dateSuffix)], args.Options.now())
+	}
+	if args.Options.TypedTraits {
+		return matchTypedValue(args.Condition.Operator, args.ContextValue, strValue)
+	}
+	return parseAndMatch(args.Condition.Operator, ToString(args.ContextValue), strValue)
+}
@@ -0,0 +1,120 @@
+package engine_eval_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/engine_eval"
+)
+
+const (
+	startsWith engine_eval.Operator = "STARTS_WITH"
+	endsWith   engine_eval.Operator = "ENDS_WITH"
+	equalFold  engine_eval.Operator = "EQUAL_IGNORE_CASE"
+	inCIDR     engine_eval.Operator = "IN_CIDR"
+)
+
+func newTestOperatorRegistry(t *testing.T) *engine_eval.OperatorRegistry {
+	registry := engine_eval.NewOperatorRegistry()
+	assert.NoError(t, registry.Register(startsWith, engine_eval.StartsWithOperator))
+	assert.NoError(t, registry.Register(endsWith, engine_eval.EndsWithOperator))
+	assert.NoError(t, registry.Register(equalFold, engine_eval.EqualFoldOperator))
+	assert.NoError(t, registry.Register(inCIDR, engine_eval.InCIDROperator))
+	return registry
+}
+
+func TestOperatorRegistryContainsBuiltinOperators(t *testing.T) {
+	registry := engine_eval.NewOperatorRegistry()
+
+	assert.Equal(t, []engine_eval.Operator{
+		engine_eval.Contains,
+		engine_eval.Equal,
+		engine_eval.GreaterThan,
+		engine_eval.GreaterThanInclusive,
+		engine_eval.In,
+		engine_eval.IsNotSet,
+		engine_eval.IsSet,
+		engine_eval.LessThan,
+		engine_eval.LessThanInclusive,
+		engine_eval.Modulo,
+		engine_eval.NotContains,
+		engine_eval.NotEqual,
+		engine_eval.PercentageSplit,
+		engine_eval.Regex,
+	}, registry.Operators())
+}
+
+func TestOperatorRegistryRegister(t *testing.T) {
+	registry := newTestOperatorRegistry(t)
+
+	_, ok := registry.Lookup(startsWith)
+	assert.True(t, ok)
+	assert.Contains(t, registry.Operators(), inCIDR)
+
+	// Other registries are not affected
+	_, ok = engine_eval.NewOperatorRegistry().Lookup(startsWith)
+	assert.False(t, ok)
+}
+
+func TestOperatorRegistryRegisterRejectsDuplicatesAndInvalidInput(t *testing.T) {
+	registry := newTestOperatorRegistry(t)
+	noop := func(*engine_eval.OperatorArgs) bool { return true }
+
+	err := registry.Register(engine_eval.Equal, noop)
+	assert.True(t, errors.Is(err, engine_eval.ErrOperatorAlreadyRegistered))
+
+	err = registry.Register(startsWith, noop)
+	assert.True(t, errors.Is(err, engine_eval.ErrOperatorAlreadyRegistered))
+
+	assert.Error(t, registry.Register("", noop))
+	assert.Error(t, registry.Register("NOOP", nil))
+}
+
+func TestIsContextInSegmentWithCustomOperators(t *testing.T) {
+	registry := newTestOperatorRegistry(t)
+
+	cases := []struct {
+		name     string
+		operator engine_eval.Operator
+		property string
+		value    string
+		expected bool
+	}{
+		{"starts with", startsWith, traitKey1, "user@", true},
+		{"does not start with", startsWith, traitKey1, "admin@", false},
+		{"ends with", endsWith, traitKey1, "@example.com", true},
+		{"does not end with", endsWith, traitKey1, "@example.org", false},
+		{"equal ignoring case", equalFold, traitKey1, "USER@Example.com", true},
+		{"not equal ignoring case", equalFold, traitKey1, "admin@example.com", false},
+		{"in CIDR", inCIDR, "ip", "10.0.0.0/8", true},
+		{"IPv4-mapped IPv6 address in CIDR", inCIDR, "mapped_ip", "10.0.0.0/8", true},
+		{"not in CIDR", inCIDR, "ip", "192.168.0.0/16", false},
+		{"invalid CIDR", inCIDR, "ip", "10.0.0.0", false},
+		{"invalid IP address", inCIDR, traitKey1, "10.0.0.0/8", false},
+		{"unset trait", startsWith, "missing", "a", false},
+		{"built-in operator", engine_eval.Equal, traitKey1, traitValue1, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			evalContext := createEvaluationContext(map[string]any{
+				traitKey1:   traitValue1,
+				"ip":        "10.1.2.3",
+				"mapped_ip": "::ffff:10.1.2.3",
+			})
+			segmentContext := createSegmentContext("1", "custom", []engine_eval.SegmentRule{
+				{
+					Type: engine_eval.All,
+					Conditions: []engine_eval.Condition{
+						{Operator: c.operator, Property: c.property, Value: c.value},
+					},
+				},
+			})
+
+			result := engine_eval.IsContextInSegment(evalContext, segmentContext, engine_eval.WithOperatorRegistry(registry))
+			assert.Equal(t, c.expected, result)
+		})
+	}
+}
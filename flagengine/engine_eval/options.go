@@ -0,0 +1,96 @@
+package engine_eval
+
+import (
+	"time"
+
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/utils"
+)
+
+// EvaluationOption configures optional behaviour of the engine.
+type EvaluationOption func(o *EvaluationOptions)
+
+// EvaluationOptions holds the settings applied by EvaluationOption functions.
+// The zero value reproduces the default engine behaviour.
+type EvaluationOptions struct {
+	// TypedTraits makes segment conditions compare trait values according to their type
+	// instead of inferring a type from their string representation.
+	TypedTraits bool
+	// Clock returns the current time used by relative date conditions. Defaults to time.Now.
+	Clock func() time.Time
+	// Operators resolves condition operators to their implementations.
+	// Defaults to a registry of the built-in operators.
+	Operators *OperatorRegistry
+	// Bucketing assigns identities to percentage buckets for multivariate features and
+	// % split segments. Defaults to utils.MD5Bucketing.
+	Bucketing utils.BucketingStrategy
+}
+
+// NewEvaluationOptions applies the given options on top of the defaults.
+func NewEvaluationOptions(opts ...EvaluationOption) *EvaluationOptions {
+	o := &EvaluationOptions{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(o)
+		}
+	}
+	return o
+}
+
+// now returns the current time according to the configured clock.
+func (o *EvaluationOptions) now() time.Time {
+	if o.Clock != nil {
+		return o.Clock()
+	}
+	return time.Now()
+}
+
+// operators returns the configured operator registry.
+func (o *EvaluationOptions) operators() *OperatorRegistry {
+	if o.Operators != nil {
+		return o.Operators
+	}
+	return builtinOperators
+}
+
+// HashedPercentage returns the bucket of the given object ids according to the configured strategy.
+func (o *EvaluationOptions) HashedPercentage(objectIds []string) float64 {
+	if o.Bucketing != nil {
+		return o.Bucketing.HashedPercentage(objectIds)
+	}
+	return utils.MD5Bucketing.HashedPercentage(objectIds)
+}
+
+// WithTypedTraits enables typed comparison of trait values, following the Flagsmith engine
+// specification: the type of the trait value decides how the condition value is parsed.
+// For example, the string trait "true" no longer matches a condition expecting a boolean,
+// and the integer trait 1 does not match the condition value "1.5".
+func WithTypedTraits() EvaluationOption {
+	return func(o *EvaluationOptions) {
+		o.TypedTraits = true
+	}
+}
+
+// WithClock sets the clock used to resolve relative date conditions such as "now-7d:date".
+// It is mostly useful to keep evaluation deterministic in tests.
+func WithClock(clock func() time.Time) EvaluationOption {
+	return func(o *EvaluationOptions) {
+		o.Clock = clock
+	}
+}
+
+// WithOperatorRegistry evaluates conditions using the operators of the given registry,
+// which should be created using NewOperatorRegistry to include the built-in operators.
+func WithOperatorRegistry(registry *OperatorRegistry) EvaluationOption {
+	return func(o *EvaluationOptions) {
+		o.Operators = registry
+	}
+}
+
+// WithBucketingStrategy sets the strategy used to assign identities to percentage buckets.
+// Evaluation results only agree with other Flagsmith SDKs when using the default strategy;
+// custom strategies are mostly useful to control bucketing in tests.
+func WithBucketingStrategy(strategy utils.BucketingStrategy) EvaluationOption {
+	return func(o *EvaluationOptions) {
+		o.Bucketing = strategy
+	}
+}
@@ -0,0 +1,185 @@
+package engine_eval
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blang/semver/v4"
+	"github.com/ohler55/ojg/jp"
+)
+
+// Diagnostic describes a segment rule or condition which cannot be evaluated as intended.
+// Such conditions do not cause evaluation errors, but silently fail to match.
+type Diagnostic struct {
+	// Path locates the problem, e.g. `segments["1"].rules[0].rules[1].conditions[2]`.
+	Path string
+	// SegmentKey is the key of the segment containing the problem.
+	SegmentKey string
+	// SegmentName is the name of the segment containing the problem.
+	SegmentName string
+	// Operator is the operator of the offending condition, if any.
+	Operator Operator
+	// Property is the property of the offending condition, if any.
+	Property string
+	// Message describes the problem.
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s (segment %q): %s", d.Path, d.SegmentName, d.Message)
+}
+
+// ValidationError reports the diagnostics found in an evaluation context.
+type ValidationError struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		messages[i] = d.String()
+	}
+	return fmt.Sprintf("flagsmith: %d invalid segment rules: %s", len(e.Diagnostics), strings.Join(messages, "; "))
+}
+
+// Validate reports the segment rules and conditions of the context which are malformed,
+// such as invalid regular expressions, unparsable semantic versions, or unknown operators.
+// Operators are resolved using the registry configured by opts.
+// Diagnostics are ordered by segment key, then by their position within the segment.
+func Validate(ec EngineEvaluationContext, opts ...EvaluationOption) []Diagnostic {
+	v := validator{registry: NewEvaluationOptions(opts...).operators()}
+	for _, key := range sortedSegmentKeys(ec.Segments) {
+		segment := ec.Segments[key]
+		v.segment = &segment
+		v.validateRules(segment.Rules, fmt.Sprintf("segments[%q]", key))
+	}
+	return v.diagnostics
+}
+
+func sortedSegmentKeys(segments map[string]SegmentContext) []string {
+	keys := make([]string, 0, len(segments))
+	for key := range segments {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type validator struct {
+	registry    *OperatorRegistry
+	segment     *SegmentContext
+	diagnostics []Diagnostic
+}
+
+func (v *validator) report(path string, condition *Condition, format string, args ...any) {
+	d := Diagnostic{
+		Path:        path,
+		SegmentKey:  v.segment.Key,
+		SegmentName: v.segment.Name,
+		Message:     fmt.Sprintf(format, args...),
+	}
+	if condition != nil {
+		d.Operator = condition.Operator
+		d.Property = condition.Property
+	}
+	v.diagnostics = append(v.diagnostics, d)
+}
+
+func (v *validator) validateRules(rules []SegmentRule, path string) {
+	for i := range rules {
+		rule := &rules[i]
+		rulePath := fmt.Sprintf("%s.rules[%d]", path, i)
+		switch rule.Type {
+		case All, Any, None:
+		default:
+			v.report(rulePath, nil, "unknown rule type %q", rule.Type)
+		}
+		for j := range rule.Conditions {
+			v.validateCondition(&rule.Conditions[j], fmt.Sprintf("%s.conditions[%d]", rulePath, j))
+		}
+		v.validateRules(rule.Rules, rulePath)
+	}
+}
+
+func (v *validator) validateCondition(condition *Condition, path string) {
+	if strings.HasPrefix(condition.Property, "$.") {
+		if _, err := jp.ParseString(condition.Property); err != nil {
+			v.report(path, condition, "invalid JSONPath property, it will be treated as a trait name: %s", err)
+		}
+	}
+
+	if _, ok := v.registry.Lookup(condition.Operator); !ok {
+		v.report(path, condition, "unknown operator %q", condition.Operator)
+		return
+	}
+
+	strValue, isString := condition.Value.(string)
+	switch condition.Operator {
+	case IsSet, IsNotSet:
+		return
+	case In:
+		switch condition.Value.(type) {
+		case string, []string, []interface{}:
+		default:
+			v.report(path, condition, "IN value must be a string or an array, got %T", condition.Value)
+		}
+		return
+	case PercentageSplit:
+		if !isString {
+			v.report(path, condition, "PERCENTAGE_SPLIT value must be a string, got %T", condition.Value)
+			return
+		}
+		f, err := strconv.ParseFloat(strValue, 64)
+		if err != nil {
+			v.report(path, condition, "PERCENTAGE_SPLIT value %q is not a number", strValue)
+		} else if f < 0 || f > 100 {
+			v.report(path, condition, "PERCENTAGE_SPLIT value %q is not between 0 and 100", strValue)
+		}
+		return
+	}
+
+	if _, builtin := builtinOperatorFuncs[condition.Operator]; !builtin {
+		// Values of custom operators are opaque
+		return
+	}
+	if !isString {
+		v.report(path, condition, "%s value must be a string, got %T", condition.Operator, condition.Value)
+		return
+	}
+
+	switch {
+	case strings.HasSuffix(strValue, dateSuffix):
+		if _, ok := parseDateConditionValue(strValue[:len(strValue)-len(dateSuffix)], time.Time{}); !ok {
+			v.report(path, condition, "invalid date %q", strValue)
+		}
+	case condition.Operator == Regex:
+		if _, err := regexp.Compile(strValue); err != nil {
+			v.report(path, condition, "invalid regular expression %q: %s", strValue, err)
+		}
+	case condition.Operator == Modulo:
+		if !isValidModuloValue(strValue) {
+			v.report(path, condition, "MODULO value %q must have the format divisor|remainder", strValue)
+		}
+	case strings.HasSuffix(strValue, ":semver"):
+		if _, err := semver.Make(strValue[:len(strValue)-7]); err != nil {
+			v.report(path, condition, "invalid semantic version %q: %s", strValue, err)
+		}
+	}
+}
+
+func isValidModuloValue(value string) bool {
+	parts := strings.Split(value, "|")
+	if len(parts) != 2 {
+		return false
+	}
+	for _, part := range parts {
+		if _, err := strconv.ParseFloat(part, 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
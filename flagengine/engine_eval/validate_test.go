@@ -0,0 +1,110 @@
+package engine_eval_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/engine_eval"
+)
+
+func TestValidate(t *testing.T) {
+	condition := func(operator engine_eval.Operator, property string, value any) engine_eval.Condition {
+		return engine_eval.Condition{Operator: operator, Property: property, Value: value}
+	}
+	ec := engine_eval.EngineEvaluationContext{
+		Segments: map[string]engine_eval.SegmentContext{
+			"1": *createSegmentContext("1", "valid", []engine_eval.SegmentRule{
+				{
+					Type: engine_eval.All,
+					Conditions: []engine_eval.Condition{
+						condition(engine_eval.Regex, "email", `.*@example\.com$`),
+						condition(engine_eval.GreaterThan, "version", "1.2.3:semver"),
+						condition(engine_eval.LessThan, "created_at", "now-7d:date"),
+						condition(engine_eval.PercentageSplit, "", "12.5"),
+						condition(engine_eval.Modulo, "user_id", "2|0"),
+						condition(engine_eval.In, "$.identity.identifier", []interface{}{"a", "b"}),
+						condition(engine_eval.IsSet, "email", nil),
+					},
+				},
+			}),
+			"2": *createSegmentContext("2", "invalid", []engine_eval.SegmentRule{
+				{
+					Type: engine_eval.All,
+					Conditions: []engine_eval.Condition{
+						condition(engine_eval.Regex, "email", "(unclosed"),
+						condition(engine_eval.Equal, "version", "1.2:semver"),
+					},
+					Rules: []engine_eval.SegmentRule{
+						{
+							Type: engine_eval.Any,
+							Conditions: []engine_eval.Condition{
+								condition(engine_eval.PercentageSplit, "", "half"),
+								condition(engine_eval.PercentageSplit, "", "150"),
+								condition(engine_eval.Modulo, "user_id", "2"),
+								condition(engine_eval.Equal, "$.identity.[", "x"),
+								condition("STARTS_WITH", "email", "a"),
+								condition(engine_eval.Equal, "email", nil),
+								condition(engine_eval.LessThan, "created_at", "soon:date"),
+							},
+						},
+						{Type: "SOME"},
+					},
+				},
+			}),
+		},
+	}
+
+	diagnostics := engine_eval.Validate(ec)
+
+	paths := make([]string, len(diagnostics))
+	for i, d := range diagnostics {
+		paths[i] = d.Path
+		assert.Equal(t, "2", d.SegmentKey)
+		assert.Equal(t, "invalid", d.SegmentName)
+		assert.NotEmpty(t, d.Message)
+	}
+	assert.Equal(t, []string{
+		`segments["2"].rules[0].conditions[0]`,
+		`segments["2"].rules[0].conditions[1]`,
+		`segments["2"].rules[0].rules[0].conditions[0]`,
+		`segments["2"].rules[0].rules[0].conditions[1]`,
+		`segments["2"].rules[0].rules[0].conditions[2]`,
+		`segments["2"].rules[0].rules[0].conditions[3]`,
+		`segments["2"].rules[0].rules[0].conditions[4]`,
+		`segments["2"].rules[0].rules[0].conditions[5]`,
+		`segments["2"].rules[0].rules[0].conditions[6]`,
+		`segments["2"].rules[0].rules[1]`,
+	}, paths)
+	assert.Equal(t, engine_eval.Regex, diagnostics[0].Operator)
+	assert.Equal(t, "email", diagnostics[0].Property)
+	assert.Equal(t, engine_eval.Operator("STARTS_WITH"), diagnostics[6].Operator)
+	assert.Equal(t, `unknown operator "STARTS_WITH"`, diagnostics[6].Message)
+	assert.Equal(t, `unknown rule type "SOME"`, diagnostics[9].Message)
+}
+
+func TestValidateWithCustomOperators(t *testing.T) {
+	ec := engine_eval.EngineEvaluationContext{
+		Segments: map[string]engine_eval.SegmentContext{
+			"1": *createSegmentContext("1", "custom", []engine_eval.SegmentRule{
+				{
+					Type: engine_eval.All,
+					Conditions: []engine_eval.Condition{
+						{Operator: startsWith, Property: "email", Value: []string{"opaque"}},
+					},
+				},
+			}),
+		},
+	}
+
+	assert.Len(t, engine_eval.Validate(ec), 1)
+	assert.Empty(t, engine_eval.Validate(ec, engine_eval.WithOperatorRegistry(newTestOperatorRegistry(t))))
+}
+
+func TestValidationErrorMessage(t *testing.T) {
+	err := &engine_eval.ValidationError{Diagnostics: []engine_eval.Diagnostic{
+		{Path: `segments["1"].rules[0].conditions[0]`, SegmentName: "beta", Message: `unknown operator "X"`},
+	}}
+
+	assert.Equal(t, `flagsmith: 1 invalid segment rules: segments["1"].rules[0].conditions[0] (segment "beta"): unknown operator "X"`, err.Error())
+}
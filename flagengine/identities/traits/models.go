@@ -1,27 +1,78 @@
 package traits
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"strings"
+
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/utils"
 )
 
 type TraitModel struct {
 	TraitKey   string `json:"trait_key"`
 	TraitValue string `json:"trait_value"`
+
+	value any
+	typed bool
+}
+
+// NewTraitModel creates a TraitModel which preserves the type of the given value.
+func NewTraitModel(key string, value any) *TraitModel {
+	t := &TraitModel{TraitKey: key}
+	t.setValue(value)
+	return t
+}
+
+// Value returns the trait value with its type preserved: nil, string, bool, int64 or float64.
+// Models that were constructed without type information return TraitValue.
+func (t *TraitModel) Value() any {
+	if t.typed {
+		return t.value
+	}
+	return t.TraitValue
 }
 
-func (t *TraitModel) UnmarshalJSON(bytes []byte) error {
+func (t *TraitModel) setValue(value any) {
+	t.value = utils.NormaliseTraitValue(value)
+	t.typed = true
+	if value == nil {
+		t.TraitValue = "null"
+	} else {
+		t.TraitValue = fmt.Sprint(value)
+	}
+}
+
+func (t *TraitModel) UnmarshalJSON(data []byte) error {
 	var obj struct {
 		Key string          `json:"trait_key"`
 		Val json.RawMessage `json:"trait_value"`
 	}
 
-	err := json.Unmarshal(bytes, &obj)
+	err := json.Unmarshal(data, &obj)
 	if err != nil {
 		return err
 	}
 
 	t.TraitKey = obj.Key
 	t.TraitValue = strings.Trim(string(obj.Val), `"`)
+
+	var value any
+	if len(obj.Val) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(obj.Val))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			return err
+		}
+	}
+	t.value = utils.NormaliseTraitValue(value)
+	t.typed = true
 	return nil
 }
+
+func (t TraitModel) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Key string `json:"trait_key"`
+		Val any    `json:"trait_value"`
+	}{Key: t.TraitKey, Val: t.Value()})
+}
@@ -0,0 +1,55 @@
+package traits_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/identities/traits"
+)
+
+func TestTraitModelUnmarshalJSONPreservesValueType(t *testing.T) {
+	cases := []struct {
+		input         string
+		expectedValue any
+		expectedRaw   string
+	}{
+		{`{"trait_key": "k", "trait_value": "true"}`, "true", "true"},
+		{`{"trait_key": "k", "trait_value": true}`, true, "true"},
+		{`{"trait_key": "k", "trait_value": "1"}`, "1", "1"},
+		{`{"trait_key": "k", "trait_value": 1}`, int64(1), "1"},
+		{`{"trait_key": "k", "trait_value": 1.5}`, 1.5, "1.5"},
+		{`{"trait_key": "k", "trait_value": null}`, nil, "null"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			var trait traits.TraitModel
+			err := json.Unmarshal([]byte(c.input), &trait)
+
+			assert.NoError(t, err)
+			assert.Equal(t, "k", trait.TraitKey)
+			assert.Equal(t, c.expectedRaw, trait.TraitValue)
+			assert.Equal(t, c.expectedValue, trait.Value())
+		})
+	}
+}
+
+func TestTraitModelMarshalJSONRoundTrip(t *testing.T) {
+	trait := traits.NewTraitModel("k", 42)
+
+	b, err := json.Marshal(trait)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"trait_key": "k", "trait_value": 42}`, string(b))
+
+	var decoded traits.TraitModel
+	assert.NoError(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, int64(42), decoded.Value())
+}
+
+func TestTraitModelValueWithoutTypeInformation(t *testing.T) {
+	trait := traits.TraitModel{TraitKey: "k", TraitValue: "42"}
+
+	assert.Equal(t, "42", trait.Value())
+}
@@ -6,8 +6,44 @@ import (
 	"strings"
 )
 
+// BucketingStrategy assigns objects to a percentage bucket, e.g. to select a multivariate
+// feature value or to evaluate a % split segment condition for an identity.
+// Implementations must be deterministic and safe for concurrent use.
+type BucketingStrategy interface {
+	// HashedPercentage returns a number in range [0:100) based on the given object ids.
+	HashedPercentage(objectIds []string) float64
+}
+
+// BucketingStrategyFunc adapts a function into a BucketingStrategy.
+type BucketingStrategyFunc func(objectIds []string) float64
+
+func (f BucketingStrategyFunc) HashedPercentage(objectIds []string) float64 {
+	return f(objectIds)
+}
+
+// MD5Bucketing is the default BucketingStrategy, shared by all Flagsmith SDKs.
+var MD5Bucketing BucketingStrategy = BucketingStrategyFunc(func(objectIds []string) float64 {
+	return hashedPercentageForObjectIdsFunc(objectIds, 1)
+})
+
+var hashedPercentageForObjectIdsFunc = GetHashedPercentageForObjectIds
+
+// MockSetHashedPercentageForObjectIds replaces the hash used by MD5Bucketing until ResetMocks is called.
+//
+// Deprecated: pass a BucketingStrategy using engine_eval.WithBucketingStrategy instead.
+func MockSetHashedPercentageForObjectIds(fn func([]string, int) float64) {
+	hashedPercentageForObjectIdsFunc = fn
+}
+
+// ResetMocks restores the hash replaced by MockSetHashedPercentageForObjectIds.
+//
+// Deprecated: pass a BucketingStrategy using engine_eval.WithBucketingStrategy instead.
+func ResetMocks() {
+	hashedPercentageForObjectIdsFunc = GetHashedPercentageForObjectIds
+}
+
 // GetHashedPercentageForObjectIds returns a number in range [0:100) based on hashes of ids.
-func getHashedPercentageForObjectIds(ids []string, iterations int) float64 {
+func GetHashedPercentageForObjectIds(ids []string, iterations int) float64 {
 	strs := make([]string, len(ids)*iterations)
 	for i := 0; i < len(strs); i++ {
 		strs[i] = ids[i%len(ids)]
@@ -20,22 +56,8 @@ func getHashedPercentageForObjectIds(ids []string, iterations int) float64 {
 
 	value = (float64(hashValue.Mod(&hashValue, big.NewInt(9999)).Int64()) / 9998.0) * 100.0
 	if value == 100 {
-		return getHashedPercentageForObjectIds(ids, iterations+1)
+		return GetHashedPercentageForObjectIds(ids, iterations+1)
 	}
 
 	return value
 }
-
-func GetHashedPercentageForObjectIds(ids []string, iterations int) float64 {
-	return hashedPercentageForObjectIdsFunc(ids, iterations)
-}
-
-var hashedPercentageForObjectIdsFunc = getHashedPercentageForObjectIds
-
-func MockSetHashedPercentageForObjectIds(fn func([]string, int) float64) {
-	hashedPercentageForObjectIdsFunc = fn
-}
-
-func ResetMocks() {
-	hashedPercentageForObjectIdsFunc = getHashedPercentageForObjectIds
-}
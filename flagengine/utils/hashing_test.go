@@ -115,3 +115,17 @@ func TestPercentageIsEvenlyDistributed(t *testing.T) {
 		}
 	}
 }
+
+func TestMockSetHashedPercentageForObjectIdsReplacesMD5Bucketing(t *testing.T) {
+	// Given
+	utils.MockSetHashedPercentageForObjectIds(func([]string, int) float64 { return 42 })
+
+	// When
+	mocked := utils.MD5Bucketing.HashedPercentage([]string{"foo", "bar"})
+	utils.ResetMocks()
+	reset := utils.MD5Bucketing.HashedPercentage([]string{"foo", "bar"})
+
+	// Then
+	assert.InDelta(t, 42.0, mocked, 0)
+	assert.InDelta(t, utils.GetHashedPercentageForObjectIds([]string{"foo", "bar"}, 1), reset, 0)
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// NormaliseTraitValue converts a trait value to one of the types supported by
+// the Flagsmith engine: nil, string, bool, int64 or float64.
+// Values of any other type are converted to their string representation.
+func NormaliseTraitValue(value any) any {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string, bool, int64, float64:
+		return v
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint:
+		return normaliseUint(uint64(v))
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return normaliseUint(v)
+	case float32:
+		return float64(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func normaliseUint(v uint64) any {
+	if v > math.MaxInt64 {
+		return float64(v)
+	}
+	return int64(v)
+}
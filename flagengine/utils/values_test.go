@@ -0,0 +1,38 @@
+package utils_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/utils"
+)
+
+func TestNormaliseTraitValue(t *testing.T) {
+	cases := []struct {
+		input    any
+		expected any
+	}{
+		{nil, nil},
+		{"foo", "foo"},
+		{true, true},
+		{42, int64(42)},
+		{int8(-3), int64(-3)},
+		{uint16(7), int64(7)},
+		{uint64(math.MaxUint64), float64(math.MaxUint64)},
+		{float32(1.5), 1.5},
+		{2.0, 2.0},
+		{json.Number("12"), int64(12)},
+		{json.Number("12.5"), 12.5},
+		{[]string{"a"}, "[a]"},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%T(%v)", c.input, c.input), func(t *testing.T) {
+			assert.Equal(t, c.expected, utils.NormaliseTraitValue(c.input))
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package flagengine
+
+import (
+	"fmt"
+	"iter"
+	"math"
+
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/engine_eval"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/environments"
+)
+
+// VariantReport describes how a feature's values are distributed across a set of identities.
+type VariantReport struct {
+	// Feature is the name of the reported feature.
+	Feature string
+	// Identities is the number of identities evaluated.
+	Identities int
+	// Allocations lists the feature contexts the identities were evaluated against, i.e. the
+	// environment default and the segment and identity overrides, in the order they were first
+	// received by an identity. Contexts which no identity received are omitted.
+	Allocations []*Allocation
+}
+
+// Allocation reports the values received by the identities evaluated against one feature context.
+type Allocation struct {
+	// Segment is the name of the segment overriding the feature, or empty for the environment
+	// default. Identity overrides are reported as the "identity_overrides" segment.
+	Segment string
+	// Identities is the number of identities evaluated against this context.
+	Identities int
+	// Values lists the multivariate variants ordered by priority, followed by the control value.
+	Values []*ValueAllocation
+}
+
+// ValueAllocation reports how many identities received a feature value.
+type ValueAllocation struct {
+	// Value is the feature value.
+	Value any
+	// Control is true for the value received by identities outside all variants.
+	Control bool
+	// ConfiguredWeight is the configured percentage of identities receiving this value.
+	ConfiguredWeight float64
+	// Count is the number of identities which received this value.
+	Count int
+	// ObservedWeight is the percentage of identities which received this value.
+	ObservedWeight float64
+	// Deviation is ObservedWeight minus ConfiguredWeight, in percentage points.
+	Deviation float64
+}
+
+// MaxDeviation returns the largest absolute deviation of the allocation's values.
+func (a *Allocation) MaxDeviation() float64 {
+	maxDeviation := 0.0
+	for _, v := range a.Values {
+		maxDeviation = math.Max(maxDeviation, math.Abs(v.Deviation))
+	}
+	return maxDeviation
+}
+
+// ReportVariants evaluates the feature for each identifier, without traits, and reports the
+// resulting distribution of values, taking segment and identity overrides into account.
+// Identities are assigned to variants exactly as during flag evaluation, so that the report is
+// deterministic for a given environment document and bucketing strategy.
+//
+// Identifiers may be produced lazily, e.g. using slices.Values for a list.
+func ReportVariants(env *environments.EnvironmentModel, featureName string, identifiers iter.Seq[string], opts ...engine_eval.EvaluationOption) (*VariantReport, error) {
+	ec := engine_eval.MapEnvironmentDocumentToEvaluationContext(env)
+	if _, ok := ec.Features[featureName]; !ok {
+		return nil, fmt.Errorf("flagsmith: feature %q not found in environment", featureName)
+	}
+	o := engine_eval.NewEvaluationOptions(opts...)
+
+	report := &VariantReport{Feature: featureName}
+	// Allocations are keyed by the overriding feature context, or nil for the environment default
+	allocations := make(map[*engine_eval.FeatureContext]*allocationState)
+	for identifier := range identifiers {
+		identityKey := ec.Environment.Key + "_" + identifier
+		identityCtx := ec
+		identityCtx.Identity = &engine_eval.IdentityContext{
+			Identifier: identifier,
+			Key:        identityKey,
+			Traits:     map[string]any{},
+		}
+
+		_, featureOverrides := getMatchingSegmentsAndOverrides(&identityCtx, opts)
+		featureContext := ec.Features[featureName]
+		var segmentName string
+		var overrideContext *engine_eval.FeatureContext
+		if override, ok := featureOverrides[featureName]; ok {
+			featureContext = *override.featureContext
+			segmentName = override.segmentName
+			overrideContext = override.featureContext
+		}
+
+		allocation, ok := allocations[overrideContext]
+		if !ok {
+			allocation = newAllocationState(segmentName, &featureContext)
+			allocations[overrideContext] = allocation
+			report.Allocations = append(report.Allocations, allocation.Allocation)
+		}
+
+		valueIndex := len(allocation.variants)
+		if len(allocation.variants) > 0 && featureContext.Key != "" {
+			hashPercentage := o.HashedPercentage([]string{featureContext.Key, identityKey})
+			if i := selectVariant(allocation.variants, hashPercentage); i >= 0 {
+				valueIndex = i
+			}
+		}
+		allocation.Values[valueIndex].Count++
+		allocation.Identities++
+		report.Identities++
+	}
+
+	for _, allocation := range report.Allocations {
+		for _, v := range allocation.Values {
+			v.ObservedWeight = float64(v.Count) / float64(allocation.Identities) * 100
+			v.Deviation = v.ObservedWeight - v.ConfiguredWeight
+		}
+	}
+	return report, nil
+}
+
+type allocationState struct {
+	*Allocation
+	variants []engine_eval.FeatureValue
+}
+
+func newAllocationState(segmentName string, featureContext *engine_eval.FeatureContext) *allocationState {
+	variants := getSortedVariantsByPriority(featureContext.Variants)
+	state := &allocationState{
+		Allocation: &Allocation{Segment: segmentName},
+		variants:   variants,
+	}
+	controlWeight := 100.0
+	for _, variant := range variants {
+		state.Values = append(state.Values, &ValueAllocation{Value: variant.Value, ConfiguredWeight: variant.Weight})
+		controlWeight -= variant.Weight
+	}
+	state.Values = append(state.Values, &ValueAllocation{
+		Value:            featureContext.Value,
+		Control:          true,
+		ConfiguredWeight: math.Max(controlWeight, 0),
+	})
+	return state
+}
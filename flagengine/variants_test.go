@@ -0,0 +1,99 @@
+package flagengine_test
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Flagsmith/flagsmith-go-client/v5/fixtures"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/engine_eval"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/environments"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const multivariateFeatureStateValues = `"multivariate_feature_state_values": [{
+	"multivariate_feature_option": {"value": "a"},
+	"percentage_allocation": 30,
+	"mv_fs_value_uuid": "00000000-0000-0000-0000-00000000000a"
+}, {
+	"multivariate_feature_option": {"value": "b"},
+	"percentage_allocation": 20,
+	"mv_fs_value_uuid": "00000000-0000-0000-0000-00000000000b"
+}],`
+
+func TestReportVariants(t *testing.T) {
+	// Given
+	environmentJson := strings.Replace(fixtures.EnvironmentJson, `"multivariate_feature_state_values": [],`, multivariateFeatureStateValues, 1)
+	var env environments.EnvironmentModel
+	require.NoError(t, json.Unmarshal([]byte(environmentJson), &env))
+
+	// Identity "n" is bucketed at n%
+	bucketing := utils.BucketingStrategyFunc(func(objectIds []string) float64 {
+		n, err := strconv.Atoi(strings.TrimPrefix(objectIds[1], "B62qaMZNwfiqT76p38ggrQ_"))
+		require.NoError(t, err)
+		return float64(n)
+	})
+	identifiers := []string{fixtures.OverriddenIdentifier}
+	for i := range 100 {
+		identifiers = append(identifiers, strconv.Itoa(i))
+	}
+
+	// When
+	report, err := flagengine.ReportVariants(&env, fixtures.Feature1Name, slices.Values(identifiers),
+		engine_eval.WithBucketingStrategy(bucketing))
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, fixtures.Feature1Name, report.Feature)
+	assert.Equal(t, 101, report.Identities)
+	require.Len(t, report.Allocations, 2)
+
+	overrides := report.Allocations[0]
+	assert.Equal(t, "identity_overrides", overrides.Segment)
+	assert.Equal(t, 1, overrides.Identities)
+	assert.Equal(t, []*flagengine.ValueAllocation{
+		{Value: fixtures.Feature1OverriddenValue, Control: true, ConfiguredWeight: 100, Count: 1, ObservedWeight: 100},
+	}, overrides.Values)
+
+	defaults := report.Allocations[1]
+	assert.Equal(t, "", defaults.Segment)
+	assert.Equal(t, 100, defaults.Identities)
+	require.Len(t, defaults.Values, 3)
+	expected := []struct {
+		value            any
+		control          bool
+		configuredWeight float64
+		count            int
+	}{
+		{"a", false, 30, 31},
+		{"b", false, 20, 20},
+		{fixtures.Feature1Value, true, 50, 49},
+	}
+	for i, e := range expected {
+		v := defaults.Values[i]
+		assert.Equal(t, e.value, v.Value)
+		assert.Equal(t, e.control, v.Control)
+		assert.Equal(t, e.configuredWeight, v.ConfiguredWeight)
+		assert.Equal(t, e.count, v.Count)
+		assert.InDelta(t, float64(e.count), v.ObservedWeight, 1e-9)
+		assert.InDelta(t, float64(e.count)-e.configuredWeight, v.Deviation, 1e-9)
+	}
+	assert.InDelta(t, 1, defaults.MaxDeviation(), 1e-9)
+}
+
+func TestReportVariantsReturnsErrorForUnknownFeature(t *testing.T) {
+	// Given
+	var env environments.EnvironmentModel
+	require.NoError(t, json.Unmarshal([]byte(fixtures.EnvironmentJson), &env))
+
+	// When
+	_, err := flagengine.ReportVariants(&env, "unknown", slices.Values([]string{"id"}))
+
+	// Then
+	assert.Error(t, err)
+}
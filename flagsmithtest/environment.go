@@ -0,0 +1,304 @@
+package flagsmithtest
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/environments"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/features"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/identities"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/identities/traits"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/organisations"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/projects"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/segments"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/utils"
+)
+
+// Variant is a value of a multivariate feature, served to the given percentage of identities.
+type Variant struct {
+	Value  any
+	Weight float64
+}
+
+// Environment builds the environment served by a Server. Its methods add to the environment and
+// return it, so that calls can be chained:
+//
+//	env := flagsmithtest.NewEnvironment("client_key").
+//		WithFeature("banner", true, "hello").
+//		WithSegment(flagsmithtest.NewSegment("beta").
+//			Where("plan", segments.Equal, "beta").
+//			Override("banner", true, "hello, beta tester")).
+//		WithIdentityOverride("alice", "banner", false, nil)
+//
+// Referring to a feature which was not added panics.
+type Environment struct {
+	apiKey            string
+	serverKey         string
+	name              string
+	features          []*featureSpec
+	segments          []*Segment
+	identityOverrides []*identityOverride
+}
+
+type featureSpec struct {
+	id       int
+	name     string
+	enabled  bool
+	value    any
+	variants []Variant
+}
+
+type featureOverride struct {
+	feature string
+	enabled bool
+	value   any
+}
+
+type identityOverride struct {
+	identifier string
+	overrides  []featureOverride
+}
+
+// NewEnvironment returns an empty environment with the given client-side API key. The server-side
+// key, required to fetch the environment document, is the client-side key prefixed with "ser."
+// unless set using WithServerKey.
+func NewEnvironment(apiKey string) *Environment {
+	return &Environment{apiKey: apiKey, serverKey: "ser." + apiKey, name: "Test Environment"}
+}
+
+// APIKey returns the client-side API key of the environment.
+func (e *Environment) APIKey() string {
+	return e.apiKey
+}
+
+// ServerKey returns the server-side API key of the environment.
+func (e *Environment) ServerKey() string {
+	return e.serverKey
+}
+
+// WithServerKey sets the server-side API key of the environment.
+func (e *Environment) WithServerKey(key string) *Environment {
+	e.serverKey = key
+	return e
+}
+
+// WithName sets the name of the environment.
+func (e *Environment) WithName(name string) *Environment {
+	e.name = name
+	return e
+}
+
+// WithFeature adds a feature with the given default state, or replaces the default state of an
+// existing feature.
+func (e *Environment) WithFeature(name string, enabled bool, value any) *Environment {
+	return e.WithMultivariateFeature(name, enabled, value)
+}
+
+// WithMultivariateFeature adds a feature whose value is one of the variants, by identity, or the
+// control value for the remaining percentage of identities.
+func (e *Environment) WithMultivariateFeature(name string, enabled bool, control any, variants ...Variant) *Environment {
+	if f := e.feature(name); f != nil {
+		f.enabled, f.value, f.variants = enabled, control, variants
+		return e
+	}
+	e.features = append(e.features, &featureSpec{
+		id:       len(e.features) + 1,
+		name:     name,
+		enabled:  enabled,
+		value:    control,
+		variants: variants,
+	})
+	return e
+}
+
+// WithSegment adds a segment. The segment must not be modified once added.
+func (e *Environment) WithSegment(segment *Segment) *Environment {
+	for _, o := range segment.overrides {
+		e.mustFeature(o.feature)
+	}
+	e.segments = append(e.segments, segment)
+	return e
+}
+
+// WithIdentityOverride overrides the state of a feature for the identity with the given identifier.
+func (e *Environment) WithIdentityOverride(identifier, feature string, enabled bool, value any) *Environment {
+	e.mustFeature(feature)
+	override := featureOverride{feature: feature, enabled: enabled, value: value}
+	for _, o := range e.identityOverrides {
+		if o.identifier == identifier {
+			o.overrides = append(o.overrides, override)
+			return e
+		}
+	}
+	e.identityOverrides = append(e.identityOverrides, &identityOverride{
+		identifier: identifier,
+		overrides:  []featureOverride{override},
+	})
+	return e
+}
+
+func (e *Environment) feature(name string) *featureSpec {
+	for _, f := range e.features {
+		if f.name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func (e *Environment) mustFeature(name string) *featureSpec {
+	f := e.feature(name)
+	if f == nil {
+		panic(fmt.Sprintf("flagsmithtest: unknown feature %q", name))
+	}
+	return f
+}
+
+// clone returns a copy of the environment which can be modified independently.
+func (e *Environment) clone() *Environment {
+	c := *e
+	c.features = make([]*featureSpec, len(e.features))
+	for i, f := range e.features {
+		copied := *f
+		c.features[i] = &copied
+	}
+	c.segments = append([]*Segment(nil), e.segments...)
+	c.identityOverrides = make([]*identityOverride, len(e.identityOverrides))
+	for i, o := range e.identityOverrides {
+		c.identityOverrides[i] = &identityOverride{
+			identifier: o.identifier,
+			overrides:  append([]featureOverride(nil), o.overrides...),
+		}
+	}
+	return &c
+}
+
+// Model returns the environment document model of the environment, updated at the given time.
+func (e *Environment) Model(updatedAt time.Time) *environments.EnvironmentModel {
+	uuids := 0
+	featureState := func(name string, enabled bool, value any) *features.FeatureStateModel {
+		f := e.mustFeature(name)
+		uuids++
+		return &features.FeatureStateModel{
+			Feature:          &features.FeatureModel{ID: f.id, Name: f.name, Type: f.featureType()},
+			Enabled:          enabled,
+			FeatureStateUUID: fmt.Sprintf("00000000-0000-0000-0000-%012d", uuids),
+			RawValue:         value,
+		}
+	}
+
+	env := &environments.EnvironmentModel{
+		ID:     1,
+		Name:   e.name,
+		APIKey: e.apiKey,
+		Project: &projects.ProjectModel{
+			ID:           1,
+			Name:         "Test Project",
+			Organisation: &organisations.OrganisationModel{ID: 1, Name: "Test Organisation", PersistTraitData: true},
+			Segments:     make([]*segments.SegmentModel, 0, len(e.segments)),
+		},
+		FeatureStates:     make([]*features.FeatureStateModel, 0, len(e.features)),
+		IdentityOverrides: make([]*identities.IdentityModel, 0, len(e.identityOverrides)),
+		UpdatedAt:         updatedAt,
+	}
+	variantIDs := 0
+	for _, f := range e.features {
+		fs := featureState(f.name, f.enabled, f.value)
+		fs.MultivariateFeatureStateValues = []*features.MultivariateFeatureStateValueModel{}
+		for _, v := range f.variants {
+			variantIDs++
+			id := variantIDs
+			fs.MultivariateFeatureStateValues = append(fs.MultivariateFeatureStateValues, &features.MultivariateFeatureStateValueModel{
+				ID:                        &id,
+				MultivariateFeatureOption: &features.MultivariateFeatureOptionModel{ID: id, Value: v.Value},
+				PercentageAllocation:      v.Weight,
+				MVFSValueUUID:             fmt.Sprintf("00000000-0000-0000-0001-%012d", id),
+			})
+		}
+		env.FeatureStates = append(env.FeatureStates, fs)
+	}
+	for i, s := range e.segments {
+		segment := &segments.SegmentModel{
+			ID:   i + 1,
+			Name: s.name,
+			Rules: []*segments.SegmentRuleModel{{
+				Type:       s.ruleType,
+				Rules:      []*segments.SegmentRuleModel{},
+				Conditions: append([]*segments.SegmentConditionModel{}, s.conditions...),
+			}},
+			FeatureStates: make([]*features.FeatureStateModel, 0, len(s.overrides)),
+		}
+		for _, o := range s.overrides {
+			fs := featureState(o.feature, o.enabled, o.value)
+			fs.FeatureSegment = &features.FeatureSegment{Priority: s.priority}
+			segment.FeatureStates = append(segment.FeatureStates, fs)
+		}
+		env.Project.Segments = append(env.Project.Segments, segment)
+	}
+	for _, o := range e.identityOverrides {
+		identity := &identities.IdentityModel{
+			Identifier:        o.identifier,
+			EnvironmentAPIKey: e.apiKey,
+			CreatedDate:       utils.ISOTime{Time: updatedAt},
+			IdentityUUID:      fmt.Sprintf("00000000-0000-0000-0002-%012d", len(env.IdentityOverrides)+1),
+			IdentityTraits:    []*traits.TraitModel{},
+		}
+		for _, override := range o.overrides {
+			identity.IdentityFeatures = append(identity.IdentityFeatures, featureState(override.feature, override.enabled, override.value))
+		}
+		env.IdentityOverrides = append(env.IdentityOverrides, identity)
+	}
+	return env
+}
+
+func (f *featureSpec) featureType() string {
+	if len(f.variants) > 0 {
+		return "MULTIVARIATE"
+	}
+	return "STANDARD"
+}
+
+// Segment builds a segment of an Environment. Like Environment, its methods return it so that
+// calls can be chained.
+type Segment struct {
+	name       string
+	ruleType   segments.RuleType
+	conditions []*segments.SegmentConditionModel
+	overrides  []featureOverride
+	priority   int
+}
+
+// NewSegment returns a segment with the given name, which identities match if they match every
+// condition, unless set otherwise using MatchAny.
+func NewSegment(name string) *Segment {
+	return &Segment{name: name, ruleType: segments.All}
+}
+
+// Where adds a condition on the trait with the given key.
+func (s *Segment) Where(traitKey string, operator segments.ConditionOperator, value string) *Segment {
+	s.conditions = append(s.conditions, &segments.SegmentConditionModel{
+		Operator: operator,
+		Property: traitKey,
+		Value:    value,
+	})
+	return s
+}
+
+// MatchAny makes identities match the segment if they match any of its conditions.
+func (s *Segment) MatchAny() *Segment {
+	s.ruleType = segments.Any
+	return s
+}
+
+// Override overrides the state of a feature for the identities in the segment.
+func (s *Segment) Override(feature string, enabled bool, value any) *Segment {
+	s.overrides = append(s.overrides, featureOverride{feature: feature, enabled: enabled, value: value})
+	return s
+}
+
+// WithPriority sets the priority of the segment's overrides, where the lowest value wins when an
+// identity is in several segments overriding the same feature.
+func (s *Segment) WithPriority(priority int) *Segment {
+	s.priority = priority
+	return s
+}
@@ -0,0 +1,537 @@
+// Package flagsmithtest provides an in-process fake of the Flagsmith API, for testing code which
+// uses the Flagsmith client without hand-rolling HTTP handlers.
+//
+// A Server serves an Environment built using its builder API, evaluating flags with the same
+// engine as the client's local evaluation mode:
+//
+//	server := flagsmithtest.NewServer(flagsmithtest.NewEnvironment("client_key").
+//		WithFeature("banner", true, "hello"))
+//	defer server.Close()
+//	client := flagsmith.NewClient(server.Environment().ServerKey(), server.ClientOptions()...)
+//
+// The server records the requests it receives, the analytics it is sent and the traits it
+// persists, and can inject faults such as latency, error responses and dropped realtime
+// connections.
+package flagsmithtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	flagsmith "github.com/Flagsmith/flagsmith-go-client/v5"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/engine_eval"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/environments"
+)
+
+// Endpoint identifies an endpoint of the Server, relative to its base URL.
+type Endpoint string
+
+const (
+	EndpointFlags               Endpoint = "flags/"
+	EndpointIdentities          Endpoint = "identities/"
+	EndpointEnvironmentDocument Endpoint = "environment-document/"
+	EndpointAnalytics           Endpoint = "analytics/flags/"
+	EndpointBulkIdentities      Endpoint = "bulk-identities/"
+	// EndpointStream is the realtime stream of environment updates, relative to the realtime
+	// base URL.
+	EndpointStream Endpoint = "sse/"
+)
+
+const apiPath = "/api/v1/"
+
+// Request is a request received by the Server.
+type Request struct {
+	Endpoint Endpoint
+	Method   string
+	Header   http.Header
+	Query    url.Values
+	Body     []byte
+	// StatusCode is the status code of the response.
+	StatusCode int
+}
+
+// Fault is a fault injected in the responses of an endpoint using InjectFault.
+type Fault struct {
+	// Latency delays the response, or the start of the stream.
+	Latency time.Duration
+	// StatusCode, if set, is the status code responded instead of the response.
+	StatusCode int
+	// DropStream closes realtime stream connections as soon as they are established.
+	DropStream bool
+	// Count is the number of requests the fault applies to, or zero to apply it until
+	// ClearFaults is called.
+	Count int
+}
+
+// Option configures a Server.
+type Option func(s *Server)
+
+// WithPageSize splits the identity overrides of the environment document into pages of the
+// given size, linked using Link headers. By default, the document is served in a single page.
+func WithPageSize(size int) Option {
+	return func(s *Server) {
+		s.pageSize = size
+	}
+}
+
+// Server is a fake of the Flagsmith API serving a single environment.
+type Server struct {
+	server    *httptest.Server
+	pageSize  int
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu        sync.Mutex
+	env       *Environment
+	model     *environments.EnvironmentModel
+	evalCtx   engine_eval.EngineEvaluationContext
+	revision  int
+	traits    map[string]map[string]any
+	requests  []Request
+	analytics map[string]int
+	faults    map[Endpoint]*Fault
+	streams   map[*stream]struct{}
+}
+
+// NewServer starts a Server serving the environment. The environment is copied, so that changing
+// it afterwards has no effect; use SetEnvironment or UpdateEnvironment to change the environment
+// served. The Server must be closed once done.
+func NewServer(env *Environment, options ...Option) *Server {
+	s := &Server{
+		closed:    make(chan struct{}),
+		traits:    make(map[string]map[string]any),
+		analytics: make(map[string]int),
+		faults:    make(map[Endpoint]*Fault),
+		streams:   make(map[*stream]struct{}),
+	}
+	for _, opt := range options {
+		opt(s)
+	}
+	s.publish(env.clone())
+	s.server = httptest.NewServer(s)
+	return s
+}
+
+// URL returns the base URL of the API, for use with flagsmith.WithBaseURL.
+func (s *Server) URL() string {
+	return s.server.URL + apiPath
+}
+
+// RealtimeURL returns the base URL of the realtime stream, for use with
+// flagsmith.WithRealtimeBaseURL.
+func (s *Server) RealtimeURL() string {
+	return s.server.URL + "/"
+}
+
+// ClientOptions returns the options pointing a client at the server.
+func (s *Server) ClientOptions() []flagsmith.Option {
+	return []flagsmith.Option{
+		flagsmith.WithBaseURL(s.URL()),
+		flagsmith.WithRealtimeBaseURL(s.RealtimeURL()),
+	}
+}
+
+// Close closes the realtime streams, and shuts the server down. Calling Close more than once
+// has no effect.
+func (s *Server) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		s.server.Close()
+	})
+}
+
+// Environment returns a copy of the environment served.
+func (s *Server) Environment() *Environment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.env.clone()
+}
+
+// SetEnvironment replaces the environment served, and notifies the realtime streams.
+func (s *Server) SetEnvironment(env *Environment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.publish(env.clone())
+}
+
+// UpdateEnvironment changes the environment served using update, and notifies the realtime
+// streams.
+func (s *Server) UpdateEnvironment(update func(env *Environment)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	env := s.env.clone()
+	update(env)
+	s.publish(env)
+}
+
+// publish serves env from now on. The update time is in whole seconds, so that it survives the
+// conversion to a float in realtime events, and increases with every update.
+func (s *Server) publish(env *Environment) {
+	updatedAt := time.Now().UTC().Truncate(time.Second)
+	if s.model != nil && !updatedAt.After(s.model.UpdatedAt) {
+		updatedAt = s.model.UpdatedAt.Add(time.Second)
+	}
+	s.env = env
+	s.model = env.Model(updatedAt)
+	s.evalCtx = engine_eval.MapEnvironmentDocumentToEvaluationContext(s.model)
+	s.revision++
+	for st := range s.streams {
+		st.notify()
+	}
+}
+
+// Requests returns the requests received so far, in order.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// RequestsTo returns the requests received so far by the endpoint, in order.
+func (s *Server) RequestsTo(endpoint Endpoint) []Request {
+	var requests []Request
+	for _, req := range s.Requests() {
+		if req.Endpoint == endpoint {
+			requests = append(requests, req)
+		}
+	}
+	return requests
+}
+
+// AnalyticsCounts returns the number of evaluations of each feature sent to the analytics
+// endpoint so far.
+func (s *Server) AnalyticsCounts() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.analytics)
+}
+
+// IdentityTraits returns the traits persisted for the identity with the given identifier, and
+// whether the identity exists.
+func (s *Server) IdentityTraits(identifier string) (map[string]any, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	traits, ok := s.traits[identifier]
+	return maps.Clone(traits), ok
+}
+
+// InjectFault injects the fault in the responses of the endpoint, replacing any fault injected
+// earlier.
+func (s *Server) InjectFault(endpoint Endpoint, fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[endpoint] = &fault
+}
+
+// ClearFaults removes the injected faults.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.faults)
+}
+
+// takeFault returns the fault to apply to a request to the endpoint, if any.
+func (s *Server) takeFault(endpoint Endpoint) Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fault, ok := s.faults[endpoint]
+	if !ok {
+		return Fault{}
+	}
+	if fault.Count > 0 {
+		fault.Count--
+		if fault.Count == 0 {
+			delete(s.faults, endpoint)
+		}
+	}
+	return *fault
+}
+
+func (s *Server) record(req Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, req)
+}
+
+// ServeHTTP serves the API and the realtime stream.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := endpointOf(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := Request{
+		Endpoint: endpoint,
+		Method:   r.Method,
+		Header:   r.Header.Clone(),
+		Query:    r.URL.Query(),
+		Body:     body,
+	}
+
+	fault := s.takeFault(endpoint)
+	if fault.Latency > 0 {
+		select {
+		case <-time.After(fault.Latency):
+		case <-r.Context().Done():
+			return
+		case <-s.closed:
+			return
+		}
+	}
+	if fault.StatusCode != 0 {
+		req.StatusCode = fault.StatusCode
+		s.record(req)
+		writeJSON(w, fault.StatusCode, map[string]string{"detail": "injected fault"})
+		return
+	}
+	if endpoint == EndpointStream {
+		s.serveStream(w, r, req, fault.DropStream)
+		return
+	}
+
+	resp := &response{header: w.Header(), status: http.StatusOK}
+	s.serveAPI(resp, r, endpoint, body)
+	req.StatusCode = resp.status
+	s.record(req)
+	w.WriteHeader(resp.status)
+	_, _ = w.Write(resp.body.Bytes())
+}
+
+func endpointOf(path string) (Endpoint, bool) {
+	if rest, ok := strings.CutPrefix(path, apiPath); ok {
+		switch endpoint := Endpoint(rest); endpoint {
+		case EndpointFlags, EndpointIdentities, EndpointEnvironmentDocument, EndpointAnalytics, EndpointBulkIdentities:
+			return endpoint, true
+		}
+		return "", false
+	}
+	if strings.HasPrefix(path, "/"+string(EndpointStream)) {
+		return EndpointStream, true
+	}
+	return "", false
+}
+
+// response buffers a response, so that its status code is known before it is recorded.
+type response struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *response) Header() http.Header         { return r.header }
+func (r *response) WriteHeader(status int)      { r.status = status }
+func (r *response) Write(p []byte) (int, error) { return r.body.Write(p) }
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) serveAPI(w http.ResponseWriter, r *http.Request, endpoint Endpoint, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := r.Header.Get(flagsmith.EnvironmentKeyHeader)
+	authorised := key == s.env.serverKey || (key == s.env.apiKey && endpoint != EndpointEnvironmentDocument)
+	if !authorised {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"detail": "Invalid or missing environment key"})
+		return
+	}
+	switch {
+	case endpoint == EndpointFlags && r.Method == http.MethodGet:
+		s.serveFlags(w)
+	case endpoint == EndpointIdentities && r.Method == http.MethodGet:
+		s.serveIdentity(w, identityRequest{Identifier: r.URL.Query().Get("identifier"), Transient: true})
+	case endpoint == EndpointIdentities && r.Method == http.MethodPost:
+		var req identityRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+			return
+		}
+		s.serveIdentity(w, req)
+	case endpoint == EndpointEnvironmentDocument && r.Method == http.MethodGet:
+		s.serveEnvironmentDocument(w, r)
+	case endpoint == EndpointAnalytics && r.Method == http.MethodPost:
+		var counts map[string]int
+		if err := json.Unmarshal(body, &counts); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+			return
+		}
+		for feature, count := range counts {
+			s.analytics[feature] += count
+		}
+		writeJSON(w, http.StatusOK, struct{}{})
+	case endpoint == EndpointBulkIdentities && r.Method == http.MethodPost:
+		var req struct {
+			Data []identityRequest `json:"data"`
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+			return
+		}
+		for _, identity := range req.Data {
+			s.persistTraits(identity.Identifier, identity.Traits)
+		}
+		writeJSON(w, http.StatusAccepted, struct{}{})
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"detail": "Method not allowed"})
+	}
+}
+
+type identityRequest struct {
+	Identifier string             `json:"identifier"`
+	Traits     []*flagsmith.Trait `json:"traits"`
+	Transient  bool               `json:"transient"`
+}
+
+type apiFlag struct {
+	ID      int  `json:"id"`
+	Enabled bool `json:"enabled"`
+	Value   any  `json:"feature_state_value"`
+	Feature struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+		Type string `json:"type"`
+	} `json:"feature"`
+}
+
+// flags returns the flags of the evaluation result, ordered by feature ID.
+func (s *Server) flags(result engine_eval.EvaluationResult) []apiFlag {
+	flags := make([]apiFlag, 0, len(result.Flags))
+	for _, r := range result.Flags {
+		flag := apiFlag{ID: r.Metadata.FeatureID, Enabled: r.Enabled, Value: r.Value}
+		flag.Feature.ID = r.Metadata.FeatureID
+		flag.Feature.Name = r.Name
+		flag.Feature.Type = "STANDARD"
+		if f := s.env.feature(r.Name); f != nil {
+			flag.Feature.Type = f.featureType()
+		}
+		flags = append(flags, flag)
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Feature.ID < flags[j].Feature.ID })
+	return flags
+}
+
+func (s *Server) serveFlags(w http.ResponseWriter) {
+	ec := engine_eval.EngineEvaluationContext{
+		Environment: s.evalCtx.Environment,
+		Features:    s.evalCtx.Features,
+	}
+	writeJSON(w, http.StatusOK, s.flags(flagengine.GetEvaluationResult(&ec)))
+}
+
+// serveIdentity evaluates the flags of an identity with the traits persisted for it, overridden
+// by the traits of the request. Unless the identity or a trait is transient, the traits of the
+// request are persisted.
+func (s *Server) serveIdentity(w http.ResponseWriter, req identityRequest) {
+	if req.Identifier == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": "identifier is required"})
+		return
+	}
+	traits := maps.Clone(s.traits[req.Identifier])
+	if traits == nil {
+		traits = make(map[string]any)
+	}
+	for _, t := range req.Traits {
+		if t.TraitValue == nil {
+			delete(traits, t.TraitKey)
+		} else {
+			traits[t.TraitKey] = t.TraitValue
+		}
+	}
+	if !req.Transient {
+		s.persistTraits(req.Identifier, req.Traits)
+	}
+
+	keys := make([]string, 0, len(traits))
+	for key := range traits {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	respTraits := make([]*flagsmith.Trait, 0, len(keys))
+	for _, key := range keys {
+		respTraits = append(respTraits, &flagsmith.Trait{TraitKey: key, TraitValue: traits[key]})
+	}
+	ec := engine_eval.MapContextAndIdentityDataToContext(s.evalCtx, req.Identifier, respTraits)
+	writeJSON(w, http.StatusOK, struct {
+		Identifier string             `json:"identifier"`
+		Flags      []apiFlag          `json:"flags"`
+		Traits     []*flagsmith.Trait `json:"traits"`
+	}{req.Identifier, s.flags(flagengine.GetEvaluationResult(&ec)), respTraits})
+}
+
+// persistTraits creates the identity if needed, and persists its traits other than transient
+// ones. Traits with a nil value are deleted.
+func (s *Server) persistTraits(identifier string, traits []*flagsmith.Trait) {
+	persisted, ok := s.traits[identifier]
+	if !ok {
+		persisted = make(map[string]any)
+		s.traits[identifier] = persisted
+	}
+	for _, t := range traits {
+		switch {
+		case t.Transient:
+		case t.TraitValue == nil:
+			delete(persisted, t.TraitKey)
+		default:
+			persisted[t.TraitKey] = t.TraitValue
+		}
+	}
+}
+
+// serveEnvironmentDocument serves the environment document, with identity overrides split into
+// pages if a page size is set. The ID of a page holds the revision of the environment, so that
+// pages of an environment which has since changed are not found.
+func (s *Server) serveEnvironmentDocument(w http.ResponseWriter, r *http.Request) {
+	offset := 0
+	if pageID := r.URL.Query().Get("page_id"); pageID != "" {
+		var revision int
+		_, err := fmt.Sscanf(pageID, "identity_override:%d:%d", &revision, &offset)
+		if err != nil || revision != s.revision || offset < 0 || offset > len(s.model.IdentityOverrides) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"detail": "Page not found"})
+			return
+		}
+	} else {
+		etag := `"` + strconv.Itoa(s.revision) + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", s.model.UpdatedAt.Format(http.TimeFormat))
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	overrides := s.model.IdentityOverrides[offset:]
+	if s.pageSize > 0 && len(overrides) > s.pageSize {
+		overrides = overrides[:s.pageSize]
+		next := url.Values{"page_id": {fmt.Sprintf("identity_override:%d:%d", s.revision, offset+s.pageSize)}}
+		w.Header().Set("Link", fmt.Sprintf(`<%s%s?%s>; rel="next"`, s.URL(), EndpointEnvironmentDocument, next.Encode()))
+	}
+	if offset == 0 {
+		page := *s.model
+		page.IdentityOverrides = overrides
+		writeJSON(w, http.StatusOK, &page)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		APIKey            string `json:"api_key"`
+		IdentityOverrides any    `json:"identity_overrides"`
+	}{s.model.APIKey, overrides})
+}
@@ -0,0 +1,257 @@
+package flagsmithtest_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	flagsmith "github.com/Flagsmith/flagsmith-go-client/v5"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/segments"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagsmithtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newEnvironment() *flagsmithtest.Environment {
+	return flagsmithtest.NewEnvironment("test_key").
+		WithFeature("banner", true, "hello").
+		WithFeature("checkout", false, nil).
+		WithSegment(flagsmithtest.NewSegment("beta").
+			Where("plan", segments.Equal, "beta").
+			Override("banner", true, "hello, beta tester")).
+		WithIdentityOverride("alice", "checkout", true, "new")
+}
+
+func newClient(t *testing.T, server *flagsmithtest.Server, options ...flagsmith.Option) *flagsmith.Client {
+	t.Helper()
+	options = append(server.ClientOptions(), options...)
+	client, err := flagsmith.New(server.Environment().ServerKey(), options...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func assertFlag(t *testing.T, flags flagsmith.Flags, feature string, enabled bool, value any) {
+	t.Helper()
+	flag, err := flags.GetFlag(feature)
+	require.NoError(t, err)
+	assert.Equal(t, enabled, flag.Enabled, feature)
+	assert.Equal(t, value, flag.Value, feature)
+}
+
+func TestServerEvaluatesFlagsRemotely(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server := flagsmithtest.NewServer(newEnvironment())
+	defer server.Close()
+	client := newClient(t, server)
+
+	// When
+	envFlags, err := client.GetEnvironmentFlags(ctx)
+	require.NoError(t, err)
+	betaFlags, err := client.GetIdentityFlags(ctx, "bob", []*flagsmith.Trait{{TraitKey: "plan", TraitValue: "beta"}})
+	require.NoError(t, err)
+	aliceFlags, err := client.GetIdentityFlags(ctx, "alice", nil)
+	require.NoError(t, err)
+
+	// Then
+	assertFlag(t, envFlags, "banner", true, "hello")
+	assertFlag(t, envFlags, "checkout", false, nil)
+	assertFlag(t, betaFlags, "banner", true, "hello, beta tester")
+	assertFlag(t, aliceFlags, "checkout", true, "new")
+	assert.Len(t, server.RequestsTo(flagsmithtest.EndpointFlags), 1)
+	assert.Len(t, server.RequestsTo(flagsmithtest.EndpointIdentities), 2)
+	traits, ok := server.IdentityTraits("bob")
+	assert.True(t, ok)
+	assert.Equal(t, map[string]any{"plan": "beta"}, traits)
+}
+
+func TestServerPersistsTraits(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server := flagsmithtest.NewServer(newEnvironment())
+	defer server.Close()
+	client := newClient(t, server)
+
+	// When
+	require.NoError(t, client.SetTraits(ctx, "carol", []*flagsmith.Trait{{TraitKey: "plan", TraitValue: "beta"}}))
+	flags, err := client.GetIdentityFlags(ctx, "carol", nil)
+	require.NoError(t, err)
+	require.NoError(t, client.BulkIdentify(ctx, []*flagsmith.IdentityTraits{
+		{Identifier: "dave", Traits: []*flagsmith.Trait{{TraitKey: "age", TraitValue: 42}}},
+	}))
+	_, err = client.GetFlags(ctx, &flagsmith.EvaluationContext{Identity: &flagsmith.IdentityEvaluationContext{
+		Identifier: ptr("erin"),
+		Transient:  ptr(true),
+	}})
+	require.NoError(t, err)
+
+	// Then
+	assertFlag(t, flags, "banner", true, "hello, beta tester")
+	traits, _ := server.IdentityTraits("dave")
+	assert.Equal(t, map[string]any{"age": float64(42)}, traits)
+	_, ok := server.IdentityTraits("erin")
+	assert.False(t, ok)
+}
+
+func TestServerServesPaginatedEnvironmentDocument(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	env := newEnvironment()
+	for _, identifier := range []string{"bob", "carol", "dave", "erin"} {
+		env.WithIdentityOverride(identifier, "banner", false, identifier)
+	}
+	server := flagsmithtest.NewServer(env, flagsmithtest.WithPageSize(2))
+	defer server.Close()
+
+	// When
+	client := newClient(t, server, flagsmith.WithLocalEvaluation(ctx), flagsmith.WithEnvironmentRefreshInterval(time.Hour))
+	require.Eventually(t, func() bool {
+		_, err := client.GetEnvironmentFlags(ctx)
+		return err == nil
+	}, time.Second, 5*time.Millisecond)
+	require.NoError(t, client.UpdateEnvironment(ctx))
+	flags, err := client.GetIdentityFlags(ctx, "erin", nil)
+	require.NoError(t, err)
+	aliceFlags, err := client.GetIdentityFlags(ctx, "alice", nil)
+	require.NoError(t, err)
+
+	// Then
+	assertFlag(t, flags, "banner", false, "erin")
+	assertFlag(t, aliceFlags, "checkout", true, "new")
+	requests := server.RequestsTo(flagsmithtest.EndpointEnvironmentDocument)
+	require.Len(t, requests, 4)
+	assert.Empty(t, requests[0].Query.Get("page_id"))
+	assert.NotEmpty(t, requests[1].Query.Get("page_id"))
+	assert.Empty(t, requests[3].Query.Get("page_id"))
+	assert.Equal(t, http.StatusNotModified, requests[3].StatusCode)
+}
+
+func TestServerRecordsAnalytics(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server := flagsmithtest.NewServer(newEnvironment())
+	defer server.Close()
+	client, err := flagsmith.New(server.Environment().ServerKey(),
+		append(server.ClientOptions(), flagsmith.WithAnalytics(ctx))...)
+	require.NoError(t, err)
+	flags, err := client.GetEnvironmentFlags(ctx)
+	require.NoError(t, err)
+
+	// When
+	for range 3 {
+		_, err = flags.IsFeatureEnabled("banner")
+		require.NoError(t, err)
+	}
+	_, err = flags.GetFeatureValue("checkout")
+	require.NoError(t, err)
+	require.NoError(t, client.Close())
+
+	// Then
+	assert.Equal(t, map[string]int{"banner": 3, "checkout": 1}, server.AnalyticsCounts())
+}
+
+func TestServerInjectsFaults(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server := flagsmithtest.NewServer(newEnvironment())
+	defer server.Close()
+	client := newClient(t, server, flagsmith.WithRequestTimeout(50*time.Millisecond),
+		flagsmith.WithRetryPolicy(flagsmith.RetryPolicy{MaxAttempts: 1}))
+
+	// When
+	server.InjectFault(flagsmithtest.EndpointFlags, flagsmithtest.Fault{StatusCode: http.StatusServiceUnavailable, Count: 1})
+	_, unavailableErr := client.GetEnvironmentFlags(ctx)
+	_, err := client.GetEnvironmentFlags(ctx)
+	require.NoError(t, err)
+	server.InjectFault(flagsmithtest.EndpointIdentities, flagsmithtest.Fault{Latency: time.Second})
+	_, timeoutErr := client.GetIdentityFlags(ctx, "alice", nil)
+	server.ClearFaults()
+	_, err = client.GetIdentityFlags(ctx, "alice", nil)
+
+	// Then
+	require.NoError(t, err)
+	var apiErr *flagsmith.FlagsmithAPIError
+	require.ErrorAs(t, unavailableErr, &apiErr)
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.ResponseStatusCode)
+	assert.Error(t, timeoutErr)
+	statuses := []int{}
+	for _, req := range server.RequestsTo(flagsmithtest.EndpointFlags) {
+		statuses = append(statuses, req.StatusCode)
+	}
+	assert.Equal(t, []int{http.StatusServiceUnavailable, http.StatusOK}, statuses)
+}
+
+func TestServerStreamsEnvironmentUpdates(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server := flagsmithtest.NewServer(newEnvironment())
+	defer server.Close()
+	client := newClient(t, server, flagsmith.WithLocalEvaluation(ctx), flagsmith.WithRealtime())
+	require.Eventually(t, func() bool { return server.StreamCount() == 1 }, time.Second, 5*time.Millisecond)
+	bannerValue := func() any {
+		flags, err := client.GetEnvironmentFlags(ctx)
+		require.NoError(t, err)
+		value, err := flags.GetFeatureValue("banner")
+		require.NoError(t, err)
+		return value
+	}
+
+	// When
+	server.UpdateEnvironment(func(env *flagsmithtest.Environment) {
+		env.WithFeature("banner", true, "updated")
+	})
+
+	// Then
+	assert.Eventually(t, func() bool { return bannerValue() == "updated" }, time.Second, 5*time.Millisecond)
+
+	// When
+	server.DropStreams()
+	server.UpdateEnvironment(func(env *flagsmithtest.Environment) {
+		env.WithFeature("banner", true, "updated again")
+	})
+
+	// Then
+	assert.Eventually(t, func() bool { return bannerValue() == "updated again" }, 5*time.Second, 5*time.Millisecond)
+	assert.GreaterOrEqual(t, len(server.RequestsTo(flagsmithtest.EndpointStream)), 2)
+}
+
+func TestServerRejectsInvalidKeys(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server := flagsmithtest.NewServer(newEnvironment())
+	defer server.Close()
+	client := flagsmith.NewClient("wrong_key", server.ClientOptions()...)
+	defer func() { _ = client.Close() }()
+
+	// When
+	_, err := client.GetEnvironmentFlags(ctx)
+
+	// Then
+	var apiErr *flagsmith.FlagsmithAPIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.ResponseStatusCode)
+}
+
+func TestEnvironmentPanicsOnUnknownFeature(t *testing.T) {
+	assert.PanicsWithValue(t, `flagsmithtest: unknown feature "missing"`, func() {
+		flagsmithtest.NewEnvironment("test_key").WithIdentityOverride("alice", "missing", true, nil)
+	})
+}
+
+func TestServerCloseIsIdempotent(t *testing.T) {
+	// Given
+	server := flagsmithtest.NewServer(newEnvironment())
+	t.Cleanup(server.Close)
+
+	// When
+	server.Close()
+
+	// Then
+	assert.NotPanics(t, server.Close)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,99 @@
+package flagsmithtest
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// stream is a connection to the realtime stream.
+type stream struct {
+	updates chan struct{}
+	drop    chan struct{}
+}
+
+// notify signals that the environment was updated. Updates are coalesced, since only the last
+// update time is sent.
+func (st *stream) notify() {
+	select {
+	case st.updates <- struct{}{}:
+	default:
+	}
+}
+
+// StreamCount returns the number of open connections to the realtime stream.
+func (s *Server) StreamCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams)
+}
+
+// DropStreams closes the open connections to the realtime stream. Clients reconnect unless a
+// fault is injected in EndpointStream.
+func (s *Server) DropStreams() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for st := range s.streams {
+		close(st.drop)
+		delete(s.streams, st)
+	}
+}
+
+// serveStream sends an environment_updated event with the update time of the environment when
+// the connection is established, and whenever the environment is updated.
+func (s *Server) serveStream(w http.ResponseWriter, r *http.Request, req Request, drop bool) {
+	s.mu.Lock()
+	found := r.URL.Path == "/sse/environments/"+s.env.apiKey+"/stream"
+	s.mu.Unlock()
+	if !found {
+		req.StatusCode = http.StatusNotFound
+		s.record(req)
+		http.NotFound(w, r)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	req.StatusCode = http.StatusOK
+	st := &stream{updates: make(chan struct{}, 1), drop: make(chan struct{})}
+	st.notify()
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	if !drop {
+		s.streams[st] = struct{}{}
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.streams, st)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	if drop {
+		return
+	}
+	for {
+		select {
+		case <-st.updates:
+			s.mu.Lock()
+			updatedAt := s.model.UpdatedAt.Unix()
+			s.mu.Unlock()
+			if _, err := fmt.Fprintf(w, "event: environment_updated\ndata: {\"updated_at\": %d}\n\n", updatedAt); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-st.drop:
+			return
+		case <-r.Context().Done():
+			return
+		case <-s.closed:
+			return
+		}
+	}
+}
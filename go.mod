@@ -13,11 +13,11 @@ require (
 	github.com/itlightning/dateparse v0.2.1
 	github.com/ohler55/ojg v1.28.1
 	github.com/tailscale/hujson v0.0.0-20250605163823-992244df8c5a
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/net v0.43.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,159 @@
+package flagsmith
+
+import (
+	"strings"
+)
+
+// link is a link parsed from a Link header, as defined by RFC 8288.
+type link struct {
+	target string
+	// params holds the parameters of the link by lower-case name. Only the first occurrence of
+	// a parameter is kept.
+	params map[string]string
+}
+
+// hasRel reports whether rel is one of the relation types of the link.
+func (l link) hasRel(rel string) bool {
+	for _, r := range strings.Fields(l.params["rel"]) {
+		if strings.EqualFold(r, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseLinkHeader parses the links of one or more Link header values. Malformed links are
+// skipped.
+func parseLinkHeader(values ...string) []link {
+	var links []link
+	for _, value := range values {
+		p := linkParser{s: value}
+		for !p.done() {
+			if l, ok := p.link(); ok {
+				links = append(links, l)
+			}
+		}
+	}
+	return links
+}
+
+// linkParser parses a single Link header value.
+type linkParser struct {
+	s   string
+	pos int
+}
+
+func (p *linkParser) done() bool {
+	p.skip(" \t,")
+	return p.pos >= len(p.s)
+}
+
+func (p *linkParser) skip(chars string) {
+	for p.pos < len(p.s) && strings.IndexByte(chars, p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func (p *linkParser) peek() byte {
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+// link parses a link-value, and moves past the comma which ends it.
+func (p *linkParser) link() (link, bool) {
+	if p.peek() != '<' {
+		p.skipLink()
+		return link{}, false
+	}
+	end := strings.IndexByte(p.s[p.pos:], '>')
+	if end < 0 {
+		p.pos = len(p.s)
+		return link{}, false
+	}
+	l := link{target: strings.TrimSpace(p.s[p.pos+1 : p.pos+end]), params: map[string]string{}}
+	p.pos += end + 1
+	for {
+		p.skip(" \t")
+		switch p.peek() {
+		case ';':
+			p.pos++
+			p.param(l.params)
+		case ',', 0:
+			return l, true
+		default:
+			p.skipLink()
+			return link{}, false
+		}
+	}
+}
+
+// param parses a link-param, keeping its value unless a parameter with the same name was
+// already parsed.
+func (p *linkParser) param(params map[string]string) {
+	p.skip(" \t")
+	start := p.pos
+	for p.pos < len(p.s) && strings.IndexByte("=;, \t", p.s[p.pos]) < 0 {
+		p.pos++
+	}
+	name := strings.ToLower(p.s[start:p.pos])
+	p.skip(" \t")
+	value := ""
+	if p.peek() == '=' {
+		p.pos++
+		p.skip(" \t")
+		value = p.value()
+	}
+	if _, ok := params[name]; !ok && name != "" {
+		params[name] = value
+	}
+}
+
+// value parses a token or a quoted-string.
+func (p *linkParser) value() string {
+	if p.peek() != '"' {
+		start := p.pos
+		for p.pos < len(p.s) && strings.IndexByte(";, \t", p.s[p.pos]) < 0 {
+			p.pos++
+		}
+		return p.s[start:p.pos]
+	}
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		p.pos++
+		switch {
+		case c == '"':
+			return b.String()
+		case c == '\\' && p.pos < len(p.s):
+			b.WriteByte(p.s[p.pos])
+			p.pos++
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// skipLink moves past the next comma outside of a quoted-string or URI reference.
+func (p *linkParser) skipLink() {
+	quoted, inTarget := false, false
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		p.pos++
+		switch {
+		case quoted && c == '\\':
+			p.pos++
+		case c == '"' && !inTarget:
+			quoted = !quoted
+		case c == '<' && !quoted:
+			inTarget = true
+		case c == '>' && !quoted:
+			inTarget = false
+		case c == ',' && !quoted && !inTarget:
+			return
+		}
+	}
+}
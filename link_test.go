@@ -0,0 +1,111 @@
+package flagsmith
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLinkHeader(t *testing.T) {
+	// When
+	links := parseLinkHeader(
+		`<https://example.com/a,b>; rel="next prev"; title="x; \"y\", z"; rel=ignored, malformed; rel=next`,
+		`</relative>;anchor=#top;Rel=Last`,
+	)
+
+	// Then
+	assert.Equal(t, []link{
+		{target: "https://example.com/a,b", params: map[string]string{"rel": "next prev", "title": `x; "y", z`}},
+		{target: "/relative", params: map[string]string{"anchor": "#top", "rel": "Last"}},
+	}, links)
+	assert.True(t, links[0].hasRel("prev"))
+	assert.True(t, links[1].hasRel("last"))
+	assert.False(t, links[1].hasRel("next"))
+}
+
+func TestParseLinkHeaderCases(t *testing.T) {
+	cases := []struct {
+		name     string
+		values   []string
+		expected []link
+	}{
+		{
+			name:   "quoted comma in parameter",
+			values: []string{`</a>; rel=next; title="a, b", </b>; rel=prev`},
+			expected: []link{
+				{target: "/a", params: map[string]string{"rel": "next", "title": "a, b"}},
+				{target: "/b", params: map[string]string{"rel": "prev"}},
+			},
+		},
+		{
+			name:     "comma in target",
+			values:   []string{`<https://example.com/?page_id=a,b>; rel="next"`},
+			expected: []link{{target: "https://example.com/?page_id=a,b", params: map[string]string{"rel": "next"}}},
+		},
+		{
+			name:     "multiple relation types",
+			values:   []string{`</a>; rel="prev  next"`},
+			expected: []link{{target: "/a", params: map[string]string{"rel": "prev  next"}}},
+		},
+		{
+			name:   "several headers",
+			values: []string{`</a>; rel=prev`, `</b>; rel=next, </c>; rel=last`},
+			expected: []link{
+				{target: "/a", params: map[string]string{"rel": "prev"}},
+				{target: "/b", params: map[string]string{"rel": "next"}},
+				{target: "/c", params: map[string]string{"rel": "last"}},
+			},
+		},
+		{
+			name:   "unterminated target",
+			values: []string{`</a; rel=next`},
+		},
+		{
+			name:     "missing angle brackets",
+			values:   []string{`/a; rel=next, </b>; rel=next`},
+			expected: []link{{target: "/b", params: map[string]string{"rel": "next"}}},
+		},
+		{
+			name:     "garbage after target",
+			values:   []string{`</a> junk; rel=next, </b>`},
+			expected: []link{{target: "/b", params: map[string]string{}}},
+		},
+		{
+			name:     "unterminated quoted string",
+			values:   []string{`</a>; rel="next`},
+			expected: []link{{target: "/a", params: map[string]string{"rel": "next"}}},
+		},
+		{
+			name:   "empty",
+			values: []string{"", " , "},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// When
+			links := parseLinkHeader(c.values...)
+
+			// Then
+			assert.Equal(t, c.expected, links)
+		})
+	}
+}
+
+func TestNextPageID(t *testing.T) {
+	cases := []struct {
+		name     string
+		values   []string
+		expected string
+	}{
+		{"next in a later header", []string{`</e/?page_id=a>; rel=prev`, `</e/?page_id=b>; rel=next`}, "b"},
+		{"malformed next target", []string{`<%zz>; rel=next`, `</e/?page_id=b>; rel=next`}, "b"},
+		{"no header", nil, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expected, nextPageID(c.values))
+		})
+	}
+}
@@ -144,7 +144,7 @@ func (f *Flags) GetFlag(featureName string) (Flag, error) {
 		if f.defaultFlagHandler != nil {
 			return f.defaultFlagHandler(featureName)
 		}
-		return resultFlag, &FlagsmithClientError{fmt.Sprintf("flagsmith: No feature found with name %q", featureName)}
+		return resultFlag, &FlagsmithClientError{msg: fmt.Sprintf("flagsmith: No feature found with name %q", featureName), Err: ErrFeatureNotFound}
 	}
 	if f.analyticsProcessor != nil {
 		f.analyticsProcessor.TrackFeature(resultFlag.FeatureName)
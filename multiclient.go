@@ -0,0 +1,231 @@
+package flagsmith
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// MultiClient evaluates flags locally for any number of environments, such as one environment
+// per tenant of a multi-tenant application. Flags are evaluated in the environment identified by
+// the server-side key in the EvaluationContext.
+//
+// The first use of an environment key creates a Client which fetches and updates the
+// environment, configured by the MultiClient's options. These clients share the MultiClient's HTTP
+// client and analytics processor. If WithRealtime is used, each one connects to the real-time
+// stream of its environment, and the announced updates are applied by a single shared goroutine.
+// Each client has its own circuit breaker, so that failures of one environment do not stop
+// requests for the others, and its own queue of trait writes. Environments which are not used for
+// WithIdleEnvironmentTimeout stop being updated, and are fetched again when they are next used.
+type MultiClient struct {
+	// template holds the configuration, HTTP client and analytics processor shared by all
+	// environments.
+	template *Client
+
+	mu           sync.Mutex
+	environments map[string]*multiClientEnvironment
+	closed       bool
+}
+
+type multiClientEnvironment struct {
+	client   *Client
+	lastUsed time.Time
+	// pins counts the calls using client, which is only closed once they return if the
+	// environment is evicted meanwhile.
+	pins    int
+	evicted bool
+}
+
+// NewMultiClient creates a MultiClient with the given configuration. Local evaluation is always
+// enabled, and WithLocalEvaluation only needs to be used to provide the context of the background
+// goroutines. Options providing an offline environment or a snapshot store apply to a single
+// environment, and cannot be used.
+func NewMultiClient(options ...Option) (*MultiClient, error) {
+	template := newConfiguredClient("", options)
+	template.config.localEvaluation = true
+	errs := []error{template.validateConfig()}
+	if template.offlineHandler != nil || template.config.offlineMode {
+		errs = append(errs, &ConfigError{Options: []string{"WithOfflineHandler", "WithOfflineMode"}, Err: ErrMultiClientOption})
+	}
+	if template.config.snapshotStore != nil {
+		errs = append(errs, &ConfigError{Options: []string{"WithSnapshotPath", "WithSnapshotStore"}, Err: ErrMultiClientOption})
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	template.ctxLocalEval = template.cancelOnClose(template.ctxLocalEval)
+	template.ctxAnalytics = template.cancelOnClose(template.ctxAnalytics)
+	template.client = template.newRestyClient()
+	template.breaker = template.newCircuitBreaker()
+	if template.config.enableAnalytics {
+		template.analyticsProcessor = template.newAnalyticsProcessor()
+	}
+	if template.config.useRealtime {
+		template.realtimeDispatcher = newRealtimeDispatcher()
+		go template.realtimeDispatcher.start(template.ctxLocalEval)
+	}
+
+	m := &MultiClient{
+		template:     template,
+		environments: make(map[string]*multiClientEnvironment),
+	}
+	if template.config.idleEnvTimeout > 0 {
+		go m.evictIdleEnvironments(template.ctxLocalEval, template.config.idleEnvTimeout)
+	}
+	return m, nil
+}
+
+// Client returns the Client evaluating flags in the environment with the given server-side key,
+// creating it if needed. When the environment was not used recently, Client waits until the
+// first attempt to fetch it completes, and returns ctx.Err() if ctx is done first.
+//
+// The returned Client must not be retained, since it is closed when its environment is evicted.
+func (m *MultiClient) Client(ctx context.Context, apiKey string) (*Client, error) {
+	env, err := m.pin(ctx, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	m.unpin(env)
+	return env.client, nil
+}
+
+// GetFlags evaluates the feature flags within an EvaluationContext, in the environment identified
+// by the server-side key ec.Environment.APIKey. See Client.GetFlags.
+func (m *MultiClient) GetFlags(ctx context.Context, ec *EvaluationContext) (Flags, error) {
+	if ec == nil || ec.Environment == nil {
+		return Flags{}, ErrEnvironmentKeyRequired
+	}
+	env, err := m.pin(ctx, ec.Environment.APIKey)
+	if err != nil {
+		return Flags{}, err
+	}
+	defer m.unpin(env)
+	return env.client.GetFlags(ctx, ec)
+}
+
+// pin returns the environment with the given server-side key, creating it if needed, once its
+// first fetch completes. The environment's client is not closed by eviction until unpin is called.
+func (m *MultiClient) pin(ctx context.Context, apiKey string) (*multiClientEnvironment, error) {
+	if apiKey == "" {
+		return nil, ErrEnvironmentKeyRequired
+	}
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, ErrClientClosed
+	}
+	env, ok := m.environments[apiKey]
+	if !ok {
+		c, err := m.newEnvironmentClient(apiKey)
+		if err != nil {
+			m.mu.Unlock()
+			return nil, err
+		}
+		env = &multiClientEnvironment{client: c}
+		m.environments[apiKey] = env
+	}
+	env.lastUsed = time.Now()
+	env.pins++
+	m.mu.Unlock()
+
+	select {
+	case <-env.client.initialised:
+		return env, nil
+	case <-ctx.Done():
+		m.unpin(env)
+		return nil, ctx.Err()
+	}
+}
+
+// unpin releases an environment returned by pin, closing its client if it was evicted meanwhile.
+func (m *MultiClient) unpin(env *multiClientEnvironment) {
+	m.mu.Lock()
+	env.pins--
+	closeClient := env.evicted && env.pins == 0
+	m.mu.Unlock()
+	if closeClient {
+		_ = env.client.Close()
+	}
+}
+
+// Close stops updating all environments, and flushes any pending analytics data.
+// Methods called after Close return ErrClientClosed.
+func (m *MultiClient) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	for _, env := range m.environments {
+		_ = env.client.Close()
+	}
+	m.environments = nil
+	m.mu.Unlock()
+	return m.template.Close()
+}
+
+// newEnvironmentClient creates and starts a Client for the environment, sharing the template's
+// configuration, HTTP client, analytics processor and real-time dispatcher.
+func (m *MultiClient) newEnvironmentClient(apiKey string) (*Client, error) {
+	t := m.template
+	c := &Client{
+		apiKey:             apiKey,
+		config:             t.config,
+		log:                t.log,
+		client:             t.client,
+		defaultFlagHandler: t.defaultFlagHandler,
+		errorHandler:       t.errorHandler,
+		realtimeDispatcher: t.realtimeDispatcher,
+		initialised:        make(chan struct{}),
+	}
+	if err := c.validateAPIKey(); err != nil {
+		return nil, err
+	}
+	c.breaker = c.newCircuitBreaker()
+	// Analytics data is uploaded by the template's processor.
+	c.config.enableAnalytics = false
+	if t.analyticsProcessor != nil {
+		c.analyticsProcessor = t.analyticsProcessor.forEnvironment(apiKey)
+	}
+	c.ctxLocalEval = c.cancelOnClose(t.ctxLocalEval)
+	c.ctxCache = c.cancelOnClose(t.ctxLocalEval)
+	c.traitWriter = c.newTraitWriter()
+	go c.traitWriter.start(c.cancelOnClose(nil), c.config.traitFlushInterval)
+	c.start()
+	return c, nil
+}
+
+func (m *MultiClient) evictIdleEnvironments(ctx context.Context, idleTimeout time.Duration) {
+	ticker := time.NewTicker(max(idleTimeout/2, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			m.evictEnvironmentsUnusedSince(now.Add(-idleTimeout))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *MultiClient) evictEnvironmentsUnusedSince(t time.Time) {
+	var idle []*multiClientEnvironment
+	m.mu.Lock()
+	for apiKey, env := range m.environments {
+		if env.lastUsed.Before(t) {
+			delete(m.environments, apiKey)
+			env.evicted = true
+			if env.pins == 0 {
+				idle = append(idle, env)
+			}
+		}
+	}
+	m.mu.Unlock()
+	// Closing a client flushes its queued trait writes, which must not block other environments.
+	for _, env := range idle {
+		_ = env.client.Close()
+		m.template.log.Debug("stopped updating idle environment", "last_used", env.lastUsed)
+	}
+}
@@ -0,0 +1,342 @@
+package flagsmith_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	flagsmith "github.com/Flagsmith/flagsmith-go-client/v5"
+	"github.com/Flagsmith/flagsmith-go-client/v5/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	tenantAKey = "ser.tenant_a"
+	tenantBKey = "ser.tenant_b"
+)
+
+// multiEnvironmentServer serves a different value of feature 1 to each tenant, and counts the
+// requests made with each environment key.
+type multiEnvironmentServer struct {
+	*httptest.Server
+	mu                   sync.Mutex
+	environmentDocuments map[string]int
+	identities           map[string]int
+	analytics            map[string]string
+}
+
+func newMultiEnvironmentServer(t *testing.T) *multiEnvironmentServer {
+	s := &multiEnvironmentServer{environmentDocuments: map[string]int{}, identities: map[string]int{}, analytics: map[string]string{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get(flagsmith.EnvironmentKeyHeader)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch req.URL.Path {
+		case "/api/v1/environment-document/":
+			s.environmentDocuments[key]++
+			value := strings.TrimPrefix(key, "ser.") + "_value"
+			_, err := io.WriteString(rw, strings.Replace(fixtures.EnvironmentJson,
+				`"feature_state_value": "some_value"`, `"feature_state_value": "`+value+`"`, 1))
+			assert.NoError(t, err)
+		case "/api/v1/identities/":
+			s.identities[key]++
+			_, err := io.WriteString(rw, fixtures.IdentityResponseJson)
+			assert.NoError(t, err)
+		case "/api/v1/analytics/flags/":
+			body, err := io.ReadAll(req.Body)
+			assert.NoError(t, err)
+			s.analytics[key] = string(body)
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return s
+}
+
+func (s *multiEnvironmentServer) environmentDocumentRequests(key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.environmentDocuments[key]
+}
+
+func (s *multiEnvironmentServer) identityRequests(key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.identities[key]
+}
+
+func environmentContext(apiKey string) *flagsmith.EvaluationContext {
+	return &flagsmith.EvaluationContext{Environment: &flagsmith.EnvironmentEvaluationContext{APIKey: apiKey}}
+}
+
+func TestMultiClientRoutesFlagsByEnvironmentKey(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server := newMultiEnvironmentServer(t)
+	defer server.Close()
+	client, err := flagsmith.NewMultiClient(flagsmith.WithBaseURL(server.URL + "/api/v1/"))
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	for _, key := range []string{tenantAKey, tenantBKey} {
+		// When
+		flags, err := client.GetFlags(ctx, environmentContext(key))
+
+		// Then
+		require.NoError(t, err)
+		value, err := flags.GetFeatureValue(fixtures.Feature1Name)
+		require.NoError(t, err)
+		assert.Equal(t, strings.TrimPrefix(key, "ser.")+"_value", value)
+	}
+}
+
+func TestMultiClientFetchesEachEnvironmentOnce(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server := newMultiEnvironmentServer(t)
+	defer server.Close()
+	client, err := flagsmith.NewMultiClient(flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithEnvironmentRefreshInterval(time.Hour))
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	// When
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.GetFlags(ctx, environmentContext(tenantAKey))
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	// Then
+	assert.Equal(t, 1, server.environmentDocumentRequests(tenantAKey))
+}
+
+func TestMultiClientEvictsIdleEnvironments(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server := newMultiEnvironmentServer(t)
+	defer server.Close()
+	client, err := flagsmith.NewMultiClient(flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithEnvironmentRefreshInterval(time.Hour),
+		flagsmith.WithIdleEnvironmentTimeout(20*time.Millisecond))
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	_, err = client.GetFlags(ctx, environmentContext(tenantAKey))
+	require.NoError(t, err)
+
+	// When
+	time.Sleep(100 * time.Millisecond)
+	_, err = client.GetFlags(ctx, environmentContext(tenantAKey))
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, 2, server.environmentDocumentRequests(tenantAKey))
+}
+
+func TestMultiClientUploadsAnalyticsPerEnvironment(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server := newMultiEnvironmentServer(t)
+	defer server.Close()
+	client, err := flagsmith.NewMultiClient(flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithAnalytics(ctx))
+	require.NoError(t, err)
+	for _, key := range []string{tenantAKey, tenantBKey} {
+		flags, err := client.GetFlags(ctx, environmentContext(key))
+		require.NoError(t, err)
+		_, err = flags.GetFlag(fixtures.Feature1Name)
+		require.NoError(t, err)
+	}
+
+	// When
+	require.NoError(t, client.Close())
+
+	// Then
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	expected := `{"` + fixtures.Feature1Name + `":1}`
+	assert.Equal(t, map[string]string{tenantAKey: expected, tenantBKey: expected}, server.analytics)
+}
+
+func TestMultiClientRejectsInvalidEnvironments(t *testing.T) {
+	// Given
+	client, err := flagsmith.NewMultiClient()
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	// When
+	_, missingKeyErr := client.GetFlags(context.Background(), nil)
+	_, clientKeyErr := client.GetFlags(context.Background(), environmentContext("client_side_key"))
+
+	// Then
+	assert.ErrorIs(t, missingKeyErr, flagsmith.ErrEnvironmentKeyRequired)
+	assert.ErrorIs(t, clientKeyErr, flagsmith.ErrServerKeyRequired)
+}
+
+func TestNewMultiClientRejectsSingleEnvironmentOptions(t *testing.T) {
+	// When
+	_, err := flagsmith.NewMultiClient(flagsmith.WithSnapshotPath(t.TempDir() + "/snapshot.json"))
+
+	// Then
+	assert.ErrorIs(t, err, flagsmith.ErrMultiClientOption)
+}
+
+func TestClosedMultiClientReturnsErrClientClosed(t *testing.T) {
+	// Given
+	client, err := flagsmith.NewMultiClient()
+	require.NoError(t, err)
+	require.NoError(t, client.Close())
+
+	// When
+	_, err = client.GetFlags(context.Background(), environmentContext(tenantAKey))
+
+	// Then
+	assert.ErrorIs(t, err, flagsmith.ErrClientClosed)
+}
+
+func TestMultiClientReturnsContextErrorBeforeFirstFetch(t *testing.T) {
+	// Given
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		<-release
+		_, err := io.WriteString(rw, fixtures.EnvironmentJson)
+		assert.NoError(t, err)
+	}))
+	defer server.Close()
+	defer close(release)
+	client, err := flagsmith.NewMultiClient(flagsmith.WithBaseURL(server.URL + "/api/v1/"))
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// When
+	c, err := client.Client(ctx, tenantAKey)
+
+	// Then
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Nil(t, c)
+}
+
+func TestMultiClientOpensCircuitPerEnvironment(t *testing.T) {
+	// Given: the Flagsmith API fails for tenant A only
+	ctx := context.Background()
+	healthy := newMultiEnvironmentServer(t)
+	defer healthy.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get(flagsmith.EnvironmentKeyHeader) == tenantAKey {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		healthy.Config.Handler.ServeHTTP(rw, req)
+	}))
+	defer server.Close()
+	client, err := flagsmith.NewMultiClient(flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithCircuitBreaker(1, time.Hour))
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	// When
+	tenantA, err := client.Client(ctx, tenantAKey)
+	require.NoError(t, err)
+	flags, err := client.GetFlags(ctx, environmentContext(tenantBKey))
+
+	// Then
+	assert.Equal(t, flagsmith.CircuitOpen, tenantA.CircuitState())
+	require.NoError(t, err)
+	value, err := flags.GetFeatureValue(fixtures.Feature1Name)
+	assert.NoError(t, err)
+	assert.Equal(t, "tenant_b_value", value)
+}
+
+func TestMultiClientQueuesTraitWritesPerEnvironment(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server := newMultiEnvironmentServer(t)
+	defer server.Close()
+	client, err := flagsmith.NewMultiClient(flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithEnvironmentRefreshInterval(time.Hour),
+		flagsmith.WithTraitWriteQueue(flagsmith.DefaultTraitQueueSize, time.Hour))
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	tenantA, err := client.Client(ctx, tenantAKey)
+	require.NoError(t, err)
+
+	// When
+	err = tenantA.SetTraits(ctx, "user", []*flagsmith.Trait{{TraitKey: "plan", TraitValue: "pro"}})
+
+	// Then: the write is queued until it is flushed
+	require.NoError(t, err)
+	assert.Equal(t, 0, server.identityRequests(tenantAKey))
+	require.NoError(t, tenantA.FlushTraits(ctx))
+	assert.Equal(t, 1, server.identityRequests(tenantAKey))
+}
+
+func TestMultiClientAppliesRealtimeUpdatesOfEachEnvironment(t *testing.T) {
+	// Given: a real-time stream announcing an update as soon as it is connected
+	ctx := context.Background()
+	api := newMultiEnvironmentServer(t)
+	defer api.Close()
+	stream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "text/event-stream")
+		_, err := fmt.Fprintf(rw, "data: {\"updated_at\": %d}\n\n", time.Now().Add(time.Hour).Unix())
+		assert.NoError(t, err)
+		rw.(http.Flusher).Flush()
+		<-req.Context().Done()
+	}))
+	defer stream.Close()
+	client, err := flagsmith.NewMultiClient(flagsmith.WithBaseURL(api.URL+"/api/v1/"),
+		flagsmith.WithEnvironmentRefreshInterval(time.Hour),
+		flagsmith.WithRealtime(),
+		flagsmith.WithRealtimeBaseURL(stream.URL))
+	require.NoError(t, err)
+
+	// When
+	for _, key := range []string{tenantAKey, tenantBKey} {
+		_, err := client.GetFlags(ctx, environmentContext(key))
+		require.NoError(t, err)
+	}
+
+	// Then
+	for _, key := range []string{tenantAKey, tenantBKey} {
+		assert.Eventually(t, func() bool {
+			return api.environmentDocumentRequests(key) == 2
+		}, time.Second, 10*time.Millisecond)
+	}
+	stream.CloseClientConnections()
+	require.NoError(t, client.Close())
+}
+
+func TestMultiClientKeepsEvictedEnvironmentOpenWhileInUse(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server := newMultiEnvironmentServer(t)
+	defer server.Close()
+	client, err := flagsmith.NewMultiClient(flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithEnvironmentRefreshInterval(time.Hour))
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	tenantA, unpin, err := flagsmith.PinEnvironmentForTest(client, ctx, tenantAKey)
+	require.NoError(t, err)
+
+	// When
+	flagsmith.EvictEnvironmentsForTest(client)
+
+	// Then: the client is closed once it is no longer used
+	_, err = tenantA.GetFlags(ctx, environmentContext(tenantAKey))
+	assert.NoError(t, err)
+	unpin()
+	assert.ErrorIs(t, tenantA.UpdateEnvironment(ctx), flagsmith.ErrClientClosed)
+}
@@ -1,40 +1,419 @@
 package flagsmith
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/environments"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/features"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/segments"
 )
 
+// DefaultWatchInterval is the default interval at which a WatchingFileHandler checks its file for changes.
+const DefaultWatchInterval = 10 * time.Second
+
 type OfflineHandler interface {
 	GetEnvironment() *environments.EnvironmentModel
 }
 
+// EnvironmentWatcher is implemented by offline handlers whose environment document changes over time.
+// Clients using such a handler install every reloaded environment, and report reload errors
+// through the logger and the error handler.
+type EnvironmentWatcher interface {
+	// Watch registers a function called with every newly loaded environment document,
+	// or with the error which prevented loading it, until the returned function is called.
+	Watch(func(env *environments.EnvironmentModel, err error)) (unwatch func())
+}
+
 type LocalFileHandler struct {
 	environment *environments.EnvironmentModel
 }
 
 // NewLocalFileHandler creates a new LocalFileHandler with the given path.
+// Unlike the NewOfflineHandlerFrom* constructors, it only fails for documents which cannot be
+// decoded, and accepts documents lacking fields such as api_key for backwards compatibility.
 func NewLocalFileHandler(environmentDocumentPath string) (*LocalFileHandler, error) {
 	// Read the environment document from the specified path
 	environmentDocument, err := os.ReadFile(environmentDocumentPath)
 	if err != nil {
 		return nil, err
 	}
-	var environment environments.EnvironmentModel
-	if err := json.Unmarshal(environmentDocument, &environment); err != nil {
+	environment, err := decodeEnvironmentDocument(environmentDocumentPath, environmentDocument)
+	if err != nil {
 		return nil, err
 	}
+	return &LocalFileHandler{environment: environment}, nil
+}
 
-	// Create and initialise the LocalFileHandler
-	handler := &LocalFileHandler{
-		environment: &environment,
+// NewOfflineHandlerFromFS creates a LocalFileHandler reading the environment document at the
+// given path of fsys, such as an embed.FS compiled into the binary.
+func NewOfflineHandlerFromFS(fsys fs.FS, environmentDocumentPath string) (*LocalFileHandler, error) {
+	environmentDocument, err := fs.ReadFile(fsys, environmentDocumentPath)
+	if err != nil {
+		return nil, err
 	}
+	return newLocalHandler(environmentDocumentPath, environmentDocument)
+}
 
-	return handler, nil
+// NewOfflineHandlerFromReader creates a LocalFileHandler reading the environment document from r.
+func NewOfflineHandlerFromReader(r io.Reader) (*LocalFileHandler, error) {
+	environmentDocument, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return newLocalHandler("", environmentDocument)
+}
+
+// NewOfflineHandlerFromBytes creates a LocalFileHandler parsing the given environment document.
+func NewOfflineHandlerFromBytes(environmentDocument []byte) (*LocalFileHandler, error) {
+	return newLocalHandler("", environmentDocument)
+}
+
+// NewOfflineHandlerFromEnvironment creates a LocalFileHandler serving the given environment,
+// which must not be modified afterwards.
+func NewOfflineHandlerFromEnvironment(environment *environments.EnvironmentModel) (*LocalFileHandler, error) {
+	if environment == nil {
+		return nil, &EnvironmentDocumentError{Err: errors.New("missing environment")}
+	}
+	if err := validateEnvironmentDocument("", environment); err != nil {
+		return nil, err
+	}
+	return &LocalFileHandler{environment: environment}, nil
+}
+
+func newLocalHandler(source string, environmentDocument []byte) (*LocalFileHandler, error) {
+	environment, err := parseEnvironmentDocument(source, environmentDocument)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalFileHandler{environment: environment}, nil
 }
 
 func (handler *LocalFileHandler) GetEnvironment() *environments.EnvironmentModel {
 	return handler.environment
 }
+
+// WatchingFileHandler is an OfflineHandler which reloads its environment document whenever the
+// file changes on disk. Changes are detected by polling the modification time and size of the
+// file, and confirmed using a checksum of its contents, so that no platform-specific file
+// notification mechanism is required.
+//
+// Documents which cannot be read, parsed or validated are otherwise ignored: the handler keeps
+// serving the last valid document. Reload returns the error every time the file is checked, while
+// watchers are notified once per distinct error.
+type WatchingFileHandler struct {
+	path     string
+	interval time.Duration
+
+	environment atomic.Pointer[environments.EnvironmentModel]
+
+	mu       sync.Mutex
+	modTime  time.Time
+	size     int64
+	checksum [sha256.Size]byte
+	lastErr  string
+	watchers []*environmentWatch
+}
+
+type environmentWatch struct {
+	fn func(*environments.EnvironmentModel, error)
+}
+
+// NewWatchingFileHandler loads the environment document at the given path and checks it for
+// changes every pollInterval, or DefaultWatchInterval if pollInterval is not positive, until ctx
+// is cancelled. It fails if the initial document cannot be loaded.
+func NewWatchingFileHandler(ctx context.Context, environmentDocumentPath string, pollInterval time.Duration) (*WatchingFileHandler, error) {
+	if pollInterval <= 0 {
+		pollInterval = DefaultWatchInterval
+	}
+	handler := &WatchingFileHandler{
+		path:     environmentDocumentPath,
+		interval: pollInterval,
+	}
+	if _, err := handler.reload(); err != nil {
+		return nil, err
+	}
+	go handler.watch(ctx)
+	return handler, nil
+}
+
+// GetEnvironment returns the last valid environment document.
+func (handler *WatchingFileHandler) GetEnvironment() *environments.EnvironmentModel {
+	return handler.environment.Load()
+}
+
+// Watch registers a function called after every reload attempt which changed the environment
+// document or failed. The same error is reported once, until the document is successfully
+// reloaded or fails differently. Functions are called sequentially and must not call Watch or
+// Reload. Calling the returned function unregisters fn; clients using the handler do so when
+// they are closed. The handler keeps checking its file until the context given to
+// NewWatchingFileHandler is cancelled, whether or not any function is registered.
+func (handler *WatchingFileHandler) Watch(fn func(env *environments.EnvironmentModel, err error)) func() {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	w := &environmentWatch{fn: fn}
+	handler.watchers = append(handler.watchers, w)
+	return func() {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+		handler.watchers = slices.DeleteFunc(handler.watchers, func(other *environmentWatch) bool {
+			return other == w
+		})
+	}
+}
+
+// Reload checks the file for changes immediately, reloading the environment document if needed.
+// It reports whether a new document was installed.
+func (handler *WatchingFileHandler) Reload() (bool, error) {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	env, err := handler.reload()
+	if err != nil {
+		if err.Error() != handler.lastErr {
+			handler.lastErr = err.Error()
+			handler.notify(nil, err)
+		}
+		return false, err
+	}
+	if env == nil {
+		return false, nil
+	}
+	handler.lastErr = ""
+	handler.notify(env, nil)
+	return true, nil
+}
+
+func (handler *WatchingFileHandler) watch(ctx context.Context) {
+	ticker := time.NewTicker(handler.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, _ = handler.Reload()
+		}
+	}
+}
+
+func (handler *WatchingFileHandler) notify(env *environments.EnvironmentModel, err error) {
+	for _, w := range handler.watchers {
+		w.fn(env, err)
+	}
+}
+
+// reload installs the environment document if the file changed, returning the new document,
+// or nil if the file still holds the document served. The modification time, size and checksum
+// of the file are only recorded once its document is installed, so that an invalid file is
+// checked again, and its error returned, on every reload until it is fixed.
+func (handler *WatchingFileHandler) reload() (*environments.EnvironmentModel, error) {
+	info, err := os.Stat(handler.path)
+	if err != nil {
+		return nil, err
+	}
+	if handler.environment.Load() != nil && info.ModTime().Equal(handler.modTime) && info.Size() == handler.size {
+		return nil, nil
+	}
+	data, err := os.ReadFile(handler.path)
+	if err != nil {
+		return nil, err
+	}
+	// The modification time may change without the contents changing, e.g. when the
+	// document is rewritten by a deployment tool, or restored after an invalid write.
+	checksum := sha256.Sum256(data)
+	if handler.environment.Load() != nil && checksum == handler.checksum {
+		handler.modTime, handler.size = info.ModTime(), info.Size()
+		handler.lastErr = ""
+		return nil, nil
+	}
+
+	env, err := parseEnvironmentDocument(handler.path, data)
+	if err != nil {
+		return nil, err
+	}
+	handler.modTime, handler.size, handler.checksum = info.ModTime(), info.Size(), checksum
+	handler.environment.Store(env)
+	return env, nil
+}
+
+// EnvironmentDocumentError reports an environment document which cannot be parsed, or which lacks
+// fields required to evaluate flags.
+type EnvironmentDocumentError struct {
+	// Source names the document, e.g. its path, if known.
+	Source string
+	// Path locates the offending value, e.g. feature_states[2].feature, if known.
+	Path string
+	// Line and Column locate syntax errors, starting at 1, or are zero if unknown.
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *EnvironmentDocumentError) Error() string {
+	msg := "flagsmith: invalid environment document"
+	if e.Source != "" {
+		msg += " " + e.Source
+	}
+	if e.Line > 0 {
+		msg += fmt.Sprintf(" at line %d, column %d", e.Line, e.Column)
+	}
+	if e.Path != "" {
+		msg += ": " + e.Path
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *EnvironmentDocumentError) Unwrap() error {
+	return e.Err
+}
+
+// parseEnvironmentDocument decodes and validates an environment document.
+func parseEnvironmentDocument(source string, data []byte) (*environments.EnvironmentModel, error) {
+	env, err := decodeEnvironmentDocument(source, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateEnvironmentDocument(source, env); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// decodeEnvironmentDocument decodes an environment document, locating syntax and type errors.
+func decodeEnvironmentDocument(source string, data []byte) (*environments.EnvironmentModel, error) {
+	var env environments.EnvironmentModel
+	if err := json.Unmarshal(data, &env); err != nil {
+		docErr := &EnvironmentDocumentError{Source: source, Err: err}
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			docErr.Line, docErr.Column = lineAndColumn(data, syntaxErr.Offset)
+		case errors.As(err, &typeErr):
+			// Offsets of errors raised by nested decoders are relative to the nested value,
+			// so only the field path is reliable.
+			docErr.Path = bracketedPath(typeErr.Field)
+		}
+		return nil, docErr
+	}
+	return &env, nil
+}
+
+// bracketedPath converts a field path reported by encoding/json, such as
+// project.segments.0.name, to the form used by EnvironmentDocumentError, such as
+// project.segments[0].name.
+func bracketedPath(field string) string {
+	var b strings.Builder
+	for i, part := range strings.Split(field, ".") {
+		switch {
+		case part != "" && strings.Trim(part, "0123456789") == "":
+			b.WriteString("[" + part + "]")
+		case i > 0:
+			b.WriteString("." + part)
+		default:
+			b.WriteString(part)
+		}
+	}
+	return b.String()
+}
+
+// lineAndColumn locates the byte preceding offset, where the decoder stopped, as a line and
+// column of data, starting at 1.
+func lineAndColumn(data []byte, offset int64) (int, int) {
+	position := int(min(max(offset-1, 0), int64(len(data))))
+	before := data[:position]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := position - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+// validateEnvironmentDocument checks that the document contains the fields required to evaluate flags.
+func validateEnvironmentDocument(source string, env *environments.EnvironmentModel) error {
+	invalid := func(path, format string, args ...any) error {
+		return &EnvironmentDocumentError{Source: source, Path: path, Err: fmt.Errorf(format, args...)}
+	}
+	if env.APIKey == "" {
+		return invalid("api_key", "missing api_key")
+	}
+	if err := validateFeatureStates(env.FeatureStates, "feature_states", invalid); err != nil {
+		return err
+	}
+	if env.Project != nil {
+		for i, s := range env.Project.Segments {
+			path := fmt.Sprintf("project.segments[%d]", i)
+			if s == nil {
+				return invalid(path, "missing segment")
+			}
+			if err := validateFeatureStates(s.FeatureStates, path+".feature_states", invalid); err != nil {
+				return err
+			}
+			if err := validateSegmentRules(s.Rules, path, invalid); err != nil {
+				return err
+			}
+		}
+	}
+	for i, identity := range env.IdentityOverrides {
+		path := fmt.Sprintf("identity_overrides[%d]", i)
+		if identity == nil {
+			return invalid(path, "missing identity")
+		}
+		if identity.Identifier == "" {
+			return invalid(path+".identifier", "missing identifier")
+		}
+		if err := validateFeatureStates(identity.IdentityFeatures, path+".identity_features", invalid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateFeatureStates(featureStates []*features.FeatureStateModel, path string, invalid func(path, format string, args ...any) error) error {
+	for i, state := range featureStates {
+		fsPath := fmt.Sprintf("%s[%d]", path, i)
+		switch {
+		case state == nil:
+			return invalid(fsPath, "missing feature state")
+		case state.Feature == nil:
+			return invalid(fsPath+".feature", "missing feature")
+		case state.Feature.Name == "":
+			return invalid(fsPath+".feature.name", "missing feature name")
+		}
+		for j, mv := range state.MultivariateFeatureStateValues {
+			if mv == nil || mv.MultivariateFeatureOption == nil {
+				return invalid(fmt.Sprintf("%s.multivariate_feature_state_values[%d].multivariate_feature_option", fsPath, j),
+					"missing multivariate feature option")
+			}
+		}
+	}
+	return nil
+}
+
+func validateSegmentRules(rules []*segments.SegmentRuleModel, path string, invalid func(path, format string, args ...any) error) error {
+	for i, rule := range rules {
+		rulePath := fmt.Sprintf("%s.rules[%d]", path, i)
+		if rule == nil {
+			return invalid(rulePath, "missing rule")
+		}
+		for j, condition := range rule.Conditions {
+			if condition == nil {
+				return invalid(fmt.Sprintf("%s.conditions[%d]", rulePath, j), "missing condition")
+			}
+		}
+		if err := validateSegmentRules(rule.Rules, rulePath, invalid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
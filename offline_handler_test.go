@@ -1,9 +1,21 @@
 package flagsmith_test
 
 import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	flagsmith "github.com/Flagsmith/flagsmith-go-client/v5"
+	"github.com/Flagsmith/flagsmith-go-client/v5/fixtures"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/engine_eval"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/environments"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -19,6 +31,21 @@ func TestNewLocalFileHandler(t *testing.T) {
 	assert.NotNil(t, offlineHandler)
 }
 
+func TestNewLocalFileHandlerAcceptsIncompleteDocument(t *testing.T) {
+	// Given
+	path := filepath.Join(t.TempDir(), "environment.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"name": "No API key"}`), 0o600))
+
+	// When
+	offlineHandler, err := flagsmith.NewLocalFileHandler(path)
+	_, strictErr := flagsmith.NewOfflineHandlerFromBytes([]byte(`{"name": "No API key"}`))
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, "No API key", offlineHandler.GetEnvironment().Name)
+	assert.ErrorContains(t, strictErr, "missing api_key")
+}
+
 func TestLocalFileHandlerGetEnvironment(t *testing.T) {
 	// Given
 	envJsonPath := "./fixtures/environment.json"
@@ -32,3 +59,277 @@ func TestLocalFileHandlerGetEnvironment(t *testing.T) {
 	// Then
 	assert.NotNil(t, environment.APIKey)
 }
+
+func TestWatchingFileHandlerReloadsChangedDocument(t *testing.T) {
+	// Given
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(t.TempDir(), "environment.json")
+	assert.NoError(t, os.WriteFile(path, []byte(fixtures.EnvironmentJson), 0o600))
+
+	handler, err := flagsmith.NewWatchingFileHandler(ctx, path, time.Hour)
+	assert.NoError(t, err)
+	var reloaded []string
+	var reloadErrors []error
+	_ = handler.Watch(func(env *environments.EnvironmentModel, err error) {
+		if err != nil {
+			reloadErrors = append(reloadErrors, err)
+			return
+		}
+		reloaded = append(reloaded, env.Name)
+	})
+
+	// When: the file did not change
+	changed, err := handler.Reload()
+
+	// Then
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// When: the document is rewritten
+	updated := strings.Replace(fixtures.EnvironmentJson, `"name": "Test Environment"`, `"name": "Updated Environment"`, 1)
+	assert.NoError(t, os.WriteFile(path, []byte(updated), 0o600))
+	changed, err = handler.Reload()
+
+	// Then
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "Updated Environment", handler.GetEnvironment().Name)
+	assert.Equal(t, []string{"Updated Environment"}, reloaded)
+
+	// When: the document is replaced by an invalid one
+	assert.NoError(t, os.WriteFile(path, []byte(`{"api_key": `), 0o600))
+	_, err = handler.Reload()
+
+	// Then: the last valid document is still served
+	assert.Error(t, err)
+	assert.Equal(t, "Updated Environment", handler.GetEnvironment().Name)
+	assert.Len(t, reloadErrors, 1)
+
+	// When: the invalid document is checked again
+	_, err = handler.Reload()
+
+	// Then: it is still reported as invalid, but watchers are not notified again
+	assert.Error(t, err)
+	assert.Len(t, reloadErrors, 1)
+
+	// When: the last valid document is restored
+	assert.NoError(t, os.WriteFile(path, []byte(updated), 0o600))
+	changed, err = handler.Reload()
+
+	// Then
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// When: the document becomes invalid again
+	assert.NoError(t, os.WriteFile(path, []byte(`{"api_key": `), 0o600))
+	_, err = handler.Reload()
+
+	// Then: the error is reported again
+	assert.Error(t, err)
+	assert.Len(t, reloadErrors, 2)
+}
+
+func TestClosedClientStopsWatchingOfflineHandler(t *testing.T) {
+	// Given
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(t.TempDir(), "environment.json")
+	assert.NoError(t, os.WriteFile(path, []byte(fixtures.EnvironmentJson), 0o600))
+	handler, err := flagsmith.NewWatchingFileHandler(ctx, path, time.Hour)
+	assert.NoError(t, err)
+	var reloadErrors []*flagsmith.FlagsmithAPIError
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey,
+		flagsmith.WithOfflineHandler(handler),
+		flagsmith.WithErrorHandler(func(err *flagsmith.FlagsmithAPIError) {
+			reloadErrors = append(reloadErrors, err)
+		}))
+
+	// When
+	assert.NoError(t, client.Close())
+	assert.NoError(t, os.WriteFile(path, []byte("not json"), 0o600))
+	_, err = handler.Reload()
+
+	// Then
+	assert.Error(t, err)
+	assert.Empty(t, reloadErrors)
+}
+
+func TestNewWatchingFileHandlerFailsForInvalidDocument(t *testing.T) {
+	// Given
+	path := filepath.Join(t.TempDir(), "environment.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"name": "No API key"}`), 0o600))
+
+	// When
+	_, err := flagsmith.NewWatchingFileHandler(context.Background(), path, time.Hour)
+
+	// Then
+	assert.ErrorContains(t, err, "missing api_key")
+}
+
+func TestClientServesReloadedOfflineEnvironment(t *testing.T) {
+	// Given
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(t.TempDir(), "environment.json")
+	assert.NoError(t, os.WriteFile(path, []byte(fixtures.EnvironmentJson), 0o600))
+	handler, err := flagsmith.NewWatchingFileHandler(ctx, path, time.Hour)
+	assert.NoError(t, err)
+
+	var reloadErrors []*flagsmith.FlagsmithAPIError
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey,
+		flagsmith.WithOfflineHandler(handler),
+		flagsmith.WithErrorHandler(func(err *flagsmith.FlagsmithAPIError) {
+			reloadErrors = append(reloadErrors, err)
+		}))
+
+	// When
+	updated := strings.Replace(fixtures.EnvironmentJson, `"feature_state_value": "some_value"`, `"feature_state_value": "reloaded_value"`, 1)
+	assert.NoError(t, os.WriteFile(path, []byte(updated), 0o600))
+	_, err = handler.Reload()
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, []byte("not json"), 0o600))
+	_, err = handler.Reload()
+	assert.Error(t, err)
+	_, err = handler.Reload()
+	assert.Error(t, err)
+
+	// Then: the invalid document is reported once
+	flags, err := client.GetEnvironmentFlags(ctx)
+	assert.NoError(t, err)
+	value, err := flags.GetFeatureValue(fixtures.Feature1Name)
+	assert.NoError(t, err)
+	assert.Equal(t, "reloaded_value", value)
+	assert.Len(t, reloadErrors, 1)
+}
+
+func TestErrorHandlerTellsDocumentErrorsApart(t *testing.T) {
+	// Given
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(t.TempDir(), "environment.json")
+	assert.NoError(t, os.WriteFile(path, []byte(fixtures.EnvironmentJson), 0o600))
+	handler, err := flagsmith.NewWatchingFileHandler(ctx, path, time.Hour)
+	assert.NoError(t, err)
+
+	var validationErrors, documentErrors []*flagsmith.FlagsmithAPIError
+	flagsmith.NewClient(fixtures.EnvironmentAPIKey,
+		flagsmith.WithOfflineHandler(handler),
+		flagsmith.WithErrorHandler(func(err *flagsmith.FlagsmithAPIError) {
+			var validationErr *engine_eval.ValidationError
+			var docErr *flagsmith.EnvironmentDocumentError
+			switch {
+			case errors.As(err, &validationErr):
+				validationErrors = append(validationErrors, err)
+			case errors.As(err, &docErr):
+				documentErrors = append(documentErrors, err)
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}))
+
+	// When
+	unknownOperator := strings.Replace(fixtures.EnvironmentJsonWithSegmentOverride,
+		`"operator": "EQUAL"`, `"operator": "STARTS_WITH"`, 1)
+	assert.NoError(t, os.WriteFile(path, []byte(unknownOperator), 0o600))
+	_, err = handler.Reload()
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, []byte("not json"), 0o600))
+	_, err = handler.Reload()
+	assert.Error(t, err)
+
+	// Then
+	assert.Len(t, validationErrors, 1)
+	assert.Len(t, documentErrors, 1)
+	for _, err := range append(validationErrors, documentErrors...) {
+		assert.Empty(t, err.Method)
+		assert.Empty(t, err.Endpoint)
+		assert.Zero(t, err.ResponseStatusCode)
+	}
+}
+
+//go:embed fixtures/environment.json
+var embeddedFixtures embed.FS
+
+func TestOfflineHandlerConstructors(t *testing.T) {
+	environmentJson, err := embeddedFixtures.ReadFile("fixtures/environment.json")
+	assert.NoError(t, err)
+	var environment environments.EnvironmentModel
+	assert.NoError(t, json.Unmarshal(environmentJson, &environment))
+
+	constructors := map[string]func() (*flagsmith.LocalFileHandler, error){
+		"fs": func() (*flagsmith.LocalFileHandler, error) {
+			return flagsmith.NewOfflineHandlerFromFS(embeddedFixtures, "fixtures/environment.json")
+		},
+		"reader": func() (*flagsmith.LocalFileHandler, error) {
+			return flagsmith.NewOfflineHandlerFromReader(bytes.NewReader(environmentJson))
+		},
+		"bytes": func() (*flagsmith.LocalFileHandler, error) {
+			return flagsmith.NewOfflineHandlerFromBytes(environmentJson)
+		},
+		"environment": func() (*flagsmith.LocalFileHandler, error) {
+			return flagsmith.NewOfflineHandlerFromEnvironment(&environment)
+		},
+	}
+	for name, newHandler := range constructors {
+		t.Run(name, func(t *testing.T) {
+			// When
+			handler, err := newHandler()
+
+			// Then
+			assert.NoError(t, err)
+			assert.Equal(t, environment.APIKey, handler.GetEnvironment().APIKey)
+			assert.Len(t, handler.GetEnvironment().FeatureStates, len(environment.FeatureStates))
+		})
+	}
+}
+
+func TestOfflineHandlerReportsInvalidDocuments(t *testing.T) {
+	cases := []struct {
+		name     string
+		document string
+		line     int
+		column   int
+		path     string
+	}{
+		{
+			name:     "syntax error",
+			document: "{\n  \"api_key\": \"key\",\n  \"feature_states\": [}\n}",
+			line:     3,
+			column:   22,
+		},
+		{
+			name:     "type mismatch",
+			document: `{"api_key": "key", "project": {"segments": [{"id": 1, "name": 1}]}}`,
+			path:     "project.segments[0].name",
+		},
+		{
+			name:     "missing api key",
+			document: `{"name": "Test Environment"}`,
+			path:     "api_key",
+		},
+		{
+			name:     "feature state without feature",
+			document: `{"api_key": "key", "feature_states": [{"enabled": true, "feature": {"name": "f"}}, {"enabled": true}]}`,
+			path:     "feature_states[1].feature",
+		},
+		{
+			name:     "segment rule without condition",
+			document: `{"api_key": "key", "project": {"segments": [{"id": 1, "rules": [{"type": "ALL", "rules": [{"type": "ALL", "conditions": [null]}]}]}]}}`,
+			path:     "project.segments[0].rules[0].rules[0].conditions[0]",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// When
+			_, err := flagsmith.NewOfflineHandlerFromBytes([]byte(c.document))
+
+			// Then
+			var docErr *flagsmith.EnvironmentDocumentError
+			assert.ErrorAs(t, err, &docErr)
+			assert.Equal(t, c.line, docErr.Line)
+			assert.Equal(t, c.column, docErr.Column)
+			assert.Equal(t, c.path, docErr.Path)
+		})
+	}
+}
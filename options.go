@@ -8,6 +8,8 @@ import (
 
 	"log/slog"
 
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/engine_eval"
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/utils"
 	"github.com/go-resty/resty/v2"
 )
 
@@ -27,6 +29,11 @@ var _ = []Option{
 	WithEnvironmentRefreshInterval(0),
 	WithAnalytics(context.TODO()),
 	WithRetries(3, 1*time.Second),
+	WithRetryPolicy(DefaultRetryPolicy),
+	WithTraitWriteQueue(DefaultTraitQueueSize, DefaultTraitFlushInterval),
+	WithEnvironmentDocumentLimits(1<<20, 64<<20),
+	WithEnvironmentDocumentProgressHandler(func(EnvironmentDocumentProgress) {}),
+	WithEndpointRetryPolicy(AnalyticsEndpoint, RetryPolicy{}),
 	WithCustomHeaders(nil),
 	WithDefaultHandler(nil),
 	WithProxy(""),
@@ -37,6 +44,22 @@ var _ = []Option{
 	WithSlogLogger(nil),
 	WithRestyClient(nil),
 	WithHTTPClient(nil),
+	WithTypedTraits(),
+	WithClock(nil),
+	WithOperatorRegistry(nil),
+	WithBucketingStrategy(nil),
+	WithSnapshotPath(""),
+	WithSnapshotStore(nil),
+	WithSnapshotMaxAge(0),
+	WithIdleEnvironmentTimeout(0),
+	WithOfflineFallbackAfter(0),
+	WithCache(nil),
+	WithCacheTTL(0),
+	WithStaleWhileRevalidate(0),
+	WithStaleIfError(0),
+	WithCachedTransientIdentities(),
+	WithCircuitBreaker(0, 0),
+	WithCircuitBreakerProbes(0),
 }
 
 func WithBaseURL(url string) Option {
@@ -63,12 +86,12 @@ func WithRemoteEvaluation() Option {
 	}
 }
 
+// WithRequestTimeout sets the timeout of each request made by the HTTP client created by the Client.
+// It does not bound environment updates, which may span several requests, e.g. retries.
 func WithRequestTimeout(timeout time.Duration) Option {
 	return func(c *Client) {
-		if c.config.userProvidedClient {
-			panic("options modifying the client can not be used with a custom client")
-		}
-		c.client.SetTimeout(timeout)
+		c.config.requestTimeout = timeout
+		c.config.clientSettings = append(c.config.clientSettings, "WithRequestTimeout")
 	}
 }
 
@@ -90,22 +113,51 @@ func WithAnalytics(ctx context.Context) Option {
 	}
 }
 
+// WithRetries retries failed requests up to count times, waiting waitTime between attempts.
+// Only network errors, server errors and 429 Too Many Requests responses are retried.
+// For exponential backoff, use WithRetryPolicy instead.
+//
+// Retries are made by the Client, so this option can be combined with WithHTTPClient and
+// WithRestyClient.
 func WithRetries(count int, waitTime time.Duration) Option {
 	return func(c *Client) {
-		if c.config.userProvidedClient {
-			panic("options modifying the client can not be used with a custom client")
+		c.config.retryPolicy = RetryPolicy{
+			MaxAttempts:    count + 1,
+			InitialBackoff: waitTime,
+			MaxBackoff:     waitTime,
+		}
+	}
+}
+
+// WithRetryPolicy sets the policy for retrying requests to the Flagsmith API, including
+// requests for flags, identities, environment documents, analytics and bulk identities.
+// Requests are not retried by default, see DefaultRetryPolicy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.config.retryPolicy = policy
+	}
+}
+
+// WithEndpointRetryPolicy overrides the retry policy for requests to an endpoint, given by
+// its path relative to the base URL, e.g. "identities/" or "analytics/flags/".
+func WithEndpointRetryPolicy(path string, policy RetryPolicy) Option {
+	return func(c *Client) {
+		if c.config.endpointRetryPolicies == nil {
+			c.config.endpointRetryPolicies = make(map[string]RetryPolicy)
 		}
-		c.client.SetRetryCount(count)
-		c.client.SetRetryWaitTime(waitTime)
+		c.config.endpointRetryPolicies[path] = policy
 	}
 }
 
 func WithCustomHeaders(headers map[string]string) Option {
 	return func(c *Client) {
-		if c.config.userProvidedClient {
-			panic("options modifying the client can not be used with a custom client")
+		if c.config.customHeaders == nil {
+			c.config.customHeaders = make(map[string]string, len(headers))
+		}
+		for k, v := range headers {
+			c.config.customHeaders[k] = v
 		}
-		c.client.SetHeaders(headers)
+		c.config.clientSettings = append(c.config.clientSettings, "WithCustomHeaders")
 	}
 }
 
@@ -133,20 +185,34 @@ func WithSlogLogger(logger *slog.Logger) Option {
 // The proxyURL argument is a string representing the URL of the proxy server to use, e.g. "http://proxy.example.com:8080".
 func WithProxy(proxyURL string) Option {
 	return func(c *Client) {
-		if c.config.userProvidedClient {
-			panic("options modifying the client can not be used with a custom client")
-		}
-		c.client.SetProxy(proxyURL)
+		c.config.proxyURL = proxyURL
+		c.config.clientSettings = append(c.config.clientSettings, "WithProxy")
 	}
 }
 
 // WithOfflineHandler returns an Option function that sets the offline handler.
+//
+// Combined with WithLocalEvaluation, the offline handler's environment is used as a fallback:
+// flags are evaluated against it until the environment is first fetched from the Flagsmith API,
+// and whenever the fetched environment is missing, i.e. it failed to update for longer than
+// the duration set by WithOfflineFallbackAfter.
 func WithOfflineHandler(handler OfflineHandler) Option {
 	return func(c *Client) {
 		c.offlineHandler = handler
 	}
 }
 
+// WithOfflineFallbackAfter sets how long the environment fetched in local evaluation mode is
+// used after its last successful update. Once updates have failed for longer, flags are
+// evaluated against the offline handler's environment until the next successful update.
+// Zero keeps using the last fetched environment indefinitely.
+// Disabled by default; ignored without WithOfflineHandler.
+func WithOfflineFallbackAfter(staleness time.Duration) Option {
+	return func(c *Client) {
+		c.config.offlineFallbackAfter = staleness
+	}
+}
+
 // WithOfflineMode returns an Option function that enables the offline mode.
 // NOTE: before using this option, you should set the offline handler.
 func WithOfflineMode() Option {
@@ -156,6 +222,7 @@ func WithOfflineMode() Option {
 }
 
 // WithErrorHandler provides a way to handle errors that occur during update of an environment.
+// Problems found in environment documents are reported to the handler too; see FlagsmithAPIError.
 func WithErrorHandler(handler func(handler *FlagsmithAPIError)) Option {
 	return func(c *Client) {
 		c.errorHandler = handler
@@ -192,14 +259,195 @@ func WithHTTPClient(httpClient *http.Client) Option {
 	return func(c *Client) {
 		if httpClient != nil {
 			c.httpClient = httpClient
+			c.config.customClients = append(c.config.customClients, OptionWithHTTPClient)
 		}
 	}
 }
 
+// WithRestyClient sends requests using the given resty client, whose settings are left unchanged.
+//
+// Retries configured on the resty client using SetRetryCount are made in addition to the retries
+// of WithRetries and WithRetryPolicy: each attempt of the Client's retry policy is retried by
+// resty, multiplying the number of requests. Configure retries in one place only.
 func WithRestyClient(restyClient *resty.Client) Option {
 	return func(c *Client) {
 		if restyClient != nil {
 			c.client = restyClient
+			c.config.customClients = append(c.config.customClients, OptionWithRestyClient)
+		}
+	}
+}
+
+// WithTypedTraits makes local evaluation compare trait values according to their type, as
+// described by the Flagsmith engine specification. By default, trait values are compared by
+// inferring a type from their string representation, so that e.g. the string trait "true"
+// matches a segment condition expecting the boolean true.
+func WithTypedTraits() Option {
+	return func(c *Client) {
+		c.config.typedTraits = true
+	}
+}
+
+// WithClock sets the clock used during local evaluation to resolve relative date conditions,
+// such as "now-7d:date". Defaults to time.Now; a fixed clock keeps tests deterministic.
+func WithClock(clock func() time.Time) Option {
+	return func(c *Client) {
+		c.config.clock = clock
+	}
+}
+
+// WithOperatorRegistry makes local evaluation resolve segment condition operators using the
+// given registry, allowing applications to register their own operators in addition to the
+// built-in ones. Create the registry using engine_eval.NewOperatorRegistry. Operators for
+// legacy rules, such as engine_eval.StartsWithOperator and engine_eval.InCIDROperator, are
+// provided but must be registered.
+//
+// Environments using operators missing from the registry are reported to the logger and the
+// error handler when they are loaded; conditions using such operators never match.
+func WithOperatorRegistry(registry *engine_eval.OperatorRegistry) Option {
+	return func(c *Client) {
+		c.config.operators = registry
+	}
+}
+
+// WithBucketingStrategy sets the strategy used during local evaluation to assign identities to
+// percentage buckets, for multivariate features and percentage split segments.
+// Defaults to utils.MD5Bucketing, which agrees with the Flagsmith API and other SDKs.
+func WithBucketingStrategy(strategy utils.BucketingStrategy) Option {
+	return func(c *Client) {
+		c.config.bucketing = strategy
+	}
+}
+
+// WithSnapshotPath saves every environment fetched in local evaluation mode to the given file,
+// and loads it when the client starts, so that flags can be evaluated before the first
+// successful request to the Flagsmith API. See WithSnapshotStore.
+func WithSnapshotPath(path string) Option {
+	return func(c *Client) {
+		if path != "" {
+			c.config.snapshotStore = NewFileSnapshotStore(path)
 		}
 	}
 }
+
+// WithSnapshotStore saves every environment fetched in local evaluation mode to the given store,
+// and loads the saved environment when the client starts, before the environment is first
+// fetched. Snapshots older than the maximum age set by WithSnapshotMaxAge are ignored.
+func WithSnapshotStore(store SnapshotStore) Option {
+	return func(c *Client) {
+		c.config.snapshotStore = store
+	}
+}
+
+// WithSnapshotMaxAge sets the maximum age of a snapshot loaded at startup. Older snapshots are
+// ignored. By default, snapshots are loaded regardless of their age.
+func WithSnapshotMaxAge(maxAge time.Duration) Option {
+	return func(c *Client) {
+		c.config.snapshotMaxAge = maxAge
+	}
+}
+
+// WithIdleEnvironmentTimeout sets how long a MultiClient keeps updating an environment which is
+// not used to evaluate flags. Zero disables evicting idle environments.
+// Defaults to DefaultIdleEnvironmentTimeout; Client ignores this option.
+func WithIdleEnvironmentTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.config.idleEnvTimeout = timeout
+	}
+}
+
+// WithCache caches the responses of the Flagsmith API in remote evaluation mode, so that identical
+// requests for the environment flags, or for the flags of an identity with the same traits, are
+// served from the cache for the duration set by WithCacheTTL. The cache can be shared by several
+// clients, e.g. using a Redis backed Cache. NewLRUCache provides an in-memory cache.
+//
+// Flags of transient identities are not cached, unless WithCachedTransientIdentities is used.
+// Flags of identities given traits which are not transient are never cached, since the request
+// stores the traits.
+func WithCache(cache Cache) Option {
+	return func(c *Client) {
+		c.config.cache = cache
+	}
+}
+
+// WithCacheTTL sets how long cached responses are served without contacting the Flagsmith API.
+// Defaults to DefaultCacheTTL.
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(c *Client) {
+		c.config.cacheTTL = ttl
+	}
+}
+
+// WithStaleWhileRevalidate serves cached responses for up to the given duration after they
+// expire, while the cache is updated in the background.
+func WithStaleWhileRevalidate(window time.Duration) Option {
+	return func(c *Client) {
+		c.config.staleWhileRevalidate = window
+	}
+}
+
+// WithStaleIfError serves cached responses for up to the given duration after they expire when
+// the Flagsmith API cannot be reached or returns an error.
+func WithStaleIfError(window time.Duration) Option {
+	return func(c *Client) {
+		c.config.staleIfError = window
+	}
+}
+
+// WithCachedTransientIdentities also caches the flags of transient identities.
+func WithCachedTransientIdentities() Option {
+	return func(c *Client) {
+		c.config.cacheTransientIdentities = true
+	}
+}
+
+// WithTraitWriteQueue sets the number of trait writes queued by SetTraits in local evaluation
+// mode before it blocks, and the interval at which they are sent.
+func WithTraitWriteQueue(size int, flushInterval time.Duration) Option {
+	return func(c *Client) {
+		c.config.traitQueueSize = size
+		c.config.traitFlushInterval = flushInterval
+	}
+}
+
+// WithEnvironmentDocumentLimits limits the size of each page of the environment document,
+// and of the whole document, to protect against runaway memory use. Updates fail with
+// ErrDocumentTooLarge once a limit is exceeded. Zero disables a limit.
+func WithEnvironmentDocumentLimits(maxPageBytes, maxDocumentBytes int64) Option {
+	return func(c *Client) {
+		c.config.maxDocumentPageBytes = maxPageBytes
+		c.config.maxDocumentBytes = maxDocumentBytes
+	}
+}
+
+// WithEnvironmentDocumentProgressHandler sets a handler called after every page of the
+// environment document is fetched, e.g. to record metrics.
+func WithEnvironmentDocumentProgressHandler(handler func(EnvironmentDocumentProgress)) Option {
+	return func(c *Client) {
+		c.config.documentProgressHandler = handler
+	}
+}
+
+// WithCircuitBreaker stops sending requests to the Flagsmith API for openDuration after
+// failureThreshold consecutive requests failed, due to a network error, a timeout, or a server
+// error or rate limiting response. Meanwhile, requests fail immediately with ErrCircuitOpen, so
+// that flags are provided by the default flag handler or the offline handler without delay.
+// Client.CircuitState reports the state of the circuit breaker.
+//
+// After openDuration, the circuit breaker is half-open: probe requests are let through, see
+// WithCircuitBreakerProbes, and the circuit breaker closes if they succeed or opens again if
+// any fails.
+func WithCircuitBreaker(failureThreshold int, openDuration time.Duration) Option {
+	return func(c *Client) {
+		c.config.circuitFailureThreshold = failureThreshold
+		c.config.circuitOpenDuration = openDuration
+	}
+}
+
+// WithCircuitBreakerProbes sets how many requests a half-open circuit breaker lets through at
+// a time, which must all succeed to close it. Defaults to 1.
+func WithCircuitBreakerProbes(probes int) Option {
+	return func(c *Client) {
+		c.config.circuitProbes = probes
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"log/slog"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/environments"
@@ -22,6 +23,8 @@ type realtime struct {
 	streamURL    string
 	envUpdatedAt time.Time
 	backoff      *backoff
+	// dispatcher applies the announced updates, if the stream is shared with other clients.
+	dispatcher *realtimeDispatcher
 }
 
 // newRealtime creates a new realtime instance.
@@ -36,6 +39,7 @@ func newRealtime(client *Client, ctx context.Context, streamURL string, envUpdat
 		streamURL:    streamURL,
 		envUpdatedAt: envUpdatedAt,
 		backoff:      newBackoff(),
+		dispatcher:   client.realtimeDispatcher,
 	}
 }
 
@@ -101,16 +105,75 @@ func (r *realtime) handleEvent(line string) error {
 	if err != nil {
 		return err
 	}
+	if r.dispatcher != nil {
+		r.dispatcher.dispatch(r, parsedTime)
+		return nil
+	}
+	return r.update(parsedTime)
+}
+
+// update fetches the environment if it was updated after the environment last fetched.
+func (r *realtime) update(updatedAt time.Time) error {
+	if !updatedAt.After(r.envUpdatedAt) || r.ctx.Err() != nil {
+		return nil
+	}
+	if err := r.client.UpdateEnvironment(r.ctx); err != nil {
+		return err
+	}
+	if env, ok := r.client.environment.Load().(*environments.EnvironmentModel); ok {
+		r.envUpdatedAt = env.UpdatedAt
+	}
+	return nil
+}
 
-	if parsedTime.After(r.envUpdatedAt) {
-		if err := r.client.UpdateEnvironment(r.ctx); err != nil {
-			return err
+// realtimeDispatcher applies the updates announced by the realtime streams of the clients of a
+// MultiClient on a single goroutine. The realtime API streams the events of one environment per
+// connection, but a burst of events does not start one environment update per stream at once,
+// and successive events of a stream waiting to be applied are coalesced.
+type realtimeDispatcher struct {
+	mu      sync.Mutex
+	pending map[*realtime]time.Time
+	wake    chan struct{}
+}
+
+func newRealtimeDispatcher() *realtimeDispatcher {
+	return &realtimeDispatcher{
+		pending: make(map[*realtime]time.Time),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// dispatch queues the update of the stream's environment announced at updatedAt.
+func (d *realtimeDispatcher) dispatch(r *realtime, updatedAt time.Time) {
+	d.mu.Lock()
+	if updatedAt.After(d.pending[r]) {
+		d.pending[r] = updatedAt
+	}
+	d.mu.Unlock()
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// start applies the queued updates until ctx is done.
+func (d *realtimeDispatcher) start(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
 		}
-		if env, ok := r.client.environment.Load().(*environments.EnvironmentModel); ok {
-			r.envUpdatedAt = env.UpdatedAt
+		d.mu.Lock()
+		pending := d.pending
+		d.pending = make(map[*realtime]time.Time)
+		d.mu.Unlock()
+		for r, updatedAt := range pending {
+			if err := r.update(updatedAt); err != nil {
+				r.log.Error("failed to handle event", "error", err)
+			}
 		}
 	}
-	return nil
 }
 
 func parseUpdatedAtFromSSE(line string) (time.Time, error) {
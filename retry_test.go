@@ -0,0 +1,196 @@
+package flagsmith_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	flagsmith "github.com/Flagsmith/flagsmith-go-client/v5"
+	"github.com/Flagsmith/flagsmith-go-client/v5/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var fastRetries = flagsmith.RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     5 * time.Millisecond,
+	Jitter:         0.5,
+}
+
+func TestRetryPolicyRetriesServerErrors(t *testing.T) {
+	// Given
+	var status, requests atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if requests.Add(1) == 2 {
+			status.Store(0)
+		}
+		if s := status.Load(); s != 0 {
+			rw.WriteHeader(int(s))
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		_, err := io.WriteString(rw, fixtures.FlagsJson)
+		assert.NoError(t, err)
+	}))
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithRetryPolicy(fastRetries))
+
+	// When
+	flags, err := client.GetEnvironmentFlags(context.Background())
+
+	// Then
+	require.NoError(t, err)
+	assert.Len(t, flags.AllFlags(), 1)
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestRetryPolicyDoesNotRetryClientErrors(t *testing.T) {
+	// Given
+	var status, requests atomic.Int32
+	status.Store(http.StatusBadRequest)
+	server := flakyServer(t, &status, &requests)
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithRetryPolicy(fastRetries))
+
+	// When
+	_, err := client.GetIdentityFlags(context.Background(), "identity", nil)
+
+	// Then
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestRetryPolicyGivesUpAfterMaxAttempts(t *testing.T) {
+	// Given
+	var status, requests atomic.Int32
+	status.Store(http.StatusInternalServerError)
+	server := flakyServer(t, &status, &requests)
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithRetryPolicy(fastRetries))
+
+	// When
+	err := client.UpdateEnvironment(context.Background())
+
+	// Then
+	var apiErr *flagsmith.FlagsmithAPIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusInternalServerError, apiErr.ResponseStatusCode)
+	assert.Equal(t, int32(3), requests.Load())
+}
+
+func TestRetryPolicyRespectsRetryAfter(t *testing.T) {
+	// Given
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if requests.Add(1) == 1 {
+			rw.Header().Set("Retry-After", "1")
+			rw.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		_, err := io.WriteString(rw, fixtures.FlagsJson)
+		assert.NoError(t, err)
+	}))
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithRetryPolicy(fastRetries))
+
+	// When
+	start := time.Now()
+	_, err := client.GetEnvironmentFlags(context.Background())
+
+	// Then
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestRetryPolicyBudgetStopsRetries(t *testing.T) {
+	// Given
+	var status, requests atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	server := flakyServer(t, &status, &requests)
+	defer server.Close()
+	policy := fastRetries
+	policy.MaxAttempts = 10
+	policy.InitialBackoff = 40 * time.Millisecond
+	policy.MaxBackoff = 0
+	policy.Budget = 100 * time.Millisecond
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithRetryPolicy(policy))
+
+	// When
+	start := time.Now()
+	_, err := client.GetEnvironmentFlagsFromAPI(context.Background())
+
+	// Then
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 200*time.Millisecond)
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestEndpointRetryPolicyOverridesDefault(t *testing.T) {
+	// Given
+	var status, requests atomic.Int32
+	status.Store(http.StatusBadGateway)
+	server := flakyServer(t, &status, &requests)
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithRetryPolicy(fastRetries),
+		flagsmith.WithEndpointRetryPolicy("identities/", flagsmith.RetryPolicy{}))
+
+	// When
+	_, identityErr := client.GetIdentityFlags(context.Background(), "identity", nil)
+	identityRequests := requests.Load()
+	_, flagsErr := client.GetEnvironmentFlagsFromAPI(context.Background())
+
+	// Then
+	assert.Error(t, identityErr)
+	assert.Error(t, flagsErr)
+	assert.Equal(t, int32(1), identityRequests)
+	assert.Equal(t, int32(4), requests.Load())
+}
+
+func TestRetryPolicyAppliesToAnalytics(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v1/analytics/flags/" {
+			rw.Header().Set("Content-Type", "application/json")
+			_, err := io.WriteString(rw, fixtures.FlagsJson)
+			assert.NoError(t, err)
+			return
+		}
+		if requests.Add(1) == 1 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	analyticsCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithAnalytics(analyticsCtx), flagsmith.WithRetryPolicy(fastRetries))
+	flags, err := client.GetEnvironmentFlags(ctx)
+	require.NoError(t, err)
+	_, err = flags.IsFeatureEnabled(fixtures.Feature1Name)
+	require.NoError(t, err)
+
+	// When
+	err = client.Close()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), requests.Load())
+}
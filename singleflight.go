@@ -0,0 +1,81 @@
+package flagsmith
+
+import (
+	"context"
+	"sync"
+)
+
+// flightGroup deduplicates concurrent calls with the same key, so that callers share the result
+// of a single call. The call runs with a context which keeps the values of the first caller's
+// context, and is only cancelled once every caller has stopped waiting for it. A cancelled call
+// keeps its key until it returns, and callers arriving meanwhile wait for it to return before
+// making a new call, so that calls with the same key never run concurrently.
+type flightGroup[T any] struct {
+	mu    sync.Mutex
+	calls map[string]*flight[T]
+}
+
+type flight[T any] struct {
+	done      chan struct{}
+	result    T
+	err       error
+	waiters   int
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+// do calls fn, unless a call with the same key is in flight, and waits for its result. If ctx is
+// done first, do returns ctx.Err().
+func (g *flightGroup[T]) do(ctx context.Context, key string, fn func(ctx context.Context) (T, error)) (T, error) {
+	var zero T
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flight[T])
+	}
+	f, ok := g.calls[key]
+	for ok && f.cancelled {
+		g.mu.Unlock()
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		}
+		g.mu.Lock()
+		f, ok = g.calls[key]
+	}
+	if !ok {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight[T]{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = f
+		go func() {
+			defer cancel()
+			f.result, f.err = fn(callCtx)
+			g.forget(key, f)
+			close(f.done)
+		}()
+	}
+	f.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.result, f.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			f.cancelled = true
+			f.cancel()
+		}
+		g.mu.Unlock()
+		return zero, ctx.Err()
+	}
+}
+
+func (g *flightGroup[T]) forget(key string, f *flight[T]) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.calls[key] == f {
+		delete(g.calls, key)
+	}
+}
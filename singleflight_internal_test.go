@@ -0,0 +1,46 @@
+package flagsmith
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlightGroupWaitsForCancelledCallBeforeCallingAgain(t *testing.T) {
+	// Given: a call which ignores cancellation, abandoned by its only caller
+	var g flightGroup[int]
+	var calls, running atomic.Int32
+	release := make(chan struct{})
+	fn := func(context.Context) (int, error) {
+		n := calls.Add(1)
+		if running.Add(1) > 1 {
+			t.Error("calls with the same key ran concurrently")
+		}
+		defer running.Add(-1)
+		if n == 1 {
+			<-release
+		}
+		return int(n), nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := g.do(ctx, "key", fn)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// When
+	result := make(chan int)
+	go func() {
+		n, err := g.do(context.Background(), "key", fn)
+		assert.NoError(t, err)
+		result <- n
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// Then: the next call waits for the cancelled one to return
+	assert.Equal(t, int32(1), calls.Load())
+	close(release)
+	assert.Equal(t, 2, <-result)
+}
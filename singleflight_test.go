@@ -0,0 +1,130 @@
+package flagsmith_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	flagsmith "github.com/Flagsmith/flagsmith-go-client/v5"
+	"github.com/Flagsmith/flagsmith-go-client/v5/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowServer responds with the given body after the given delay, counting requests by path.
+func slowServer(t *testing.T, delay time.Duration, body string) (*httptest.Server, func(path string) int) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		requests[req.URL.Path]++
+		mu.Unlock()
+		time.Sleep(delay)
+		rw.Header().Set("Content-Type", "application/json")
+		_, err := io.WriteString(rw, body)
+		assert.NoError(t, err)
+	}))
+	return server, func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests[path]
+	}
+}
+
+func TestConcurrentIdenticalIdentityRequestsAreCoalesced(t *testing.T) {
+	// Given
+	server, requests := slowServer(t, 50*time.Millisecond, fixtures.IdentityResponseJson)
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"))
+	traits := []*flagsmith.Trait{{TraitKey: "foo", TraitValue: "bar"}}
+
+	// When
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			identifier := "popular"
+			if i%10 == 0 {
+				identifier = "other"
+			}
+			flags, err := client.GetIdentityFlags(context.Background(), identifier, traits)
+			assert.NoError(t, err)
+			value, err := flags.GetFeatureValue(fixtures.Feature1Name)
+			assert.NoError(t, err)
+			assert.Equal(t, fixtures.Feature1Value, value)
+		}()
+	}
+	wg.Wait()
+
+	// Then
+	assert.Equal(t, 2, requests("/api/v1/identities/"))
+}
+
+func TestCoalescedRequestSurvivesCancellationOfOneCaller(t *testing.T) {
+	// Given
+	server, requests := slowServer(t, 50*time.Millisecond, fixtures.FlagsJson)
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"))
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+
+	// When
+	var cancelledErr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, cancelledErr = client.GetEnvironmentFlagsFromAPI(cancelledCtx)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	done := make(chan struct{})
+	var flags flagsmith.Flags
+	var err error
+	go func() {
+		defer close(done)
+		flags, err = client.GetEnvironmentFlagsFromAPI(context.Background())
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	wg.Wait()
+	<-done
+
+	// Then
+	assert.ErrorIs(t, cancelledErr, context.Canceled)
+	var apiErr *flagsmith.FlagsmithAPIError
+	assert.True(t, errors.As(cancelledErr, &apiErr))
+	require.NoError(t, err)
+	assert.Len(t, flags.AllFlags(), 1)
+	assert.Equal(t, 1, requests("/api/v1/flags/"))
+}
+
+func TestConcurrentEnvironmentUpdatesAreCoalesced(t *testing.T) {
+	// Given
+	server, requests := slowServer(t, 50*time.Millisecond, fixtures.EnvironmentJson)
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"))
+	var errs atomic.Int32
+
+	// When
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if client.UpdateEnvironment(context.Background()) != nil {
+				errs.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Then
+	assert.Zero(t, errs.Load())
+	assert.Equal(t, 1, requests("/api/v1/environment-document/"))
+}
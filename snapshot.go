@@ -0,0 +1,127 @@
+package flagsmith
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/environments"
+)
+
+// ErrNoSnapshot is returned by SnapshotStore.LoadSnapshot when no snapshot was saved yet.
+var ErrNoSnapshot = errors.New("flagsmith: no environment snapshot")
+
+// SnapshotStore persists the last environment fetched in local evaluation mode, so that a
+// client can evaluate flags before it reaches the Flagsmith API, e.g. after a restart during an
+// outage. Implementations must be safe for concurrent use.
+type SnapshotStore interface {
+	// SaveSnapshot replaces the saved snapshot with the given environment. Readers must never
+	// observe a partially written snapshot.
+	SaveSnapshot(ctx context.Context, env *environments.EnvironmentModel) error
+	// LoadSnapshot returns the saved environment and the time it was saved,
+	// or ErrNoSnapshot if there is none.
+	LoadSnapshot(ctx context.Context) (*environments.EnvironmentModel, time.Time, error)
+}
+
+// FileSnapshotStore is a SnapshotStore saving the environment document as a JSON file.
+type FileSnapshotStore struct {
+	path string
+}
+
+// NewFileSnapshotStore creates a FileSnapshotStore writing to the given path.
+// The directory containing the file must exist.
+func NewFileSnapshotStore(path string) *FileSnapshotStore {
+	return &FileSnapshotStore{path: path}
+}
+
+// SaveSnapshot writes the environment to a temporary file which then atomically replaces the snapshot.
+func (s *FileSnapshotStore) SaveSnapshot(_ context.Context, env *environments.EnvironmentModel) error {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
+
+// LoadSnapshot reads the snapshot file. The modification time of the file is used as the time
+// the snapshot was saved.
+func (s *FileSnapshotStore) LoadSnapshot(_ context.Context) (*environments.EnvironmentModel, time.Time, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, time.Time{}, ErrNoSnapshot
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	env, err := parseEnvironmentDocument(s.path, data)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return env, info.ModTime(), nil
+}
+
+// loadSnapshot installs the environment saved in the snapshot store, unless it is older than
+// the configured maximum age.
+func (c *Client) loadSnapshot(ctx context.Context) {
+	env, savedAt, err := c.config.snapshotStore.LoadSnapshot(ctx)
+	if err == nil && env == nil {
+		err = ErrNoSnapshot
+	}
+	if errors.Is(err, ErrNoSnapshot) {
+		c.log.Debug("no environment snapshot to load")
+		return
+	}
+	if err == nil {
+		err = validateEnvironmentDocument("", env)
+	}
+	if err != nil {
+		c.log.Warn("failed to load environment snapshot", "error", err)
+		return
+	}
+	if age := time.Since(savedAt); c.config.snapshotMaxAge > 0 && age > c.config.snapshotMaxAge {
+		c.log.Warn("ignoring environment snapshot older than the configured maximum age",
+			"age", age, "max_age", c.config.snapshotMaxAge)
+		return
+	}
+	c.setEnvironment(env)
+	if savedAt.IsZero() {
+		savedAt = time.Now()
+	}
+	c.markEnvironmentUpdated(savedAt)
+	c.log.Info("environment loaded from snapshot", "environment", env.APIKey, "updated_at", env.UpdatedAt, "saved_at", savedAt)
+}
+
+// saveSnapshot saves a newly fetched environment to the snapshot store, if one is configured.
+// Failures are logged, since they do not prevent evaluating flags.
+func (c *Client) saveSnapshot(ctx context.Context, env *environments.EnvironmentModel) {
+	if c.config.snapshotStore == nil {
+		return
+	}
+	if err := c.config.snapshotStore.SaveSnapshot(ctx, env); err != nil {
+		c.log.Warn("failed to save environment snapshot", "error", err)
+	}
+}
@@ -0,0 +1,91 @@
+package flagsmith_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	flagsmith "github.com/Flagsmith/flagsmith-go-client/v5"
+	"github.com/Flagsmith/flagsmith-go-client/v5/fixtures"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientWarmStartsFromSnapshot(t *testing.T) {
+	// Given: a client which fetched the environment and saved a snapshot
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	snapshotPath := filepath.Join(t.TempDir(), "environment.json")
+
+	server := httptest.NewServer(http.HandlerFunc(fixtures.EnvironmentDocumentHandler))
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey,
+		flagsmith.WithLocalEvaluation(ctx),
+		flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithSnapshotPath(snapshotPath))
+	assert.NoError(t, client.UpdateEnvironment(ctx))
+
+	// And: the Flagsmith API is down
+	unavailable := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = io.WriteString(rw, "unavailable")
+	}))
+	defer unavailable.Close()
+
+	// When
+	restarted := flagsmith.NewClient(fixtures.EnvironmentAPIKey,
+		flagsmith.WithLocalEvaluation(ctx),
+		flagsmith.WithBaseURL(unavailable.URL+"/api/v1/"),
+		flagsmith.WithSnapshotPath(snapshotPath))
+
+	// Then
+	flags, err := restarted.GetIdentityFlags(ctx, fixtures.OverriddenIdentifier, nil)
+	assert.NoError(t, err)
+	value, err := flags.GetFeatureValue(fixtures.Feature1Name)
+	assert.NoError(t, err)
+	assert.Equal(t, fixtures.Feature1OverriddenValue, value)
+}
+
+func TestClientIgnoresSnapshotOlderThanMaxAge(t *testing.T) {
+	// Given
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	snapshotPath := filepath.Join(t.TempDir(), "environment.json")
+	store := flagsmith.NewFileSnapshotStore(snapshotPath)
+	handler, err := flagsmith.NewOfflineHandlerFromBytes([]byte(fixtures.EnvironmentJson))
+	assert.NoError(t, err)
+	assert.NoError(t, store.SaveSnapshot(ctx, handler.GetEnvironment()))
+	savedAt := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, os.Chtimes(snapshotPath, savedAt, savedAt))
+
+	unavailable := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+
+	// When
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey,
+		flagsmith.WithLocalEvaluation(ctx),
+		flagsmith.WithBaseURL(unavailable.URL+"/api/v1/"),
+		flagsmith.WithSnapshotStore(store),
+		flagsmith.WithSnapshotMaxAge(time.Hour))
+
+	// Then
+	_, err = client.GetEnvironmentFlags(ctx)
+	assert.Error(t, err)
+}
+
+func TestFileSnapshotStoreReportsMissingSnapshot(t *testing.T) {
+	// Given
+	store := flagsmith.NewFileSnapshotStore(filepath.Join(t.TempDir(), "environment.json"))
+
+	// When
+	_, _, err := store.LoadSnapshot(context.Background())
+
+	// Then
+	assert.ErrorIs(t, err, flagsmith.ErrNoSnapshot)
+}
@@ -1,8 +1,6 @@
 package trait
 
 import (
-	"fmt"
-
 	"github.com/Flagsmith/flagsmith-go-client/v5/flagengine/identities/traits"
 )
 
@@ -13,10 +11,7 @@ type Trait struct {
 	Transient  bool        `json:"transient,omitempty"`
 }
 
-// ToTraitModel converts a Trait to a TraitModel.
+// ToTraitModel converts a Trait to a TraitModel, preserving the type of its value.
 func (t *Trait) ToTraitModel() *traits.TraitModel {
-	return &traits.TraitModel{
-		TraitKey:   t.TraitKey,
-		TraitValue: fmt.Sprint(t.TraitValue),
-	}
+	return traits.NewTraitModel(t.TraitKey, t.TraitValue)
 }
@@ -0,0 +1,250 @@
+package flagsmith
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTraitQueueSize is the number of trait writes queued in local evaluation mode before
+	// SetTraits blocks, unless set using WithTraitWriteQueue.
+	DefaultTraitQueueSize = 1000
+	// DefaultTraitFlushInterval is the interval at which queued trait writes are sent in local
+	// evaluation mode, unless set using WithTraitWriteQueue.
+	DefaultTraitFlushInterval = time.Second
+
+	// traitBatchSize is the number of identities with pending trait writes which triggers
+	// sending them before the flush interval.
+	traitBatchSize = 100
+	// traitSendConcurrency is the maximum number of identities whose queued trait writes are
+	// sent concurrently.
+	traitSendConcurrency = 8
+)
+
+// SetTraits persists the traits of the identity with the given identifier, creating the identity
+// if it does not exist. Traits with a nil value are deleted. Unlike GetIdentityFlags, flags are
+// not evaluated. The identity is never transient, and transient traits are rejected with
+// ErrTransientTrait, since they would not be persisted. Nil traits are rejected with ErrNilTrait.
+//
+// With remote evaluation, the traits are sent before SetTraits returns. In local evaluation mode,
+// they are queued and sent in the background, merging writes to the same identity; SetTraits
+// blocks while the queue is full, until ctx is done. Failures of queued writes are logged and
+// reported to the error handler. Use FlushTraits to wait for queued writes to be sent.
+func (c *Client) SetTraits(ctx context.Context, identifier string, traits []*Trait) error {
+	if c.closed.Load() {
+		return ErrClientClosed
+	}
+	if c.config.offlineMode {
+		return &FlagsmithClientError{msg: "flagsmith: traits cannot be set in offline mode", Err: ErrOfflineMode}
+	}
+	if identifier == "" {
+		return &FlagsmithClientError{msg: "flagsmith: identifier is required to set traits", Err: ErrIdentifierRequired}
+	}
+	for _, trait := range traits {
+		if trait == nil {
+			return &FlagsmithClientError{msg: "flagsmith: traits of " + identifier + " cannot be nil", Err: ErrNilTrait}
+		}
+		if trait.Transient {
+			return &FlagsmithClientError{msg: "flagsmith: transient trait " + trait.TraitKey + " cannot be set", Err: ErrTransientTrait}
+		}
+	}
+	if c.traitWriter != nil {
+		return c.traitWriter.enqueue(ctx, traitWrite{identifier: identifier, traits: traits})
+	}
+	return c.sendTraits(ctx, identifier, traits)
+}
+
+// DeleteTrait deletes a trait of the identity with the given identifier, as SetTraits does for
+// traits with a nil value.
+func (c *Client) DeleteTrait(ctx context.Context, identifier, traitKey string) error {
+	return c.SetTraits(ctx, identifier, []*Trait{{TraitKey: traitKey, TraitValue: nil}})
+}
+
+// FlushTraits waits until the trait writes queued in local evaluation mode are sent, and returns
+// their errors. Without a queue, it returns nil immediately.
+func (c *Client) FlushTraits(ctx context.Context) error {
+	if c.traitWriter == nil {
+		return nil
+	}
+	return c.traitWriter.flush(ctx)
+}
+
+// sendTraits sends the traits of an identity to the identities endpoint.
+func (c *Client) sendTraits(ctx context.Context, identifier string, traits []*Trait) error {
+	body := struct {
+		Identifier string   `json:"identifier"`
+		Traits     []*Trait `json:"traits"`
+	}{Identifier: identifier, Traits: traits}
+	endpoint := c.config.baseURL + "identities/"
+	resp, err := c.execute(c.newRequest(ctx).SetBody(&body), http.MethodPost, endpoint)
+	if err != nil || !resp.IsSuccess() {
+		return newAPIError(http.MethodPost, endpoint, resp, err)
+	}
+	return nil
+}
+
+type traitWrite struct {
+	identifier string
+	traits     []*Trait
+}
+
+type flushRequest struct {
+	ctx  context.Context
+	done chan error
+}
+
+// traitWriter sends trait writes queued in local evaluation mode in the background.
+type traitWriter struct {
+	client        *Client
+	queue         chan traitWrite
+	flushRequests chan flushRequest
+	stopped       chan struct{}
+	log           *slog.Logger
+
+	// pending holds the traits to send by identifier, and order the identifiers in the order
+	// they were first written. They are only accessed by the writer's goroutine.
+	pending map[string]map[string]*Trait
+	order   []string
+}
+
+func (c *Client) newTraitWriter() *traitWriter {
+	return &traitWriter{
+		client:        c,
+		queue:         make(chan traitWrite, c.config.traitQueueSize),
+		flushRequests: make(chan flushRequest),
+		stopped:       make(chan struct{}),
+		log:           c.log.With(slog.String("worker", "traits")),
+		pending:       make(map[string]map[string]*Trait),
+	}
+}
+
+// enqueue queues the write, blocking while the queue is full.
+func (w *traitWriter) enqueue(ctx context.Context, write traitWrite) error {
+	select {
+	case w.queue <- write:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-w.stopped:
+		return ErrClientClosed
+	}
+}
+
+// flush asks the writer to send every queued write, and waits for the result.
+func (w *traitWriter) flush(ctx context.Context) error {
+	req := flushRequest{ctx: ctx, done: make(chan error, 1)}
+	select {
+	case w.flushRequests <- req:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-w.stopped:
+		return ErrClientClosed
+	}
+	select {
+	case err := <-req.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// start sends queued writes at every interval, and once a batch is full, until ctx is done.
+func (w *traitWriter) start(ctx context.Context, interval time.Duration) {
+	defer close(w.stopped)
+	if interval <= 0 {
+		interval = DefaultTraitFlushInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case write := <-w.queue:
+			w.add(write)
+			if len(w.order) >= traitBatchSize {
+				w.report(w.send(ctx))
+			}
+		case <-ticker.C:
+			w.report(w.send(ctx))
+		case req := <-w.flushRequests:
+			w.drain()
+			req.done <- errors.Join(w.send(req.ctx)...)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// add merges the write into the pending writes, so that the last value of a trait wins.
+func (w *traitWriter) add(write traitWrite) {
+	traits, ok := w.pending[write.identifier]
+	if !ok {
+		traits = make(map[string]*Trait, len(write.traits))
+		w.pending[write.identifier] = traits
+		w.order = append(w.order, write.identifier)
+	}
+	for _, trait := range write.traits {
+		traits[trait.TraitKey] = trait
+	}
+}
+
+// drain adds the writes waiting in the queue to the pending writes.
+func (w *traitWriter) drain() {
+	for {
+		select {
+		case write := <-w.queue:
+			w.add(write)
+		default:
+			return
+		}
+	}
+}
+
+// send sends the pending writes, one request per identity to the identities endpoint, with up
+// to traitSendConcurrency requests in flight. The bulk-identities endpoint is not used, since it
+// replaces every trait of the identities, and is only available on the Edge API.
+// Failed writes are dropped.
+func (w *traitWriter) send(ctx context.Context) []error {
+	if len(w.order) == 0 {
+		return nil
+	}
+	errs := make([]error, len(w.order))
+	sem := make(chan struct{}, traitSendConcurrency)
+	var wg sync.WaitGroup
+	for i, identifier := range w.order {
+		traits := make([]*Trait, 0, len(w.pending[identifier]))
+		for _, trait := range w.pending[identifier] {
+			traits = append(traits, trait)
+		}
+		slices.SortFunc(traits, func(a, b *Trait) int { return strings.Compare(a.TraitKey, b.TraitKey) })
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = w.client.sendTraits(ctx, identifier, traits)
+		}()
+	}
+	wg.Wait()
+	errs = slices.DeleteFunc(errs, func(err error) bool { return err == nil })
+	w.log.Debug("trait writes sent", "identities", len(w.order), "failed", len(errs))
+	clear(w.pending)
+	w.order = w.order[:0]
+	return errs
+}
+
+// report logs the errors of writes sent in the background, and reports them to the error handler.
+func (w *traitWriter) report(errs []error) {
+	for _, err := range errs {
+		w.log.Warn("failed to send trait writes", "error", err)
+		var apiErr *FlagsmithAPIError
+		if w.client.errorHandler != nil && errors.As(err, &apiErr) {
+			w.client.errorHandler(apiErr)
+		}
+	}
+}
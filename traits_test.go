@@ -0,0 +1,204 @@
+package flagsmith_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	flagsmith "github.com/Flagsmith/flagsmith-go-client/v5"
+	"github.com/Flagsmith/flagsmith-go-client/v5/fixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type identityWrite struct {
+	Identifier string             `json:"identifier"`
+	Traits     []*flagsmith.Trait `json:"traits"`
+}
+
+// traitsServer serves the environment document, and records the bodies posted to the identities
+// endpoint. Identity requests wait until release is closed, if it is not nil.
+func traitsServer(t *testing.T, release chan struct{}) (*httptest.Server, func() []identityWrite) {
+	var mu sync.Mutex
+	var writes []identityWrite
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		if req.URL.Path == "/api/v1/environment-document/" {
+			_, err := io.WriteString(rw, fixtures.EnvironmentJson)
+			assert.NoError(t, err)
+			return
+		}
+		assert.Equal(t, "/api/v1/identities/", req.URL.Path)
+		if release != nil {
+			<-release
+		}
+		var write identityWrite
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&write))
+		mu.Lock()
+		writes = append(writes, write)
+		mu.Unlock()
+		_, err := io.WriteString(rw, fixtures.IdentityResponseJson)
+		assert.NoError(t, err)
+	}))
+	return server, func() []identityWrite {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]identityWrite(nil), writes...)
+	}
+}
+
+func TestSetTraitsSendsTraitsWithRemoteEvaluation(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server, writes := traitsServer(t, nil)
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"))
+
+	// When
+	err := client.SetTraits(ctx, "identity", []*flagsmith.Trait{{TraitKey: "plan", TraitValue: "pro"}})
+	require.NoError(t, err)
+	err = client.DeleteTrait(ctx, "identity", "age")
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, []identityWrite{
+		{Identifier: "identity", Traits: []*flagsmith.Trait{{TraitKey: "plan", TraitValue: "pro"}}},
+		{Identifier: "identity", Traits: []*flagsmith.Trait{{TraitKey: "age", TraitValue: nil}}},
+	}, writes())
+}
+
+func TestSetTraitsRejectsInvalidWrites(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server, writes := traitsServer(t, nil)
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"))
+	offlineHandler, err := flagsmith.NewLocalFileHandler("./fixtures/environment.json")
+	require.NoError(t, err)
+	offlineClient := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithOfflineMode(),
+		flagsmith.WithOfflineHandler(offlineHandler))
+
+	// When
+	transientErr := client.SetTraits(ctx, "identity", []*flagsmith.Trait{{TraitKey: "session", TraitValue: "x", Transient: true}})
+	nilErr := client.SetTraits(ctx, "identity", []*flagsmith.Trait{{TraitKey: "plan", TraitValue: "pro"}, nil})
+	identifierErr := client.SetTraits(ctx, "", []*flagsmith.Trait{{TraitKey: "plan", TraitValue: "pro"}})
+	offlineErr := offlineClient.DeleteTrait(ctx, "identity", "plan")
+
+	// Then
+	assert.ErrorIs(t, transientErr, flagsmith.ErrTransientTrait)
+	assert.ErrorIs(t, nilErr, flagsmith.ErrNilTrait)
+	assert.ErrorIs(t, identifierErr, flagsmith.ErrIdentifierRequired)
+	assert.ErrorIs(t, offlineErr, flagsmith.ErrOfflineMode)
+	assert.Empty(t, writes())
+}
+
+func TestSetTraitsQueuesAndMergesWritesWithLocalEvaluation(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server, writes := traitsServer(t, nil)
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithLocalEvaluation(ctx), flagsmith.WithTraitWriteQueue(10, time.Hour))
+	defer func() { _ = client.Close() }()
+
+	// When
+	require.NoError(t, client.SetTraits(ctx, "first", []*flagsmith.Trait{{TraitKey: "plan", TraitValue: "free"}}))
+	require.NoError(t, client.SetTraits(ctx, "second", []*flagsmith.Trait{{TraitKey: "plan", TraitValue: "free"}}))
+	require.NoError(t, client.SetTraits(ctx, "first", []*flagsmith.Trait{{TraitKey: "plan", TraitValue: "pro"}}))
+	require.NoError(t, client.DeleteTrait(ctx, "first", "age"))
+	queued := writes()
+	err := client.FlushTraits(ctx)
+
+	// Then
+	require.NoError(t, err)
+	assert.Empty(t, queued)
+	assert.ElementsMatch(t, []identityWrite{
+		{Identifier: "first", Traits: []*flagsmith.Trait{{TraitKey: "age", TraitValue: nil}, {TraitKey: "plan", TraitValue: "pro"}}},
+		{Identifier: "second", Traits: []*flagsmith.Trait{{TraitKey: "plan", TraitValue: "free"}}},
+	}, writes())
+}
+
+func TestFlushTraitsSendsIdentitiesConcurrently(t *testing.T) {
+	// Given: an identities endpoint which waits until three requests are in flight
+	ctx := context.Background()
+	var inFlight sync.WaitGroup
+	inFlight.Add(3)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/api/v1/environment-document/" {
+			_, err := io.WriteString(rw, fixtures.EnvironmentJson)
+			assert.NoError(t, err)
+			return
+		}
+		inFlight.Done()
+		inFlight.Wait()
+		_, err := io.WriteString(rw, fixtures.IdentityResponseJson)
+		assert.NoError(t, err)
+	}))
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithLocalEvaluation(ctx), flagsmith.WithTraitWriteQueue(10, time.Hour))
+	defer func() { _ = client.Close() }()
+	for _, identifier := range []string{"first", "second", "third"} {
+		require.NoError(t, client.SetTraits(ctx, identifier, []*flagsmith.Trait{{TraitKey: "plan", TraitValue: "pro"}}))
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	// When
+	err := client.FlushTraits(timeoutCtx)
+
+	// Then
+	assert.NoError(t, err)
+}
+
+func TestSetTraitsAppliesBackPressureWithLocalEvaluation(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	release := make(chan struct{})
+	server, writes := traitsServer(t, release)
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithLocalEvaluation(ctx), flagsmith.WithTraitWriteQueue(1, 10*time.Millisecond))
+	traits := []*flagsmith.Trait{{TraitKey: "plan", TraitValue: "pro"}}
+	require.NoError(t, client.SetTraits(ctx, "sent", traits))
+	time.Sleep(50 * time.Millisecond) // The writer is now blocked sending the first write.
+	require.NoError(t, client.SetTraits(ctx, "queued", traits))
+
+	// When
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	err := client.SetTraits(timeoutCtx, "blocked", traits)
+
+	// Then
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	close(release)
+	require.NoError(t, client.Close())
+	var identifiers []string
+	for _, write := range writes() {
+		identifiers = append(identifiers, write.Identifier)
+	}
+	assert.Equal(t, []string{"sent", "queued"}, identifiers)
+}
+
+func TestCloseFlushesQueuedTraitWrites(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	server, writes := traitsServer(t, nil)
+	defer server.Close()
+	client := flagsmith.NewClient(fixtures.EnvironmentAPIKey, flagsmith.WithBaseURL(server.URL+"/api/v1/"),
+		flagsmith.WithLocalEvaluation(ctx), flagsmith.WithTraitWriteQueue(10, time.Hour))
+	require.NoError(t, client.SetTraits(ctx, "identity", []*flagsmith.Trait{{TraitKey: "plan", TraitValue: "pro"}}))
+
+	// When
+	err := client.Close()
+
+	// Then
+	require.NoError(t, err)
+	assert.Len(t, writes(), 1)
+	assert.ErrorIs(t, client.SetTraits(ctx, "identity", nil), flagsmith.ErrClientClosed)
+}